@@ -0,0 +1,109 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+)
+
+// newAdminEcho creates the echo instance of the admin listener. It has its own middleware stack, so the public
+// middlewares (CORS, body limit, timeout, access log...) never apply to the admin routes.
+func newAdminEcho(logger echo.Logger) *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Logger = logger
+
+	e.Use(echomiddleware.Recover())
+
+	// IMPORTANT: The k8s probes don't send the bearer token, so the health endpoints are public on the admin port.
+	var skipPaths []string
+	if config.Bean.Health.On {
+		livenessPath, readinessPath := healthPaths()
+		skipPaths = append(skipPaths, livenessPath, readinessPath)
+	}
+	e.Use(adminAuth(config.Bean.Admin.AuthBearerToken, skipPaths))
+
+	return e
+}
+
+// adminAuth checks the `Authorization: Bearer <token>` header. No check if the token is empty.
+func adminAuth(token string, skipPaths []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return next(c)
+			}
+
+			for _, path := range skipPaths {
+				if c.Request().URL.Path == path {
+					return next(c)
+				}
+			}
+
+			if subtle.ConstantTimeCompare([]byte(helpers.ExtractJWTFromHeader(c)), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+					"message": "Unauthorized!",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// registerPprof adds the `net/http/pprof` handlers under `/debug/pprof/`.
+func registerPprof(e *echo.Echo) {
+	g := e.Group("/debug/pprof")
+	// IMPORTANT: The index links to the profiles by relative paths, so it must be served with the trailing slash.
+	g.GET("", func(c echo.Context) error {
+		return c.Redirect(http.StatusMovedPermanently, "/debug/pprof/")
+	})
+	g.GET("/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	g.GET("/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	g.Any("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	g.GET("/:name", func(c echo.Context) error {
+		name := strings.TrimPrefix(c.Param("name"), "/")
+		pprof.Handler(name).ServeHTTP(c.Response(), c.Request())
+		return nil
+	})
+}
+
+// adminOrPublic returns the echo instance to register the admin routes: the admin listener if it is on,
+// otherwise the public one.
+func (b *Bean) adminOrPublic() *echo.Echo {
+	if b.AdminEcho != nil {
+		return b.AdminEcho
+	}
+	return b.Echo
+}
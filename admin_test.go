@@ -0,0 +1,72 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_AdminListener(t *testing.T) {
+	originalConf := config.Bean
+	defer func() { config.Bean = originalConf }()
+
+	config.Bean = &config.Config{}
+	config.Bean.HTTP.BodyLimit = "1M"
+	config.Bean.Admin.On = true
+	config.Bean.Admin.AuthBearerToken = "secret"
+	config.Bean.Admin.Pprof = true
+	config.Bean.Health.On = true
+
+	b := New()
+
+	// The admin routes are not served by the public port.
+	for _, r := range b.Echo.Routes() {
+		assert.NotEqual(t, "/healthz", r.Path)
+	}
+
+	// The health endpoints don't need the token for the k8s probes.
+	code, _ := request(http.MethodGet, "/healthz", b.AdminEcho)
+	assert.Equal(t, http.StatusOK, code)
+
+	// The relative links of the pprof index resolve under `/debug/pprof/`.
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	rec := httptest.NewRecorder()
+	b.AdminEcho.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/debug/pprof/", rec.Header().Get(echo.HeaderLocation))
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	rec = httptest.NewRecorder()
+	b.AdminEcho.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Types of profiles available")
+
+	tests := []struct {
+		name       string
+		auth       string
+		wantStatus int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", auth: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", auth: "Bearer secret", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil)
+			if tt.auth != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			b.AdminEcho.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"path"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -61,6 +62,8 @@ func Execute(fn func(), poolName ...string) {
 				defer recoverPanic(context.TODO())
 				err = pool.Submit(task)
 				if err != nil {
+					// The task will never run.
+					inFlight.done()
 					panic(err)
 				}
 			}
@@ -69,14 +72,74 @@ func Execute(fn func(), poolName ...string) {
 		}
 	}
 
-	asyncFunc(fn)
+	inFlight.add()
+	asyncFunc(func() {
+		defer inFlight.done()
+		fn()
+	})
+}
+
+// inFlight counts the tasks which are executing or waiting for a goroutine of a pool.
+var inFlight tasks
+
+// tasks is a counter which, unlike a `sync.WaitGroup`, can be incremented while it is waited for, e.g. by the
+// requests which are still drained during the shutdown.
+type tasks struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed when the counter drops to zero.
+	idle chan struct{}
+}
+
+func (t *tasks) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+func (t *tasks) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+// wait returns a channel which is closed once no task is running, including the ones added in the meantime.
+func (t *tasks) wait() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.n == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return t.idle
+}
+
+// Wait blocks until all the tasks started by `Execute`, `ExecuteWithContext` and `ExecuteWithTimeout` finish
+// or the context is done, including the tasks started while it waits. Bean calls it during the graceful shutdown.
+func Wait(ctx context.Context) error {
+	select {
+	case <-inFlight.wait():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // ExecuteWithContext provides a safe way to execute a function asynchronously with a context, recovering if they panic
 // and provides all error stack aiming to facilitate fail causes discovery.
 func ExecuteWithContext(fn Task, c echo.Context, poolName ...string) {
 	functionName := "unknown function"
-	if config.Bean.Sentry.On && config.Bean.Sentry.TracesSampleRate > 0.0 {
+	if config.Bean.Sentry.On && config.Current().Sentry.TracesSampleRate > 0.0 {
 		if pc, file, line, ok := runtime.Caller(1); ok {
 			functionName = fmt.Sprintf("%s:%d\n\t\r %s\n", path.Base(file), line, runtime.FuncForPC(pc).Name())
 		}
@@ -101,7 +164,7 @@ func ExecuteWithContext(fn Task, c echo.Context, poolName ...string) {
 			hub.Scope().SetRequest(ec.Request())
 			ctx = sentry.SetHubOnContext(ctx, hub)
 
-			if config.Bean.Sentry.TracesSampleRate > 0.0 {
+			if config.Current().Sentry.TracesSampleRate > 0.0 {
 				urlPath := ec.Request().URL.Path
 
 				span := sentry.StartSpan(ctx, "async",
@@ -132,7 +195,7 @@ func ExecuteWithContext(fn Task, c echo.Context, poolName ...string) {
 
 func ExecuteWithTimeout(ctx context.Context, duration time.Duration, fn TimeoutTask, poolName ...string) {
 	functionName := "unknown function"
-	if config.Bean.Sentry.On && config.Bean.Sentry.TracesSampleRate > 0.0 {
+	if config.Bean.Sentry.On && config.Current().Sentry.TracesSampleRate > 0.0 {
 		if pc, file, line, ok := runtime.Caller(1); ok {
 			functionName = fmt.Sprintf("%s:%d\n\t\r %s\n", path.Base(file), line, runtime.FuncForPC(pc).Name())
 		}
@@ -161,7 +224,7 @@ func ExecuteWithTimeout(ctx context.Context, duration time.Duration, fn TimeoutT
 		}
 
 		// can pull the right hub and send the exception message to sentry.
-		if config.Bean.Sentry.On && config.Bean.Sentry.TracesSampleRate > 0.0 {
+		if config.Bean.Sentry.On && config.Current().Sentry.TracesSampleRate > 0.0 {
 			var transactionName string
 			if parentSpan != nil {
 				transactionName = parentSpan.Name
@@ -0,0 +1,56 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package async
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWait(t *testing.T) {
+	require.NoError(t, Wait(context.Background()))
+
+	var finished atomic.Int32
+	release := make(chan struct{})
+	Execute(func() {
+		<-release
+		finished.Add(1)
+	})
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- Wait(context.Background())
+	}()
+
+	// A task started while `Wait` waits, e.g. by a request drained during the shutdown, is waited for as well.
+	time.Sleep(10 * time.Millisecond)
+	Execute(func() {
+		<-release
+		finished.Add(1)
+	})
+
+	select {
+	case <-waited:
+		t.Fatal("Wait returned before the tasks finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-waited)
+	assert.Equal(t, int32(2), finished.Load())
+}
+
+func TestWait_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	Execute(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Wait(ctx), context.DeadlineExceeded)
+}
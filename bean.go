@@ -24,17 +24,19 @@ package bean
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"html/template"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -48,19 +50,26 @@ import (
 	elog "github.com/labstack/gommon/log"
 	"github.com/panjf2000/ants/v2"
 	pkgerrors "github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/v2/circuitbreaker"
 	"github.com/retail-ai-inc/bean/v2/config"
 	"github.com/retail-ai-inc/bean/v2/echoview"
 	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/featureflag"
 	"github.com/retail-ai-inc/bean/v2/goview"
 	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/httpcache"
+	"github.com/retail-ai-inc/bean/v2/httpclient"
 	"github.com/retail-ai-inc/bean/v2/internal/binder"
 	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
 	"github.com/retail-ai-inc/bean/v2/internal/gopool"
+	"github.com/retail-ai-inc/bean/v2/internal/listener"
 	"github.com/retail-ai-inc/bean/v2/internal/middleware"
 	"github.com/retail-ai-inc/bean/v2/internal/regex"
 	broute "github.com/retail-ai-inc/bean/v2/internal/route"
+	"github.com/retail-ai-inc/bean/v2/internal/tlsconfig"
 	"github.com/retail-ai-inc/bean/v2/internal/validator"
 	blog "github.com/retail-ai-inc/bean/v2/log"
+	"github.com/retail-ai-inc/bean/v2/maintenance"
 	"github.com/retail-ai-inc/bean/v2/store/memory"
 	"github.com/retail-ai-inc/bean/v2/trace"
 	"github.com/rs/dnscache"
@@ -69,6 +78,14 @@ import (
 )
 
 // All database connections are initialized using `DBDeps` structure.
+//
+// IMPORTANT: The `Tenant*` maps hold the tenants opened by `InitDB` and are never updated, use `Tenants`,
+// `Tenant` or `ForTenant` to see the tenants added, changed, removed or recovered at runtime. The connections
+// they hold are never closed before the shutdown, so a changed or removed tenant keeps its initial connections
+// in the maps. They are empty with `database.tenant.pool.lazy`, and do not hold the tenants which could not be
+// opened.
+//
+// The `*MySQL*` gorm connections are PostgreSQL ones if the `driver` of the database is `postgres`.
 type DBDeps struct {
 	MasterMySQLDB      *gorm.DB
 	MasterMySQLDBName  string
@@ -80,16 +97,41 @@ type DBDeps struct {
 	TenantMongoDBNames map[uint64]string
 	MasterRedisDB      *dbdrivers.RedisDBConn
 	TenantRedisDBs     map[uint64]*dbdrivers.RedisDBConn
+	TenantCodes        map[string]uint64
 	MemoryDB           memory.Cache
+
+	tenantsOnce     sync.Once
+	tenants         *TenantRegistry
+	tenantLoader    *tenantLoader
+	reloadMu        sync.Mutex
+	closeMu         sync.Mutex
+	pendingCloses   map[*pendingClose]struct{}
+	circuitBreakers *circuitbreaker.Settings
 }
 
 type Bean struct {
 	DBConn            *DBDeps
 	Echo              *echo.Echo
+	AdminEcho         *echo.Echo
+	Maintenance       *maintenance.Switch
+	HTTPCache         *httpcache.Cache
+	FeatureFlags      *featureflag.Service
 	BeforeServe       func()
 	errorHandlerFuncs []berror.ErrorHandlerFunc
 	Validate          *validatorV10.Validate
-	Config            config.Config
+	// Config is the configuration at startup, see `config.Current` for the hot reloaded one.
+	Config         config.Config
+	shuttingDown   atomic.Bool
+	healthChecksMu sync.RWMutex
+	healthChecks   map[string]HealthCheckFunc
+	lifecycle      lifecycle
+}
+
+// WithPrimaryDB returns a copy of the context which sends the reads of the MySQL databases to the primary instead
+// of the read replicas of `database.mysql.master.reads` or of the `reads` of a tenant, e.g. to read a row right
+// after writing it. Pass it with `db.WithContext(ctx)`.
+func WithPrimaryDB(ctx context.Context) context.Context {
+	return dbdrivers.WithPrimary(ctx)
 }
 
 // If a command or service wants to use a different `host` parameter for tenant database connection
@@ -97,9 +139,40 @@ type Bean struct {
 // Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
 var TenantAlterDbHostParam string
 
+// MySQLDatabase is the SQL database a new connection is dialed to. `TenantID` is 0 for the master database, and
+// `Driver` is `mysql` or `postgres`.
+type MySQLDatabase struct {
+	TenantID uint64
+	Driver   string
+	Host     string
+	Port     string
+	Database string
+	Username string
+}
+
+// MySQLCredentialProvider returns the credentials of a MySQL or PostgreSQL database, e.g. an IAM authentication
+// token or a password from a secret manager. An empty username keeps the configured one.
+type MySQLCredentialProvider interface {
+	MySQLCredentials(ctx context.Context, db MySQLDatabase) (username, password string, err error)
+}
+
+// MySQLCredentialProviderFunc is an adapter to use a function as a `MySQLCredentialProvider`.
+type MySQLCredentialProviderFunc func(ctx context.Context, db MySQLDatabase) (username, password string, err error)
+
+func (f MySQLCredentialProviderFunc) MySQLCredentials(ctx context.Context, db MySQLDatabase) (string, string, error) {
+	return f(ctx, db)
+}
+
+// MySQLCredentials, if set before `InitDB`, is asked for the credentials each time a new connection is dialed to
+// the master database, its read replicas or a tenant database, so a rotated password works without a restart.
+var MySQLCredentials MySQLCredentialProvider
+
 // Support a DNS cache version of the net/http Transport.
 var NetHttpFastTransporter *http.Transport
 
+// metricsPath is the fixed path of the prometheus metrics endpoint.
+const metricsPath = "/metrics"
+
 func New() (b *Bean) {
 
 	if config.Bean == nil {
@@ -115,27 +188,34 @@ func New() (b *Bean) {
 		Config:   *config.Bean,
 	}
 
+	// IMPORTANT: The admin routes (metrics, health, pprof, memory cache admin) are served by a separate
+	// listener to keep them off the public port.
+	if config.Bean.Admin.On {
+		b.AdminEcho = newAdminEcho(e.Logger)
+	}
+
 	// If `NetHttpFastTransporter` is on from env.json then initialize it.
 	if config.Bean.NetHttpFastTransporter.On {
 		resolver := &dnscache.Resolver{}
 		if config.Bean.NetHttpFastTransporter.MaxIdleConns == nil {
-			*config.Bean.NetHttpFastTransporter.MaxIdleConns = 0
+			config.Bean.NetHttpFastTransporter.MaxIdleConns = new(int)
 		}
 
 		if config.Bean.NetHttpFastTransporter.MaxIdleConnsPerHost == nil {
-			*config.Bean.NetHttpFastTransporter.MaxIdleConnsPerHost = 0
+			config.Bean.NetHttpFastTransporter.MaxIdleConnsPerHost = new(int)
 		}
 
 		if config.Bean.NetHttpFastTransporter.MaxConnsPerHost == nil {
-			*config.Bean.NetHttpFastTransporter.MaxConnsPerHost = 0
+			config.Bean.NetHttpFastTransporter.MaxConnsPerHost = new(int)
 		}
 
 		if config.Bean.NetHttpFastTransporter.IdleConnTimeout == nil {
-			*config.Bean.NetHttpFastTransporter.IdleConnTimeout = 0
+			config.Bean.NetHttpFastTransporter.IdleConnTimeout = new(time.Duration)
 		}
 
 		if config.Bean.NetHttpFastTransporter.DNSCacheTimeout == nil {
-			*config.Bean.NetHttpFastTransporter.DNSCacheTimeout = 5 * time.Minute
+			dnsCacheTimeout := 5 * time.Minute
+			config.Bean.NetHttpFastTransporter.DNSCacheTimeout = &dnsCacheTimeout
 		}
 
 		NetHttpFastTransporter = &http.Transport{
@@ -173,7 +253,7 @@ func New() (b *Bean) {
 
 	// If `memory` database is on and `delKeyAPI` end point along with bearer token are properly set.
 	if config.Bean.Database.Memory.On && config.Bean.Database.Memory.DelKeyAPI.EndPoint != "" {
-		e.DELETE(config.Bean.Database.Memory.DelKeyAPI.EndPoint, func(c echo.Context) error {
+		b.adminOrPublic().DELETE(config.Bean.Database.Memory.DelKeyAPI.EndPoint, func(c echo.Context) error {
 			// If you set empty `authBearerToken` string in env.json then bean will not check the `Authorization` header.
 			if config.Bean.Database.Memory.DelKeyAPI.AuthBearerToken != "" {
 				tokenString := helpers.ExtractJWTFromHeader(c)
@@ -184,7 +264,11 @@ func New() (b *Bean) {
 				}
 			}
 
+			// The keys of the response cache have slashes, so they are sent escaped, e.g. `httpcache:1:%2Fproducts%2F*`.
 			key := c.Param("key")
+			if unescaped, err := url.PathUnescape(key); err == nil {
+				key = unescaped
+			}
 			b.DBConn.MemoryDB.DelMemory(key)
 			return c.JSON(http.StatusOK, map[string]interface{}{
 				"message": "Done",
@@ -192,6 +276,36 @@ func New() (b *Bean) {
 		})
 	}
 
+	// Liveness and readiness endpoints for k8s probes.
+	if config.Bean.Health.On {
+		livenessPath, readinessPath := healthPaths()
+		b.adminOrPublic().GET(livenessPath, b.LivenessHandler)
+		b.adminOrPublic().GET(readinessPath, b.ReadinessHandler)
+	}
+
+	if b.AdminEcho != nil {
+		if config.Bean.Prometheus.On {
+			b.AdminEcho.GET(metricsPath, echoprometheus.NewHandler())
+		}
+
+		if config.Bean.Admin.Pprof {
+			registerPprof(b.AdminEcho)
+		}
+	}
+
+	// IMPORTANT: Drain the async tasks before releasing the goroutine pools, and flush sentry at the very end
+	// so that the errors of the other shutdown hooks are sent.
+	b.OnShutdown("async", drainAsync, WithPriority(ShutdownPriorityAsync))
+	if len(b.Config.HTTPClients) > 0 {
+		b.OnShutdown("httpclient", func(context.Context) error {
+			httpclient.CloseIdleConnections()
+			return nil
+		}, WithPriority(ShutdownPriorityAsync))
+	}
+	if b.Config.Sentry.On {
+		b.OnShutdown("sentry", flushSentry, WithPriority(ShutdownPrioritySentry))
+	}
+
 	return b
 }
 
@@ -216,7 +330,7 @@ func NewEcho() *echo.Echo {
 		Extension:    ".html",
 		Master:       "templates/master",
 		Partials:     []string{},
-		Funcs:        make(template.FuncMap),
+		Funcs:        template.FuncMap{"featureEnabled": featureflag.TemplateFunc},
 		DisableCache: !viewsTemplateCache,
 		Delims:       goview.Delims{Left: "{{", Right: "}}"},
 	})
@@ -240,11 +354,9 @@ func NewEcho() *echo.Echo {
 	// Sets the maximum allowed size for a request body, return `413 - Request Entity Too Large` if the size exceeds the limit.
 	e.Use(echomiddleware.BodyLimit(config.Bean.HTTP.BodyLimit))
 
-	// CORS initialization and support only HTTP methods which are configured under `http.allowedMethod` parameters in `env.json`.
-	e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: config.Bean.HTTP.AllowedMethod,
-	}))
+	// CORS initialization with the policies under `http.cors` and support only HTTP methods which are configured
+	// under `http.allowedMethod` parameters in `env.json`. All origins are allowed if `allowOrigins` is empty.
+	e.Use(middleware.CORS(config.Bean.HTTP.CORS, config.Bean.HTTP.AllowedMethod))
 
 	// Basic HTTP headers security like XSS protection...
 	e.Use(echomiddleware.SecureWithConfig(echomiddleware.SecureConfig{
@@ -300,6 +412,13 @@ func NewEcho() *echo.Echo {
 			if clientOption.TracesSampleRate > 0 {
 				clientOption.EnableTracing = true
 			}
+
+			// IMPORTANT: With hot reload, the sample rate is read from the current config on every transaction
+			// so that `sentry.tracesSampleRate` can be changed without restarting the server.
+			if config.Bean.HotReload && clientOption.TracesSampler == nil {
+				clientOption.EnableTracing = true
+				clientOption.TracesSampler = currentTracesSampler
+			}
 			if err := sentry.Init(*clientOption); err != nil {
 				e.Logger.Fatal("Sentry initialization failed: ", err, ". Server 🚀  crash landed. Exiting...")
 			}
@@ -315,7 +434,7 @@ func NewEcho() *echo.Echo {
 				Timeout: config.Bean.Sentry.Timeout,
 			}))
 
-			if helpers.FloatInRange(config.Bean.Sentry.TracesSampleRate, 0.0, 1.0) > 0.0 {
+			if config.Bean.HotReload || helpers.FloatInRange(config.Bean.Sentry.TracesSampleRate, 0.0, 1.0) > 0.0 {
 				regex.CompileTraceSkipPaths(config.Bean.Sentry.SkipTracesEndpoints)
 				e.Use(middleware.SkipSampling())
 			}
@@ -333,12 +452,15 @@ func NewEcho() *echo.Echo {
 	// Set the `X-Request-ID` header field if it doesn't exist.
 	e.Use(echomiddleware.RequestIDWithConfig(echomiddleware.RequestIDConfig{
 		Generator: uuid.NewString,
+		// Keep the request ID in the request context for the outgoing calls (see `httpclient`).
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(trace.WithRequestID(c.Request().Context(), id)))
+		},
 	}))
 
 	// Enable prometheus metrics middleware. Metrics data should be accessed via `/metrics` endpoint.
 	// This will help us to integrate `bean's` health into `k8s`.
 	if config.Bean.Prometheus.On {
-		const metricsPath = "/metrics" // fixed path
 		if err := regex.CompilePrometheusSkipPaths(config.Bean.Prometheus.SkipEndpoints, metricsPath); err != nil {
 			e.Logger.Fatalf("Prometheus initialization failed: %v. Server 🚀  crash landed. Exiting...\n", err)
 		}
@@ -349,7 +471,11 @@ func NewEcho() *echo.Echo {
 			conf.Subsystem = config.Bean.Prometheus.Subsystem
 		}
 		e.Use(echoprometheus.NewMiddlewareWithConfig(conf))
-		e.GET(metricsPath, echoprometheus.NewHandler())
+
+		// With the admin listener, `New` serves the metrics on the admin port.
+		if !config.Bean.Admin.On {
+			e.GET(metricsPath, echoprometheus.NewHandler())
+		}
 	}
 
 	// Register goroutine pool
@@ -358,17 +484,7 @@ func NewEcho() *echo.Echo {
 			continue
 		}
 
-		poolSize := -1
-		if asyncPool.Size != nil {
-			poolSize = *asyncPool.Size
-		}
-
-		blockAfter := 0
-		if asyncPool.BlockAfter != nil {
-			blockAfter = *asyncPool.BlockAfter
-		}
-
-		pool, err := ants.NewPool(poolSize, ants.WithMaxBlockingTasks(blockAfter))
+		pool, err := newAsyncPool(asyncPool.Size, asyncPool.BlockAfter)
 		if err != nil {
 			e.Logger.Fatal("async pool initialization failed: ", err, ". Server 🚀  crash landed. Exiting...")
 		}
@@ -379,23 +495,99 @@ func NewEcho() *echo.Echo {
 		}
 	}
 
+	// Register the outgoing HTTP clients, use them by `httpclient.Get(name)`.
+	if err := httpclient.Init(config.Bean.HTTPClients); err != nil {
+		e.Logger.Fatal("http client register failed: ", err, ". Server 🚀  crash landed. Exiting...")
+	}
+
+	// IMPORTANT: Re-apply the runtime settings (skip paths, sentry sample rate, async pool sizes)
+	// whenever the config file changes.
+	if config.Bean.HotReload {
+		watchConfigOnce.Do(func() {
+			config.OnChange(applyConfigChange)
+			config.WatchConfig()
+		})
+	}
+
 	return e
 }
 
+// newAsyncPool creates a goroutine pool. The pool is unlimited if `size` is nil.
+func newAsyncPool(size, blockAfter *int) (*ants.Pool, error) {
+	poolSize := -1
+	if size != nil {
+		poolSize = *size
+	}
+
+	maxBlockingTasks := 0
+	if blockAfter != nil {
+		maxBlockingTasks = *blockAfter
+	}
+
+	return ants.NewPool(poolSize, ants.WithMaxBlockingTasks(maxBlockingTasks))
+}
+
+// ServeAt starts the server at `host:port`. It listens on `http.unixSocket.path` instead if it is set, or on
+// the sockets passed by systemd if `http.socketActivation` is on and the process was socket activated.
 func (b *Bean) ServeAt(host, port string) error {
-	b.Echo.Logger.Info("Starting " + b.Config.Environment + " " + b.Config.ProjectName + " at " + host + ":" + port + "...🚀")
+	ln, adminLn, err := b.listen(host, port)
+	if err != nil {
+		return pkgerrors.Wrapf(err, "error during server startup")
+	}
+
+	return b.serve(ln, adminLn)
+}
+
+// Serve starts the server on a listener created by the caller, e.g. inherited from the parent process
+// for a zero downtime restart. The listener is closed when the server shuts down.
+func (b *Bean) Serve(ln net.Listener) error {
+	return b.serve(ln, nil)
+}
+
+// listen creates the listeners of the public and the admin servers. The admin listener is nil unless
+// it is passed by systemd and `admin.on` is true.
+func (b *Bean) listen(host, port string) (ln, adminLn net.Listener, err error) {
+	if b.Config.HTTP.SocketActivation {
+		sockets, err := listener.Systemd()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// IMPORTANT: Listen by ourselves if the process wasn't socket activated, e.g. in local development.
+		if len(sockets) > 0 {
+			return b.systemdListeners(sockets)
+		}
+	}
+
+	if b.Config.HTTP.UnixSocket.Path != "" {
+		mode, err := listener.ParseMode(b.Config.HTTP.UnixSocket.Mode)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ln, err = listener.Unix(b.Config.HTTP.UnixSocket.Path, mode)
+		return ln, nil, err
+	}
+
+	ln, err = net.Listen("tcp", host+":"+port)
+	return ln, nil, err
+}
+
+func (b *Bean) serve(ln net.Listener, adminLn net.Listener) error {
+	b.Echo.Logger.Info("Starting " + b.Config.Environment + " " + b.Config.ProjectName + " at " + ln.Addr().String() + "...🚀")
 
 	b.UseErrorHandlerFuncs(berror.DefaultErrorHandlerFunc)
 	b.Echo.HTTPErrorHandler = b.DefaultHTTPErrorHandler()
 
 	v, err := NewValidator(b.Validate)
 	if err != nil {
+		closeListeners(ln, adminLn)
 		return err
 	}
 	b.Echo.Validator = v
 
 	s := http.Server{
-		Addr:    host + ":" + port,
+		Addr:    ln.Addr().String(),
 		Handler: b.Echo,
 	}
 
@@ -408,45 +600,152 @@ func (b *Bean) ServeAt(host, port string) error {
 		b.BeforeServe()
 	}
 
+	if b.Config.Database.Tenant.Resolver.On {
+		b.useTenantResolver()
+	}
+
+	if b.Config.Maintenance.On {
+		b.useMaintenance()
+	}
+
+	if b.Config.RateLimit.On {
+		if err := b.useRateLimit(); err != nil {
+			closeListeners(ln, adminLn)
+			return err
+		}
+	}
+
+	if b.Config.Idempotency.On {
+		if err := b.useIdempotency(); err != nil {
+			closeListeners(ln, adminLn)
+			return err
+		}
+	}
+
+	if b.Config.HTTPCache.On {
+		if err := b.useHTTPCache(); err != nil {
+			closeListeners(ln, adminLn)
+			return err
+		}
+	}
+
+	if b.Config.FeatureFlags.On {
+		if b.FeatureFlags == nil {
+			if err := b.InitFeatureFlags(); err != nil {
+				closeListeners(ln, adminLn)
+				return err
+			}
+		}
+		if !b.Config.Database.Tenant.Resolver.On {
+			b.Echo.Use(featureflag.Middleware(b.Config.FeatureFlags.TenantHeader))
+		}
+	}
+
 	// Keep all the route information in route.Routes
 	broute.Init(b.Echo)
 
+	if err := b.Start(context.Background()); err != nil {
+		closeListeners(ln, adminLn)
+		return errors.Join(err, b.shutdownWithTimeout())
+	}
+
 	// Start the server
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	errCh := make(chan error, 1)
-	go func() {
-		var err error
-		if b.Config.HTTP.SSL.On {
-			s.TLSConfig = &tls.Config{
-				MinVersion: b.Config.HTTP.SSL.MinTLSVersion,
+	if b.Config.HTTP.SSL.On {
+		reloader, err := tlsconfig.New(tlsconfig.Options{
+			CertFile:     b.Config.HTTP.SSL.CertFile,
+			KeyFile:      b.Config.HTTP.SSL.PrivFile,
+			ClientCAFile: b.Config.HTTP.SSL.ClientCAFile,
+			ClientAuth:   b.Config.HTTP.SSL.ClientAuth,
+			MinVersion:   b.Config.HTTP.SSL.MinTLSVersion,
+		})
+		if err != nil {
+			closeListeners(ln, adminLn)
+			return errors.Join(pkgerrors.Wrapf(err, "error during server startup"), b.shutdownWithTimeout())
+		}
+		s.TLSConfig = reloader.TLSConfig()
+
+		// Pick up the rotated certificates on file change or `SIGHUP` without restarting the server.
+		go func() {
+			err := reloader.Watch(ctx, func(err error) {
+				if err != nil {
+					b.Echo.Logger.Errorf("Failed to reload the TLS certificates: %v", err)
+					return
+				}
+				b.Echo.Logger.Info("TLS certificates have been reloaded.")
+			})
+			if err != nil {
+				b.Echo.Logger.Errorf("Failed to watch the TLS certificates: %v", err)
 			}
-			err = s.ListenAndServeTLS(b.Config.HTTP.SSL.CertFile, b.Config.HTTP.SSL.PrivFile)
-		} else {
-			err = s.ListenAndServe()
+		}()
+	}
+
+	// The channel is closed when both the public and the admin servers stopped.
+	errCh := make(chan error, 2)
+	var wg sync.WaitGroup
+	listen := func(listenAndServe func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// If shutdown is called, the server will return `http.ErrServerClosed` immediately.
+			if err := listenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}()
+	}
+
+	listen(func() error {
+		if b.Config.HTTP.SSL.On {
+			// IMPORTANT: The certificate is served by `TLSConfig.GetCertificate`.
+			return s.ServeTLS(ln, "", "")
 		}
-		// If shutdown is called, the server will return `http.ErrServerClosed` immediately.
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			errCh <- err
+		return s.Serve(ln)
+	})
+
+	var adminSrv *http.Server
+	if b.AdminEcho != nil {
+		adminSrv = &http.Server{
+			Addr:    b.Config.Admin.Host + ":" + b.Config.Admin.Port,
+			Handler: b.AdminEcho,
 		}
+		if adminLn != nil {
+			adminSrv.Addr = adminLn.Addr().String()
+			listen(func() error { return adminSrv.Serve(adminLn) })
+		} else {
+			listen(adminSrv.ListenAndServe)
+		}
+		b.Echo.Logger.Info("Starting admin server at " + adminSrv.Addr + "...")
+	}
+
+	go func() {
+		wg.Wait()
 		close(errCh)
 	}()
 
 	select {
 	case srvErr := <-errCh:
 		if srvErr != nil {
-			return pkgerrors.Wrapf(srvErr, "error during server startup")
+			// IMPORTANT: Stop the other server if one of them failed to start.
+			_ = s.Close()
+			if adminSrv != nil {
+				_ = adminSrv.Close()
+			}
+			return errors.Join(pkgerrors.Wrapf(srvErr, "error during server startup"), b.shutdownWithTimeout())
 		}
 	case <-ctx.Done(): // Wait for the interrupt signal or termination signal.
-		var timeout time.Duration
-		if b.Config.HTTP.ShutdownTimeout > 0 {
-			timeout = b.Config.HTTP.ShutdownTimeout
-		} else {
-			timeout = 30 * time.Second
+		// IMPORTANT: Fail the readiness probe first so that no new traffic is routed to this instance, and keep
+		// serving until the load balancers noticed it.
+		b.shuttingDown.Store(true)
+		if delay := b.Config.Health.ShutdownDelay; delay > 0 {
+			b.Echo.Logger.Infof("Waiting %s before shutting down...", delay)
+			time.Sleep(delay)
 		}
-		sdnCtx, cancel := context.WithTimeout(context.Background(), timeout)
+
+		sdnCtx, cancel := context.WithTimeout(context.Background(), b.shutdownTimeout())
 		defer cancel()
+
 		b.Echo.Logger.Info("Shutting down server...🛬")
 		err = s.Shutdown(sdnCtx)
 		if err != nil {
@@ -456,6 +755,18 @@ func (b *Bean) ServeAt(host, port string) error {
 		} else {
 			b.Echo.Logger.Info("Server has been shutdown gracefully.")
 		}
+
+		// The admin server keeps serving the metrics and probes until the public server is drained.
+		if adminSrv != nil {
+			if adminErr := adminSrv.Shutdown(sdnCtx); adminErr != nil {
+				err = errors.Join(err, pkgerrors.Wrapf(adminErr, "failed to gracefully shutdown the admin server"))
+			}
+		}
+
+		// IMPORTANT: Release the resources after the in-flight requests finished, within the same timeout.
+		if hookErr := b.Shutdown(sdnCtx); hookErr != nil {
+			err = errors.Join(err, hookErr)
+		}
 	}
 
 	// Check if there might be any other error than `http.ErrServerClosed`
@@ -474,6 +785,72 @@ func (b *Bean) ServeAt(host, port string) error {
 	return nil
 }
 
+// systemdListeners picks the listeners of the public and the admin servers among the sockets passed by systemd
+// and closes the others. The sockets can be named by `FileDescriptorName=` of the systemd socket units, otherwise
+// they are named after the unit, e.g. `myapp.socket`, and the first one which isn't `admin` is used.
+func (b *Bean) systemdListeners(sockets []listener.Socket) (ln, adminLn net.Listener, err error) {
+	for _, s := range sockets {
+		switch {
+		case s.Name == "http" && ln == nil:
+			ln = s.Listener
+		case s.Name == "admin" && adminLn == nil:
+			adminLn = s.Listener
+		}
+	}
+	if ln == nil {
+		for _, s := range sockets {
+			if s.Listener != adminLn {
+				ln = s.Listener
+				break
+			}
+		}
+	}
+	for _, s := range sockets {
+		if s.Listener != ln && s.Listener != adminLn {
+			b.Echo.Logger.Warnf("Closing the unused socket %q passed by systemd", s.Name)
+			s.Close()
+		}
+	}
+	if ln == nil {
+		adminLn.Close()
+		return nil, nil, errors.New("no socket for the public server is passed by systemd, only `admin`")
+	}
+
+	// IMPORTANT: Nothing serves the admin socket without the admin listener, the connections would hang.
+	if adminLn != nil && b.AdminEcho == nil {
+		b.Echo.Logger.Warn("Closing the `admin` socket passed by systemd, `admin.on` is false")
+		adminLn.Close()
+		adminLn = nil
+	}
+
+	return ln, adminLn, nil
+}
+
+// closeListeners closes the listeners which are not served yet.
+func closeListeners(listeners ...net.Listener) {
+	for _, ln := range listeners {
+		if ln != nil {
+			ln.Close()
+		}
+	}
+}
+
+// shutdownTimeout returns `http.shutdownTimeout` or 30 seconds by default.
+func (b *Bean) shutdownTimeout() time.Duration {
+	if b.Config.HTTP.ShutdownTimeout > 0 {
+		return b.Config.HTTP.ShutdownTimeout
+	}
+	return 30 * time.Second
+}
+
+// shutdownWithTimeout runs the shutdown hooks within `http.shutdownTimeout`.
+func (b *Bean) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.shutdownTimeout())
+	defer cancel()
+
+	return b.Shutdown(ctx)
+}
+
 func (b *Bean) UseMiddlewares(middlewares ...echo.MiddlewareFunc) {
 	b.Echo.Use(middlewares...)
 }
@@ -524,16 +901,36 @@ func (b *Bean) InitDB() {
 	var tenantMongoDBs map[uint64]*mongo.Client
 	var tenantMongoDBNames map[uint64]string
 	var tenantRedisDBs map[uint64]*dbdrivers.RedisDBConn
+	var tenantCodes map[string]uint64
+	var tenantCfgs []*dbdrivers.TenantConnections
 	var masterMemoryDB memory.Cache
 
+	// IMPORTANT: Set it before opening any connection, the tenants opened later on included.
+	if provider := MySQLCredentials; provider != nil {
+		dbdrivers.MySQLCredentials = func(ctx context.Context, db dbdrivers.MySQLDatabase) (string, string, error) {
+			return provider.MySQLCredentials(ctx, MySQLDatabase(db))
+		}
+	}
+
 	masterMySQLDB, masterMySQLDBName = dbdrivers.InitMysqlMasterConn(b.Config.Database.MySQL)
 	masterMongoDB, masterMongoDBName = dbdrivers.InitMongoMasterConn(b.Config.Database.Mongo, blog.Logger())
 	masterRedisDB = dbdrivers.InitRedisMasterConn(b.Config.Database.Redis)
 
-	if b.Config.Database.Tenant.On {
+	if tenantCfg := b.Config.Database.Tenant; tenantCfg.On && (tenantCfg.Pool.Lazy || !tenantCfg.FailFast) {
+		// The tenants are opened one by one by `initTenants`, or on their first use in the lazy mode, so a
+		// tenant which fails to open does not take the others down.
+		tenantCfgs = dbdrivers.InitTenantCfgs(b.Config.Database.Redis, masterMySQLDB)
+	} else if b.Config.Database.Tenant.On {
 		tenantMySQLDBs, tenantMySQLDBNames = dbdrivers.InitMysqlTenantConns(b.Config.Database.MySQL, masterMySQLDB, TenantAlterDbHostParam, b.Config.Secret)
 		tenantMongoDBs, tenantMongoDBNames = dbdrivers.InitMongoTenantConns(b.Config.Database.Mongo, masterMySQLDB, TenantAlterDbHostParam, b.Config.Secret, blog.Logger())
 		tenantRedisDBs = dbdrivers.InitRedisTenantConns(b.Config.Database.Redis, masterMySQLDB, TenantAlterDbHostParam, b.Config.Secret)
+
+		// Keep the codes of the tenants to resolve them from a subdomain for example.
+		tenantCfgs = dbdrivers.GetAllTenantCfgs(masterMySQLDB)
+		tenantCodes = make(map[string]uint64, len(tenantCfgs))
+		for _, t := range tenantCfgs {
+			tenantCodes[t.Code] = t.TenantID
+		}
 	}
 
 	if b.Config.Database.Memory.On {
@@ -551,8 +948,100 @@ func (b *Bean) InitDB() {
 		TenantMongoDBNames: tenantMongoDBNames,
 		MasterRedisDB:      masterRedisDB,
 		TenantRedisDBs:     tenantRedisDBs,
+		TenantCodes:        tenantCodes,
 		MemoryDB:           masterMemoryDB,
 	}
+
+	if b.Config.Database.Tenant.On {
+		b.initTenants(tenantCfgs)
+	}
+
+	if b.Config.Database.CircuitBreaker.On {
+		b.DBConn.useDBCircuitBreakers(circuitbreaker.SettingsFromConfig(b.Config.Database.CircuitBreaker))
+	}
+
+	if b.Config.Database.Tenant.On && b.Config.Database.Tenant.Reload.On {
+		b.watchTenants()
+	}
+
+	dbConn := b.DBConn
+	b.OnShutdown("database", dbConn.Close, WithPriority(ShutdownPriorityDatabase))
+}
+
+// Close closes all the database connections. Bean calls it during the graceful shutdown if the connections
+// are initialized by `InitDB`, so call it only for the connections you initialized by yourself.
+func (deps *DBDeps) Close(ctx context.Context) error {
+	var errs []error
+
+	closeMySQL := func(db *gorm.DB) {
+		if db == nil {
+			return
+		}
+		sqlDB, err := db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil {
+			errs = append(errs, pkgerrors.Wrap(err, "failed to close mysql connection"))
+		}
+	}
+
+	closeMongo := func(client *mongo.Client) {
+		if client == nil {
+			return
+		}
+		if err := client.Disconnect(ctx); err != nil {
+			errs = append(errs, pkgerrors.Wrap(err, "failed to disconnect mongo"))
+		}
+	}
+
+	closeRedis := func(conn *dbdrivers.RedisDBConn) {
+		if conn == nil {
+			return
+		}
+		if err := conn.Close(); err != nil {
+			errs = append(errs, pkgerrors.Wrap(err, "failed to close redis connection"))
+		}
+	}
+
+	closeMySQL(deps.MasterMySQLDB)
+	closeMongo(deps.MasterMongoDB)
+	closeRedis(deps.MasterRedisDB)
+
+	// IMPORTANT: The connections of the changed, removed and evicted tenants may still wait for their delay.
+	if err := deps.closeAllPending(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, conns := range deps.Tenants().All() {
+		closeMySQL(conns.MySQLDB)
+		closeMongo(conns.MongoDB)
+		closeRedis(conns.RedisDB)
+	}
+
+	// IMPORTANT: The `Tenant*` maps keep the initial connections of the changed and removed tenants.
+	registry := deps.Tenants()
+	for id, db := range deps.TenantMySQLDBs {
+		if conns, ok := registry.Get(id); !ok || conns.MySQLDB != db {
+			closeMySQL(db)
+		}
+	}
+	for id, client := range deps.TenantMongoDBs {
+		if conns, ok := registry.Get(id); !ok || conns.MongoDB != client {
+			closeMongo(client)
+		}
+	}
+	for id, conn := range deps.TenantRedisDBs {
+		if conns, ok := registry.Get(id); !ok || conns.RedisDB != conn {
+			closeRedis(conn)
+		}
+	}
+
+	if deps.MemoryDB != nil {
+		deps.MemoryDB.CloseMemory()
+	}
+
+	return errors.Join(errs...)
 }
 
 // To clean up any bean resources before the program terminates.
@@ -565,16 +1054,13 @@ func Cleanup() {
 }
 
 // pathSkipper ignores a path based on the provided regular expressions
-// for logging or metrics data collection.
-func pathSkipper(skipPathRegexes []*regexp.Regexp) func(c echo.Context) bool {
-
-	if len(skipPathRegexes) == 0 {
-		return echomiddleware.DefaultSkipper
-	}
+// for logging or metrics data collection. The regular expressions are loaded on every request
+// so that they can be recompiled when the config file is reloaded.
+func pathSkipper(skipPathRegexes func() []*regexp.Regexp) func(c echo.Context) bool {
 
 	return func(c echo.Context) bool {
 		path := c.Request().URL.Path
-		for _, r := range skipPathRegexes {
+		for _, r := range skipPathRegexes() {
 			if r.MatchString(path) {
 				return true
 			}
@@ -4,11 +4,14 @@ package bean
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"syscall"
 	"testing"
@@ -17,9 +20,11 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/listener"
 	"github.com/retail-ai-inc/bean/v2/internal/route"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBean_UseErrorHandlerFuncs(t *testing.T) {
@@ -374,3 +379,199 @@ func setConf(t *testing.T, timeout time.Duration) func() {
 		config.Bean = originalConf
 	}
 }
+
+func TestBean_ReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		check        HealthCheckFunc
+		shuttingDown bool
+		wantStatus   int
+		wantBody     string
+	}{
+		{
+			name:       "ready",
+			check:      func(ctx context.Context) error { return nil },
+			wantStatus: http.StatusOK,
+			wantBody:   `"status":"ok"`,
+		},
+		{
+			name:       "dependency down",
+			check:      func(ctx context.Context) error { return errors.New("connection refused") },
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `"error":"connection refused"`,
+		},
+		{
+			name: "check timeout",
+			check: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `"error":"context deadline exceeded"`,
+		},
+		{
+			name:         "shutting down",
+			check:        func(ctx context.Context) error { return nil },
+			shuttingDown: true,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     `"status":"shutting_down"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bean{Echo: echo.New()}
+			b.Config.Health.Timeout = 50 * time.Millisecond
+			b.AddHealthCheck("custom", tt.check)
+			b.shuttingDown.Store(tt.shuttingDown)
+			b.Echo.GET("/readyz", b.ReadinessHandler)
+
+			code, body := request(http.MethodGet, "/readyz", b.Echo)
+			assert.Equal(t, tt.wantStatus, code)
+			assert.Contains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestBean_ServeAt_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bean.sock")
+
+	b := &Bean{
+		Echo:     echo.New(),
+		Validate: validator.New(),
+	}
+	b.Config.HTTP.UnixSocket.Path = path
+	b.Config.HTTP.UnixSocket.Mode = "0600"
+	b.Echo.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "Pong")
+	})
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- b.ServeAt("", "")
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	assert.Eventually(t, func() bool {
+		resp, err := client.Get("http://unix/")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	signalTERM(t)
+	require.NoError(t, <-srvErr)
+
+	// The socket file is removed on shutdown.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBean_ServeAt_ShutdownDelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bean.sock")
+
+	b := &Bean{
+		Echo:     echo.New(),
+		Validate: validator.New(),
+	}
+	b.Config.HTTP.UnixSocket.Path = path
+	b.Config.Health.ShutdownDelay = 500 * time.Millisecond
+	b.Echo.GET("/readyz", b.ReadinessHandler)
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- b.ServeAt("", "")
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	readiness := func() int {
+		resp, err := client.Get("http://unix/readyz")
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Eventually(t, func() bool { return readiness() == http.StatusOK }, 5*time.Second, 50*time.Millisecond)
+
+	// The readiness probe fails while the server keeps serving during the delay.
+	signalTERM(t)
+	assert.Eventually(t, func() bool { return readiness() == http.StatusServiceUnavailable }, 400*time.Millisecond,
+		10*time.Millisecond)
+
+	require.NoError(t, <-srvErr)
+}
+
+func TestBean_systemdListeners(t *testing.T) {
+	newSockets := func(t *testing.T, names ...string) []listener.Socket {
+		t.Helper()
+
+		sockets := make([]listener.Socket, 0, len(names))
+		for _, name := range names {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			t.Cleanup(func() { ln.Close() })
+			sockets = append(sockets, listener.Socket{Listener: ln, Name: name})
+		}
+		return sockets
+	}
+	closed := func(ln net.Listener) bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}
+
+	t.Run("admin on", func(t *testing.T) {
+		b := &Bean{Echo: echo.New(), AdminEcho: echo.New()}
+		sockets := newSockets(t, "admin", "myapp.socket", "other")
+
+		ln, adminLn, err := b.systemdListeners(sockets)
+		require.NoError(t, err)
+		assert.Equal(t, sockets[1].Listener, ln)
+		assert.Equal(t, sockets[0].Listener, adminLn)
+		assert.True(t, closed(sockets[2]))
+	})
+
+	t.Run("admin off", func(t *testing.T) {
+		b := &Bean{Echo: echo.New()}
+		sockets := newSockets(t, "http", "admin")
+
+		ln, adminLn, err := b.systemdListeners(sockets)
+		require.NoError(t, err)
+		assert.Equal(t, sockets[0].Listener, ln)
+		assert.Nil(t, adminLn)
+		assert.True(t, closed(sockets[1]))
+		assert.False(t, closed(ln))
+	})
+
+	t.Run("admin only", func(t *testing.T) {
+		b := &Bean{Echo: echo.New(), AdminEcho: echo.New()}
+		sockets := newSockets(t, "admin")
+
+		_, _, err := b.systemdListeners(sockets)
+		assert.Error(t, err)
+		assert.True(t, closed(sockets[0]))
+	})
+}
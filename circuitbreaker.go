@@ -0,0 +1,146 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/retail-ai-inc/bean/v2/circuitbreaker"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// The names of the circuit breaker groups of the databases. The breakers are keyed by tenant ID, or `master`.
+const (
+	CircuitBreakerMySQL = "mysql"
+	CircuitBreakerMongo = "mongo"
+	CircuitBreakerRedis = "redis"
+
+	circuitBreakerMasterKey = "master"
+)
+
+// useDBCircuitBreakers guards the MySQL queries and the redis commands with a breaker per database. The mongo
+// driver has no hook to reject a call, so the mongo calls of a tenant are guarded by `TenantConns.ExecuteMongo`,
+// and the `mongo` group is registered for `Group.Execute` on the master database.
+func (deps *DBDeps) useDBCircuitBreakers(settings circuitbreaker.Settings) {
+	deps.circuitBreakers = &settings
+	circuitBreakerGroup(CircuitBreakerMongo, settings)
+
+	useGormCircuitBreaker(deps.MasterMySQLDB, circuitBreakerMasterKey, settings)
+	useRedisCircuitBreaker(deps.MasterRedisDB, circuitBreakerMasterKey, settings)
+
+	for _, conns := range deps.Tenants().All() {
+		deps.useTenantCircuitBreakers(conns)
+	}
+}
+
+// useTenantCircuitBreakers guards the connections of a tenant, including the ones opened by `ReloadTenants`.
+func (deps *DBDeps) useTenantCircuitBreakers(conns *TenantConns) {
+	if deps.circuitBreakers == nil {
+		return
+	}
+
+	key := strconv.FormatUint(conns.ID, 10)
+	useGormCircuitBreaker(conns.MySQLDB, key, *deps.circuitBreakers)
+	useRedisCircuitBreaker(conns.RedisDB, key, *deps.circuitBreakers)
+	if conns.MongoDB != nil {
+		conns.mongoBreaker = circuitBreakerGroup(CircuitBreakerMongo, *deps.circuitBreakers).Get(key)
+	}
+}
+
+// removeTenantCircuitBreakers forgets the breakers of a removed or evicted tenant, so the groups don't keep one
+// breaker per tenant ever opened.
+func (deps *DBDeps) removeTenantCircuitBreakers(id uint64) {
+	if deps.circuitBreakers == nil {
+		return
+	}
+
+	key := strconv.FormatUint(id, 10)
+	for _, name := range []string{CircuitBreakerMySQL, CircuitBreakerMongo, CircuitBreakerRedis} {
+		if group, err := circuitbreaker.GetGroup(name); err == nil {
+			group.Remove(key)
+		}
+	}
+}
+
+// ExecuteMongo calls `fn` with the mongo database of the tenant. With `database.circuitBreaker.on`, the call goes
+// through the breaker of the tenant in the `mongo` group: it returns an `APIError` wrapping
+// `circuitbreaker.ErrOpen` without calling `fn` while the breaker is open, and the error of `fn` counts as a
+// failure.
+func (conns *TenantConns) ExecuteMongo(fn func(db *mongo.Database) error) error {
+	if conns.MongoDB == nil {
+		return fmt.Errorf("tenant %d has no mongo database", conns.ID)
+	}
+
+	db := conns.MongoDB.Database(conns.MongoDBName)
+	if conns.mongoBreaker == nil {
+		return fn(db)
+	}
+
+	return conns.mongoBreaker.Execute(func() error {
+		return fn(db)
+	})
+}
+
+func useGormCircuitBreaker(db *gorm.DB, key string, settings circuitbreaker.Settings) {
+	if db == nil {
+		return
+	}
+
+	group := circuitBreakerGroup(CircuitBreakerMySQL, settings)
+	if err := db.Use(circuitbreaker.GormPlugin(group.Get(key))); err != nil {
+		blog.Logger().Errorf("circuit breaker of mysql %s: %v", key, err)
+	}
+}
+
+func useRedisCircuitBreaker(conn *dbdrivers.RedisDBConn, key string, settings circuitbreaker.Settings) {
+	if conn == nil || conn.Primary == nil {
+		return
+	}
+
+	hook := circuitbreaker.RedisHook(circuitBreakerGroup(CircuitBreakerRedis, settings).Get(key))
+	conn.Primary.AddHook(hook)
+	for _, read := range conn.Reads {
+		read.AddHook(hook)
+	}
+}
+
+// circuitBreakerGroup returns the registered group, or registers a new one.
+func circuitBreakerGroup(name string, settings circuitbreaker.Settings) *circuitbreaker.Group {
+	if group, err := circuitbreaker.GetGroup(name); err == nil {
+		return group
+	}
+
+	group := circuitbreaker.NewGroup(name, settings)
+	if err := circuitbreaker.Register(group); err != nil {
+		// Registered concurrently.
+		if registered, err := circuitbreaker.GetGroup(name); err == nil {
+			return registered
+		}
+	}
+
+	return group
+}
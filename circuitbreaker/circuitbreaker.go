@@ -0,0 +1,360 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package circuitbreaker stops calling a degraded dependency, e.g. an upstream host or the database of a
+// tenant, instead of piling up the request goroutines until they time out. A breaker opens when the error rate
+// of its rolling window exceeds the threshold, rejects the calls while it is open and lets a few probe calls
+// through once it is half-open to decide whether to close again.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+)
+
+// State is the state of a breaker.
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+const (
+	DefaultWindow              = 10 * time.Second
+	DefaultBuckets             = 10
+	DefaultMinRequests         = 20
+	DefaultFailureRatio        = 0.5
+	DefaultOpenTimeout         = 30 * time.Second
+	DefaultHalfOpenMaxRequests = 1
+)
+
+// ErrOpen is returned, wrapped in an `APIError` with the `CIRCUIT_BREAKER_OPEN` code, by the calls rejected by a
+// breaker. Check it with `errors.Is(err, circuitbreaker.ErrOpen)`.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError tells which breaker rejected the call.
+type OpenError struct {
+	Name string
+	Key  string
+}
+
+func (e *OpenError) Error() string {
+	if e.Key == "" {
+		return "circuit breaker " + e.Name + " is open"
+	}
+	return "circuit breaker " + e.Name + " is open for " + e.Key
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Settings configures a breaker. The zero values are replaced by the defaults.
+type Settings struct {
+	// Window is the duration of the rolling window of the error rate, split in `Buckets` buckets.
+	Window  time.Duration
+	Buckets int
+	// MinRequests is the number of calls in the window before the breaker can open.
+	MinRequests int
+	// FailureRatio opens the breaker when the failed calls / all the calls of the window reach it.
+	FailureRatio float64
+	// OpenTimeout is the duration of the open state before the breaker becomes half-open.
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of successful probe calls needed to close a half-open breaker. The other
+	// calls are rejected until then.
+	HalfOpenMaxRequests int
+	// IsFailure reports whether the error of a call is a failure of the dependency. By default, every error but
+	// the canceled contexts is.
+	IsFailure func(err error) bool
+	// OnStateChange is called in a new goroutine after the state of a breaker has changed.
+	OnStateChange func(name, key string, from, to State)
+}
+
+// SettingsFromConfig converts the settings of `env.json`.
+func SettingsFromConfig(cfg config.CircuitBreaker) Settings {
+	return Settings{
+		Window:              cfg.Window,
+		Buckets:             cfg.Buckets,
+		MinRequests:         cfg.MinRequests,
+		FailureRatio:        cfg.FailureRatio,
+		OpenTimeout:         cfg.OpenTimeout,
+		HalfOpenMaxRequests: cfg.HalfOpenMaxRequests,
+	}
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.Window <= 0 {
+		s.Window = DefaultWindow
+	}
+	if s.Buckets <= 0 {
+		s.Buckets = DefaultBuckets
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = DefaultMinRequests
+	}
+	if s.FailureRatio <= 0 || s.FailureRatio > 1 {
+		s.FailureRatio = DefaultFailureRatio
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = DefaultOpenTimeout
+	}
+	if s.HalfOpenMaxRequests <= 0 {
+		s.HalfOpenMaxRequests = DefaultHalfOpenMaxRequests
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = defaultIsFailure
+	}
+	return s
+}
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+type bucket struct {
+	successes int
+	failures  int
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	name     string
+	key      string
+	settings Settings
+	now      func() time.Time
+
+	mu    sync.Mutex
+	state State
+	// generation changes with the state, so that the results of the calls allowed in a previous state are
+	// ignored.
+	generation uint64
+	buckets    []bucket
+	// current is the index of the bucket of `bucketStart`.
+	current     int
+	bucketStart time.Time
+	openedAt    time.Time
+	inFlight    int
+	successes   int
+}
+
+// New returns a closed breaker. The name and the key, e.g. `mysql` and a tenant ID, identify the breaker in the
+// errors and the metrics.
+func New(name, key string, settings Settings) *Breaker {
+	registerMetrics()
+
+	b := &Breaker{
+		name:     name,
+		key:      key,
+		settings: settings.withDefaults(),
+		now:      time.Now,
+	}
+	b.buckets = make([]bucket, b.settings.Buckets)
+	b.bucketStart = b.now()
+	setStateMetric(name, key, StateClosed)
+
+	return b
+}
+
+// Name returns the name of the breaker.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Key returns the key of the breaker.
+func (b *Breaker) Key() string {
+	return b.key
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(b.now())
+	return b.state
+}
+
+// Allow checks if a call can be made. If so, `done` must be called once with the result of the call, otherwise
+// the error is an `APIError` wrapping `ErrOpen`.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.refresh(now)
+
+	switch b.state {
+	case StateOpen:
+		return nil, b.reject()
+	case StateHalfOpen:
+		if b.inFlight+b.successes >= b.settings.HalfOpenMaxRequests {
+			return nil, b.reject()
+		}
+		b.inFlight++
+	}
+
+	generation := b.generation
+	var once sync.Once
+
+	return func(err error) {
+		once.Do(func() {
+			b.done(generation, b.settings.IsFailure(err))
+		})
+	}, nil
+}
+
+// Execute calls `fn` if the breaker allows it and records its result.
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	done(err)
+
+	return err
+}
+
+func (b *Breaker) reject() error {
+	rejectedTotal.WithLabelValues(b.name, b.key).Inc()
+	return berror.NewIgnorableAPIError(http.StatusServiceUnavailable, berror.CIRCUIT_BREAKER_OPEN,
+		&OpenError{Name: b.name, Key: b.key})
+}
+
+func (b *Breaker) done(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.refresh(now)
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		if failed {
+			b.buckets[b.current].failures++
+		} else {
+			b.buckets[b.current].successes++
+		}
+
+		var successes, failures int
+		for _, bk := range b.buckets {
+			successes += bk.successes
+			failures += bk.failures
+		}
+		total := successes + failures
+		if total >= b.settings.MinRequests && float64(failures)/float64(total) >= b.settings.FailureRatio {
+			b.setState(StateOpen, now)
+		}
+
+	case StateHalfOpen:
+		b.inFlight--
+		if failed {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenMaxRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// refresh rolls the window and moves an open breaker to half-open after `OpenTimeout`.
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen && !now.Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+		b.setState(StateHalfOpen, now)
+	}
+
+	if b.state != StateClosed {
+		return
+	}
+
+	width := b.settings.Window / time.Duration(b.settings.Buckets)
+	elapsed := now.Sub(b.bucketStart) / width
+	if elapsed <= 0 {
+		return
+	}
+	b.bucketStart = b.bucketStart.Add(elapsed * width)
+
+	if elapsed > time.Duration(len(b.buckets)) {
+		elapsed = time.Duration(len(b.buckets))
+	}
+	for i := time.Duration(0); i < elapsed; i++ {
+		b.current = (b.current + 1) % len(b.buckets)
+		b.buckets[b.current] = bucket{}
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	if from == state {
+		return
+	}
+
+	b.state = state
+	b.generation++
+	b.inFlight = 0
+	b.successes = 0
+
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+		b.bucketStart = now
+	}
+
+	setStateMetric(b.name, b.key, state)
+	stateChangesTotal.WithLabelValues(b.name, b.key, state.String()).Inc()
+
+	if b.settings.OnStateChange != nil {
+		// IMPORTANT: Do not hold the lock in the user's callback.
+		go b.settings.OnStateChange(b.name, b.key, from, state)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+var errTest = errors.New("test")
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestBreaker(key string) (*Breaker, *clock) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := New("test", key, Settings{
+		Window:              10 * time.Second,
+		Buckets:             10,
+		MinRequests:         4,
+		FailureRatio:        0.5,
+		OpenTimeout:         5 * time.Second,
+		HalfOpenMaxRequests: 2,
+	})
+	b.now = c.Now
+	b.bucketStart = c.now
+
+	return b, c
+}
+
+func TestBreaker(t *testing.T) {
+	b, c := newTestBreaker("states")
+	rejected := testutil.ToFloat64(rejectedTotal.WithLabelValues("test", "states"))
+
+	fail := func() error { return errTest }
+	ok := func() error { return nil }
+
+	// Not enough requests to open.
+	assert.ErrorIs(t, b.Execute(fail), errTest)
+	assert.ErrorIs(t, b.Execute(fail), errTest)
+	assert.NoError(t, b.Execute(ok))
+	assert.Equal(t, StateClosed, b.State())
+
+	// 3 failures out of 4.
+	assert.ErrorIs(t, b.Execute(fail), errTest)
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, 2.0, testutil.ToFloat64(stateGauge.WithLabelValues("test", "states")))
+
+	var called bool
+	err := b.Execute(func() error { called = true; return nil })
+	assert.False(t, called)
+	assert.ErrorIs(t, err, ErrOpen)
+
+	var apiErr *berror.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.HTTPStatusCode)
+	assert.Equal(t, berror.CIRCUIT_BREAKER_OPEN, apiErr.GlobalErrCode)
+	assert.True(t, apiErr.Ignorable)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(rejectedTotal.WithLabelValues("test", "states")))
+
+	// Half-open lets 2 probes through.
+	c.now = c.now.Add(5 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(nil)
+	assert.Equal(t, StateClosed, b.State())
+
+	// A failed probe opens it again.
+	for i := 0; i < 4; i++ {
+		_ = b.Execute(fail)
+	}
+	require.Equal(t, StateOpen, b.State())
+	c.now = c.now.Add(5 * time.Second)
+	assert.ErrorIs(t, b.Execute(fail), errTest)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreaker_RollingWindow(t *testing.T) {
+	b, c := newTestBreaker("window")
+
+	for i := 0; i < 3; i++ {
+		_ = b.Execute(func() error { return errTest })
+	}
+
+	// The failures leave the window.
+	c.now = c.now.Add(11 * time.Second)
+	_ = b.Execute(func() error { return errTest })
+	assert.Equal(t, StateClosed, b.State())
+
+	// The canceled calls are not failures.
+	for i := 0; i < 4; i++ {
+		_ = b.Execute(func() error { return context.Canceled })
+	}
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestGroup(t *testing.T) {
+	t.Cleanup(UnregisterAll)
+
+	g := NewGroup("group", Settings{MinRequests: 1})
+	assert.Same(t, g.Get("1"), g.Get("1"))
+
+	assert.ErrorIs(t, g.Execute("1", func() error { return errTest }), errTest)
+	assert.ErrorIs(t, g.Execute("1", func() error { return nil }), ErrOpen)
+	assert.NoError(t, g.Execute("2", func() error { return nil }))
+	assert.Equal(t, map[string]State{"1": StateOpen, "2": StateClosed}, g.States())
+
+	g.Remove("1")
+	assert.Equal(t, map[string]State{"2": StateClosed}, g.States())
+	assert.Equal(t, StateClosed, g.Get("1").State())
+
+	require.NoError(t, Register(g))
+	assert.Error(t, Register(g))
+	got, err := GetGroup("group")
+	require.NoError(t, err)
+	assert.Same(t, g, got)
+	assert.Equal(t, []string{"group"}, Groups())
+}
+
+func TestTransport(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Transport(NewGroup("http", Settings{MinRequests: 2}), nil)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	_, err := client.Get(srv.URL)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRedisHook(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	b := New("redis", "hook", Settings{MinRequests: 2, FailureRatio: 0.4})
+	client.AddHook(RedisHook(b))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, client.Get(ctx, "missing").Err(), redis.Nil)
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	s.Close()
+	for i := 0; i < 2; i++ {
+		assert.Error(t, client.Get(ctx, "key").Err())
+	}
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, client.Get(ctx, "key").Err(), ErrOpen)
+
+	_, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Get(ctx, "key")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrOpen)
+}
+
+func TestGormPlugin(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:1)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	b := New("mysql", "gorm", Settings{MinRequests: 2})
+	require.NoError(t, db.Use(GormPlugin(b)))
+
+	// Simulate the database.
+	var failing, queries atomic.Int32
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		queries.Add(1)
+		if failing.Load() == 1 {
+			_ = db.AddError(errTest)
+		} else if db.Statement.Table == "users" {
+			_ = db.AddError(gorm.ErrRecordNotFound)
+		}
+	}))
+
+	type user struct {
+		ID   uint
+		Name string
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, db.First(&user{}).Error, gorm.ErrRecordNotFound)
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	failing.Store(1)
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, db.Find(&[]user{}).Error, errTest)
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	assert.ErrorIs(t, db.Find(&[]user{}).Error, ErrOpen)
+	assert.Equal(t, int32(4), queries.Load())
+}
@@ -0,0 +1,115 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package circuitbreaker
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const gormDoneKey = "circuitbreaker:done"
+
+type gormPlugin struct {
+	breaker *Breaker
+}
+
+// GormPlugin returns a plugin which guards the queries of a gorm database, e.g.
+// `db.Use(circuitbreaker.GormPlugin(b))`. `gorm.ErrRecordNotFound` is not a failure.
+func GormPlugin(b *Breaker) gorm.Plugin {
+	return &gormPlugin{breaker: b}
+}
+
+func (p *gormPlugin) Name() string {
+	return "circuitbreaker"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register("circuitbreaker:before_create", p.before); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("circuitbreaker:after_create", p.after); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("circuitbreaker:before_query", p.before); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("circuitbreaker:after_query", p.after); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("circuitbreaker:before_update", p.before); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("circuitbreaker:after_update", p.after); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("circuitbreaker:before_delete", p.before); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("circuitbreaker:after_delete", p.after); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("circuitbreaker:before_row", p.before); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("circuitbreaker:after_row", p.after); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("circuitbreaker:before_raw", p.before); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("circuitbreaker:after_raw", p.after)
+}
+
+func (p *gormPlugin) before(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	done, err := p.breaker.Allow()
+	if err != nil {
+		// The query is skipped by gorm as the statement has an error.
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(gormDoneKey, done)
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormDoneKey)
+	if !ok {
+		return
+	}
+	done, ok := v.(func(error))
+	if !ok {
+		return
+	}
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	done(err)
+}
@@ -0,0 +1,164 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Group holds a breaker per key, e.g. per tenant ID or per host, created on first use.
+type Group struct {
+	name     string
+	settings Settings
+
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// NewGroup returns a group whose breakers share the name and the settings.
+func NewGroup(name string, settings Settings) *Group {
+	return &Group{
+		name:     name,
+		settings: settings,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Get returns the breaker of the key.
+func (g *Group) Get(key string) *Breaker {
+	g.mu.RLock()
+	b, ok := g.breakers[key]
+	g.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b, ok := g.breakers[key]; ok {
+		return b
+	}
+	b = New(g.name, key, g.settings)
+	g.breakers[key] = b
+
+	return b
+}
+
+// Remove forgets the breaker of the key and its metrics, e.g. when a tenant is removed. The next `Get` returns a
+// new closed breaker.
+func (g *Group) Remove(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.breakers[key]; !ok {
+		return
+	}
+	delete(g.breakers, key)
+	deleteMetrics(g.name, key)
+}
+
+// Execute calls `fn` if the breaker of the key allows it and records its result.
+func (g *Group) Execute(key string, fn func() error) error {
+	return g.Get(key).Execute(fn)
+}
+
+// States returns the state of every breaker by key.
+func (g *Group) States() map[string]State {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	states := make(map[string]State, len(g.breakers))
+	for key, b := range g.breakers {
+		states[key] = b.State()
+	}
+
+	return states
+}
+
+var (
+	groupsMu sync.RWMutex
+	groups   = make(map[string]*Group)
+)
+
+// Register makes a group available by its name. If Register is called twice with the same name or if group is
+// nil, it returns error.
+func Register(group *Group) error {
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+
+	if group == nil {
+		return errors.New("circuitbreaker: Register group is nil")
+	}
+
+	if _, dup := groups[group.name]; dup {
+		return errors.New("circuitbreaker: Register called twice for group " + group.name)
+	}
+
+	groups[group.name] = group
+	return nil
+}
+
+// GetGroup returns the group registered by the name, e.g. `mongo` once `InitDB` has been called with
+// `database.circuitBreaker.on`.
+func GetGroup(name string) (*Group, error) {
+	groupsMu.RLock()
+	group, ok := groups[name]
+	groupsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("circuitbreaker: unknown group name %q", name)
+	}
+
+	return group, nil
+}
+
+// Groups returns the sorted names of the registered groups.
+func Groups() []string {
+	groupsMu.RLock()
+	defer groupsMu.RUnlock()
+
+	list := make([]string, 0, len(groups))
+	for name := range groups {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// UnregisterAll removes all the registered groups.
+func UnregisterAll() {
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+
+	groups = make(map[string]*Group)
+}
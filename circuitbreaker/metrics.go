@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "state",
+		Help:      "The state of the circuit breakers: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name", "key"})
+
+	stateChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "state_changes_total",
+		Help:      "How many times the circuit breakers changed to a state.",
+	}, []string{"name", "key", "state"})
+
+	rejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "rejected_total",
+		Help:      "How many calls rejected by the circuit breakers.",
+	}, []string{"name", "key"})
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers the metrics to the default prometheus registry, which is exposed on `/metrics`.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		for _, c := range []prometheus.Collector{stateGauge, stateChangesTotal, rejectedTotal} {
+			if err := prometheus.Register(c); err != nil {
+				var are prometheus.AlreadyRegisteredError
+				if !errors.As(err, &are) {
+					panic(err)
+				}
+			}
+		}
+	})
+}
+
+func setStateMetric(name, key string, state State) {
+	stateGauge.WithLabelValues(name, key).Set(float64(state))
+}
+
+// deleteMetrics drops the series of a breaker, so the removed keys do not linger.
+func deleteMetrics(name, key string) {
+	stateGauge.DeleteLabelValues(name, key)
+	rejectedTotal.DeleteLabelValues(name, key)
+	stateChangesTotal.DeletePartialMatch(prometheus.Labels{"name": name, "key": key})
+}
@@ -0,0 +1,89 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisDoneKey struct{}
+
+type redisHook struct {
+	breaker *Breaker
+}
+
+// RedisHook returns a hook which guards the commands of a redis client, e.g.
+// `conn.Primary.AddHook(circuitbreaker.RedisHook(b))`. `redis.Nil` is not a failure.
+func RedisHook(b *Breaker) redis.Hook {
+	return &redisHook{breaker: b}
+}
+
+func (h *redisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx, cmd.Err())
+	return nil
+}
+
+func (h *redisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return h.before(ctx)
+}
+
+func (h *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+			err = cmdErr
+			break
+		}
+	}
+	h.after(ctx, err)
+	return nil
+}
+
+func (h *redisHook) before(ctx context.Context) (context.Context, error) {
+	done, err := h.breaker.Allow()
+	if err != nil {
+		return ctx, err
+	}
+
+	return context.WithValue(ctx, redisDoneKey{}, done), nil
+}
+
+// after records the result. The rejected commands have no `done` in their context.
+func (h *redisHook) after(ctx context.Context, err error) {
+	done, ok := ctx.Value(redisDoneKey{}).(func(error))
+	if !ok {
+		return
+	}
+
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	done(err)
+}
@@ -0,0 +1,54 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/retail-ai-inc/bean/v2/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTenantConns_ExecuteMongo(t *testing.T) {
+	t.Cleanup(circuitbreaker.UnregisterAll)
+
+	// The client does not dial until the first call.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+
+	deps := &DBDeps{circuitBreakers: &circuitbreaker.Settings{MinRequests: 1}}
+	conns := &TenantConns{ID: 7, MongoDB: client, MongoDBName: "tenant_7"}
+	deps.useTenantCircuitBreakers(conns)
+
+	fail := errors.New("server selection timeout")
+	err = conns.ExecuteMongo(func(db *mongo.Database) error {
+		assert.Equal(t, "tenant_7", db.Name())
+		return fail
+	})
+	assert.ErrorIs(t, err, fail)
+
+	called := false
+	err = conns.ExecuteMongo(func(db *mongo.Database) error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, circuitbreaker.ErrOpen)
+	assert.False(t, called)
+
+	group, err := circuitbreaker.GetGroup(CircuitBreakerMongo)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]circuitbreaker.State{"7": circuitbreaker.StateOpen}, group.States())
+
+	// The breakers of a removed tenant are forgotten.
+	deps.removeTenantCircuitBreakers(7)
+	assert.Empty(t, group.States())
+
+	assert.EqualError(t, (&TenantConns{ID: 8}).ExecuteMongo(func(*mongo.Database) error { return nil }),
+		"tenant 8 has no mongo database")
+}
@@ -0,0 +1,160 @@
+{{ .Copyright }}
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/retail-ai-inc/bean/v2"
+	"github.com/retail-ai-inc/bean/v2/featureflag"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// flagCmd represents the `flag` command.
+	flagCmd = &cobra.Command{
+		Use:   "flag [command]",
+		Short: "List and toggle the feature flags.",
+		Long:  `This command requires a sub command parameter. The flags can be toggled only if featureFlags.source is mysql in env.json.`,
+	}
+)
+
+var (
+	// flagListCmd represents the `flag list` command.
+	flagListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Display the feature flags.",
+		Args:  cobra.ExactArgs(0),
+		Run:   flagList,
+	}
+
+	// flagEnableCmd represents the `flag enable` command.
+	flagEnableCmd = &cobra.Command{
+		Use:   "enable <name>",
+		Short: "Enable a feature flag for every tenant, or for one tenant with --tenant.",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { flagToggle(args[0], true) },
+	}
+
+	// flagDisableCmd represents the `flag disable` command.
+	flagDisableCmd = &cobra.Command{
+		Use:   "disable <name>",
+		Short: "Disable a feature flag for every tenant, or for one tenant with --tenant.",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { flagToggle(args[0], false) },
+	}
+
+	// flagRolloutCmd represents the `flag rollout` command.
+	flagRolloutCmd = &cobra.Command{
+		Use:   "rollout <name> <percentage>",
+		Short: "Enable a feature flag for a percentage of the tenants.",
+		Args:  cobra.ExactArgs(2),
+		Run:   flagRollout,
+	}
+)
+
+var (
+	flagTenantID     string
+	isFlagJsonOutput bool
+)
+
+func init() {
+	flagListCmd.Flags().BoolVarP(&isFlagJsonOutput, "json", "j", false, "will ouput the result in json")
+	flagEnableCmd.Flags().StringVarP(&flagTenantID, "tenant", "t", "", "the tenant ID to override the flag for")
+	flagDisableCmd.Flags().StringVarP(&flagTenantID, "tenant", "t", "", "the tenant ID to override the flag for")
+
+	flagCmd.AddCommand(flagListCmd, flagEnableCmd, flagDisableCmd, flagRolloutCmd)
+	rootCmd.AddCommand(flagCmd)
+}
+
+func initFeatureFlags() *featureflag.Service {
+	// Create a bean object
+	b := bean.New()
+	b.InitDB()
+
+	if err := b.InitFeatureFlags(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return b.FeatureFlags
+}
+
+func flagList(cmd *cobra.Command, args []string) {
+	flags := initFeatureFlags().Flags()
+
+	if isFlagJsonOutput {
+		jsonInByte, _ := json.Marshal(flags)
+		fmt.Println(string(jsonInByte))
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Enabled", "Percentage", "Tenants", "Description"})
+
+	for _, f := range flags {
+		tenants := make([]string, 0, len(f.Tenants))
+		for tenantID, enabled := range f.Tenants {
+			tenants = append(tenants, tenantID+"="+strconv.FormatBool(enabled))
+		}
+		sort.Strings(tenants)
+
+		table.Append([]string{f.Name, strconv.FormatBool(f.Enabled), strconv.Itoa(f.Percentage), strings.Join(tenants, ", "), f.Description})
+	}
+
+	table.Render()
+}
+
+func flagToggle(name string, enabled bool) {
+	flags := initFeatureFlags()
+
+	// A new flag is created if it does not exist yet.
+	f, ok := flags.Flag(name)
+	if !ok {
+		f = featureflag.Flag{Name: name}
+	}
+
+	if flagTenantID != "" {
+		if f.Tenants == nil {
+			f.Tenants = make(map[string]bool)
+		}
+		f.Tenants[flagTenantID] = enabled
+	} else {
+		f.Enabled = enabled
+	}
+
+	saveFlag(flags, f)
+}
+
+func flagRollout(cmd *cobra.Command, args []string) {
+	percentage, err := strconv.Atoi(args[1])
+	if err != nil || percentage < 0 || percentage > 100 {
+		fmt.Println("the percentage must be between 0 and 100")
+		os.Exit(1)
+	}
+
+	flags := initFeatureFlags()
+
+	f, ok := flags.Flag(args[0])
+	if !ok {
+		f = featureflag.Flag{Name: args[0]}
+	}
+	f.Percentage = percentage
+
+	saveFlag(flags, f)
+}
+
+func saveFlag(flags *featureflag.Service, f featureflag.Flag) {
+	if err := flags.Save(context.Background(), f); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: enabled=%t percentage=%d tenants=%v\n", f.Name, f.Enabled, f.Percentage, f.Tenants)
+}
@@ -2,6 +2,13 @@
 package commands
 
 import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
 	"{{ .PkgPath }}/middlewares"
 	"{{ .PkgPath }}/routers"
@@ -11,6 +18,7 @@ import (
 	"github.com/retail-ai-inc/bean/v2"
 	berror "github.com/retail-ai-inc/bean/v2/error"
 	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/queue"
 	"github.com/spf13/cobra"
 )
 
@@ -103,16 +111,40 @@ func start(cmd *cobra.Command, args []string) {
 	}
 
 	if startQueue && startWeb {
-		// Start both web and worker pool
-		go func() {
-			// TODO: start the queue
-		}()
+		// Start both web and worker pool. The worker stops before bean closes the database connections.
+		workerCtx, stopWorker := context.WithCancel(context.Background())
+		workerDone := make(chan error, 1)
+		var workerStarted atomic.Bool
+		b.OnStart("queue", func(ctx context.Context) error {
+			// IMPORTANT: The start hooks run after `BeforeServe` initialized the database connections.
+			worker := newWorker(b)
+			go func() {
+				workerDone <- worker.Run(workerCtx)
+			}()
+			workerStarted.Store(true)
+			return nil
+		})
+		b.OnShutdown("queue", func(ctx context.Context) error {
+			stopWorker()
+			if !workerStarted.Load() {
+				return nil
+			}
+			select {
+			case err := <-workerDone:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
 		if err := b.ServeAt(host, port); err != nil {
 			log.Fatalf("Failed to start the service: %v", err)
 		}
 	} else if startQueue && !startWeb {
 		// Only start worker pool
-		// TODO: start the queue
+		b.InitDB()
+		if err := startWorker(b); err != nil {
+			log.Fatalf("Failed to start the queue worker: %v", err)
+		}
 	} else {
 		// Only start the web
 		if err := b.ServeAt(host, port); err != nil {
@@ -120,3 +152,30 @@ func start(cmd *cobra.Command, args []string) {
 		}
 	}
 }
+
+// newWorker creates the worker of the job queues configured under `queue` in env.json.
+// The database connections must be initialized before the worker runs.
+func newWorker(b *bean.Bean) *queue.Worker {
+	worker := queue.NewWorker(b.DBConn.MasterRedisDB)
+
+	// Register your job handlers here, for example:
+	// queue.Register(worker, "send_mail", func(ctx context.Context, payload SendMailPayload) error {
+	// 	return nil
+	// })
+
+	return worker
+}
+
+// startWorker consumes the job queues until the process receives SIGINT or SIGTERM, then it waits
+// for the in-flight jobs to finish and releases the resources of bean.
+func startWorker(b *bean.Bean) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := newWorker(b).Run(ctx)
+
+	sdnCtx, cancel := context.WithTimeout(context.Background(), b.Config.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	return errors.Join(err, b.Shutdown(sdnCtx))
+}
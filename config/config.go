@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -11,13 +12,30 @@ import (
 )
 
 // Hold the useful configuration settings of bean so that we can use it quickly from anywhere.
+//
+// IMPORTANT: It is the configuration loaded by `LoadConfig` and it is never replaced by `WatchConfig`, so it
+// can be read from any goroutine without synchronization. Read the settings which are reloaded at runtime
+// with `Current`, or apply them in an `OnChange` subscriber.
 var Bean *Config
 
+// current is the configuration reloaded by `WatchConfig`, nil until the first reload.
+var current atomic.Pointer[Config]
+
+// Current returns the latest configuration, the one reloaded by `WatchConfig` or `Bean` until the first reload.
+// It is the source of truth of the hot reloaded settings and is safe for concurrent use. Don't modify it.
+func Current() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return Bean
+}
+
 type Config struct {
 	ProjectName  string
 	Environment  string
 	DebugLogPath string
 	Secret       string
+	HotReload    bool
 	AccessLog    struct {
 		On                bool
 		BodyDump          bool
@@ -86,13 +104,21 @@ type Config struct {
 		}
 		KeepAlive     bool
 		AllowedMethod []string
+		CORS          CORS
 		SSL           struct {
 			On            bool
 			CertFile      string
 			PrivFile      string
 			MinTLSVersion uint16
+			ClientCAFile  string
+			ClientAuth    string
 		}
 		ShutdownTimeout time.Duration
+		UnixSocket      struct {
+			Path string
+			Mode string
+		}
+		SocketActivation bool
 	}
 	NetHttpFastTransporter struct {
 		On                  bool
@@ -105,14 +131,35 @@ type Config struct {
 	HTML struct {
 		ViewsTemplateCache bool
 	}
+	Admin struct {
+		On              bool
+		Host            string
+		Port            string
+		AuthBearerToken string
+		Pprof           bool
+	}
+	Health struct {
+		On            bool
+		LivenessPath  string
+		ReadinessPath string
+		Timeout       time.Duration
+		CheckTenants  bool
+		ShutdownDelay time.Duration
+	}
 	Database struct {
 		Tenant struct {
-			On bool
+			On       bool
+			Resolver TenantResolver
+			Reload   TenantReload
+			Pool     TenantPool
+			FailFast bool
+			Retry    TenantRetry
 		}
-		MySQL  dbdrivers.SQLConfig
-		Mongo  dbdrivers.MongoConfig
-		Redis  dbdrivers.RedisConfig
-		Memory dbdrivers.MemoryConfig
+		MySQL          dbdrivers.SQLConfig
+		Mongo          dbdrivers.MongoConfig
+		Redis          dbdrivers.RedisConfig
+		Memory         dbdrivers.MemoryConfig
+		CircuitBreaker CircuitBreaker
 	}
 	Sentry   Sentry
 	Security struct {
@@ -131,6 +178,13 @@ type Config struct {
 		Size       *int
 		BlockAfter *int
 	}
+	Queue        Queue
+	RateLimit    RateLimit
+	Maintenance  Maintenance
+	HTTPClients  []HTTPClient
+	Idempotency  Idempotency
+	HTTPCache    HTTPCache
+	FeatureFlags FeatureFlags
 }
 
 type Sentry struct {
@@ -145,8 +199,241 @@ type Sentry struct {
 	ConfigureScope      func(scope *sentry.Scope)
 }
 
+// CORS holds the default CORS policy and the policies of the route groups. The allowed methods come from
+// `http.allowedMethod`.
+type CORS struct {
+	CORSPolicy `mapstructure:",squash"`
+	Groups     []CORSGroup
+}
+
+// CORSGroup replaces the default CORS policy for the paths under `PathPrefix`, e.g. `/api/public`.
+type CORSGroup struct {
+	PathPrefix string
+	CORSPolicy `mapstructure:",squash"`
+}
+
+type CORSPolicy struct {
+	AllowOrigins     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// RateLimit holds the settings of the rate limiting middleware (`ratelimit` package).
+type RateLimit struct {
+	On           bool
+	Store        string
+	Prefix       string
+	KeyBy        string
+	APIKeyHeader string
+	FailOpen     bool
+	Default      RateLimitRule
+	Routes       []RateLimitRoute
+	Tenants      []RateLimitTenant
+}
+
+// RateLimitRule allows `Limit` requests per `Period`. The token bucket allows bursts up to `Burst` requests.
+type RateLimitRule struct {
+	Algorithm string
+	Limit     int
+	Period    time.Duration
+	Burst     int
+}
+
+// RateLimitRoute overrides the default rule for a route pattern, e.g. `/users/:id`.
+type RateLimitRoute struct {
+	Method        string
+	Path          string
+	KeyBy         string
+	RateLimitRule `mapstructure:",squash"`
+}
+
+// RateLimitTenant is the quota of a tenant, it replaces the default and route rules for the tenant.
+type RateLimitTenant struct {
+	TenantID      string
+	RateLimitRule `mapstructure:",squash"`
+}
+
+// Maintenance holds the settings of the maintenance mode middleware (`maintenance` package). `On` adds the
+// middleware and `Active` puts the service in maintenance.
+type Maintenance struct {
+	On           bool
+	Active       bool
+	RedisKey     string
+	CacheTTL     time.Duration
+	AllowIPs     []string
+	BypassHeader string
+	BypassSecret string
+	RetryAfter   time.Duration
+	HTMLFile     string
+	API          struct {
+		EndPoint        string
+		AuthBearerToken string
+	}
+}
+
+// Idempotency holds the settings of the `Idempotency-Key` middleware (`idempotency` package). The first response
+// to a key is replayed for `TTL`.
+type Idempotency struct {
+	On           bool
+	Header       string
+	Prefix       string
+	TTL          time.Duration
+	LockTTL      time.Duration
+	Methods      []string
+	Paths        []string
+	APIKeyHeader string
+}
+
+// HTTPCache holds the settings of the response cache middleware (`httpcache` package). Only the `GET` requests of
+// the `Routes` are cached.
+type HTTPCache struct {
+	On           bool
+	Store        string
+	Prefix       string
+	TTL          time.Duration
+	VaryHeaders  []string
+	TenantHeader string
+	Routes       []HTTPCacheRoute
+}
+
+// HTTPCacheRoute caches the responses of a route pattern, e.g. `/products/:id`. `TTL` and `VaryHeaders` override the
+// defaults.
+type HTTPCacheRoute struct {
+	Path        string
+	TTL         time.Duration
+	VaryHeaders []string
+}
+
+// TenantResolver holds the settings of the tenant middleware (`tenant` package). The tenant is resolved from the
+// first of `Sources` (`header`, `jwt`, `subdomain` or `param`) which has a value, either a tenant ID or a tenant
+// code of `TenantConnections`.
+type TenantResolver struct {
+	On        bool
+	Sources   []string
+	Header    string
+	Claim     string
+	Param     string
+	Domain    string
+	Required  bool
+	SkipPaths []string
+}
+
+// TenantReload holds the settings of the runtime reload of the tenants of `TenantConnections`. The reload runs
+// every `Interval` and whenever a message is published on the redis `Channel`. The connections of a changed or
+// deleted tenant are closed after `CloseDelay`, to let the in-flight requests finish.
+type TenantReload struct {
+	On         bool
+	Interval   time.Duration
+	Channel    string
+	CloseDelay time.Duration
+	API        struct {
+		EndPoint        string
+		AuthBearerToken string
+	}
+}
+
+// TenantPool opens the connections of a tenant on its first use if `Lazy`, instead of at startup. At most
+// `MaxOpen` tenants (0 for no limit) keep their connections open, the least recently used ones are closed first,
+// and the connections unused for `IdleTimeout` are closed too. The evicted connections are closed after
+// `CloseDelay`, or right away if they would exceed `MaxOpen`.
+type TenantPool struct {
+	Lazy        bool
+	MaxOpen     int
+	IdleTimeout time.Duration
+	CloseDelay  time.Duration
+}
+
+// TenantRetry sets the jittered exponential backoff between `MinBackoff` and `MaxBackoff` of the retries of a
+// tenant whose connections could not be opened.
+type TenantRetry struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// FeatureFlags holds the settings of the feature flags (`featureflag` package). The definitions come from `Flags`
+// if `Source` is `config`, or from the `FeatureFlags` table of the master MySQL database if it is `mysql`. Every
+// instance evaluates the flags locally from a snapshot which is refreshed from redis every `RefreshInterval`.
+type FeatureFlags struct {
+	On              bool
+	Source          string
+	RedisKey        string
+	RefreshInterval time.Duration
+	TenantHeader    string
+	Flags           []FeatureFlag
+}
+
+// FeatureFlag is on for every tenant if `Enabled`, otherwise for `Percentage` percent of the tenants. `Tenants`
+// overrides both per tenant ID.
+type FeatureFlag struct {
+	Name        string
+	Description string
+	Enabled     bool
+	Percentage  int
+	Tenants     map[string]bool
+}
+
+// HTTPClient holds the settings of a named outgoing HTTP client (`httpclient` package). `Timeout` applies to
+// every attempt and the retries wait for a jittered exponential backoff between `RetryMinBackoff` and
+// `RetryMaxBackoff`.
+type HTTPClient struct {
+	Name                  string
+	BaseURL               string
+	Headers               map[string]string
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	RetryCount            int
+	RetryMinBackoff       time.Duration
+	RetryMaxBackoff       time.Duration
+	RetryOnStatus         []int
+	RetryNonIdempotent    bool
+	CircuitBreaker        CircuitBreaker
+}
+
+// CircuitBreaker holds the settings of the circuit breakers (`circuitbreaker` package). A breaker opens when
+// `FailureRatio` of at least `MinRequests` calls in the last `Window` failed, and lets a probe call through
+// after `OpenTimeout`.
+type CircuitBreaker struct {
+	On                  bool
+	Window              time.Duration
+	Buckets             int
+	MinRequests         int
+	FailureRatio        float64
+	OpenTimeout         time.Duration
+	HalfOpenMaxRequests int
+}
+
+// Queue holds the default settings of the redis backed job queue (`queue` package).
+type Queue struct {
+	Prefix            string
+	Queues            []string
+	Pool              string
+	Concurrency       int
+	MaxRetry          *int
+	PollInterval      time.Duration
+	VisibilityTimeout time.Duration
+	RetryMinBackoff   time.Duration
+	RetryMaxBackoff   time.Duration
+	ShutdownTimeout   time.Duration
+}
+
 // LoadConfig parses a given config file into global Bean variable.
-func LoadConfig(filename string) (*Config, error) {
+//
+// The config is built in layers, later layers override earlier ones:
+//  1. The given config file, e.g. `env.json`.
+//  2. `<name>.<environment><ext>` next to it if it exists, e.g. `env.staging.json`.
+//  3. The `overlays` files in order.
+//  4. Environment variables with `EnvPrefix`, e.g. `BEAN_HTTP_PORT`.
+//
+// Finally, `${ENV_VAR}` and `file:///run/secrets/x` references in the values are resolved.
+func LoadConfig(filename string, overlays ...string) (*Config, error) {
 
 	ext := filepath.Ext(filename)
 	if ext == "" {
@@ -160,19 +447,33 @@ func LoadConfig(filename string) (*Config, error) {
 	path := filepath.Dir(absPath)
 	name := filepath.Base(filename[:len(filename)-len(ext)])
 
-	viper.AddConfigPath(path)
+	viper.SetConfigFile(absPath)
 	viper.SetConfigType(ext[1:])
-	viper.SetConfigName(name)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading config file, %s", err)
 	}
 
-	Bean = &Config{}
-	if err := viper.Unmarshal(Bean); err != nil {
+	setupEnv()
+
+	overlayFiles, err = resolveOverlays(path, name, ext, overlays)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mergeOverlays(); err != nil {
+		return nil, err
+	}
+
+	current.Store(nil)
+	customValues.Store(nil)
+
+	cfg := &Config{}
+	if err := decode(cfg); err != nil {
 		Bean = nil
-		return nil, fmt.Errorf("unable to decode into struct, %v", err)
+		return nil, err
 	}
 
+	Bean = cfg
 	return Bean, nil
 }
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestWatchConfig_OnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json")
+	writeConfig(t, path, `{"projectName": "bean", "hotReload": true, "sentry": {"tracesSampleRate": 0.1}}`)
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, cfg.Sentry.TracesSampleRate)
+
+	changed := make(chan [2]*Config, 1)
+	OnChange(func(old, new *Config) {
+		select {
+		case changed <- [2]*Config{old, new}:
+		default:
+		}
+	})
+	WatchConfig()
+
+	// IMPORTANT: Replace the file atomically, the watcher may read a half written file otherwise.
+	tmp := path + ".tmp"
+	writeConfig(t, tmp, `{"projectName": "bean", "hotReload": true, "sentry": {"tracesSampleRate": 0.5}}`)
+	require.NoError(t, os.Rename(tmp, path))
+
+	select {
+	case cfgs := <-changed:
+		assert.Equal(t, 0.1, cfgs[0].Sentry.TracesSampleRate)
+		assert.Equal(t, 0.5, cfgs[1].Sentry.TracesSampleRate)
+		assert.Same(t, cfgs[1], Current())
+		assert.Equal(t, 0.1, Bean.Sentry.TracesSampleRate)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not notified")
+	}
+}
+
+func TestLoadConfig_Overrides(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_password")
+	writeConfig(t, secret, "s3cret\n")
+	writeConfig(t, filepath.Join(dir, "env.json"), `{
+		"projectName": "bean",
+		"environment": "local",
+		"http": {"port": "8888", "host": "${BEAN_TEST_HOST:-localhost}"},
+		"database": {"mysql": {"master": {"password": "file://`+secret+`"}}}
+	}`)
+	writeConfig(t, filepath.Join(dir, "env.staging.json"), `{"http": {"port": "9999"}, "secret": "${BEAN_TEST_SECRET}"}`)
+
+	t.Setenv("BEAN_ENVIRONMENT", "staging")
+	t.Setenv("BEAN_TEST_SECRET", "from-env")
+	t.Setenv("BEAN_PROJECTNAME", "overridden")
+	t.Setenv("BEAN_DATABASE_MYSQL_MASTER_USERNAME", "root")
+
+	cfg, err := LoadConfig(filepath.Join(dir, "env.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "staging", cfg.Environment)
+	assert.Equal(t, "overridden", cfg.ProjectName)
+	assert.Equal(t, "9999", cfg.HTTP.Port)
+	assert.Equal(t, "localhost", cfg.HTTP.Host)
+	assert.Equal(t, "from-env", cfg.Secret)
+	assert.Equal(t, "s3cret", cfg.Database.MySQL.Master.Password)
+	assert.Equal(t, "root", cfg.Database.MySQL.Master.Username)
+}
+
+func TestLoadConfig_CustomSections(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "jwt_secret")
+	writeConfig(t, secret, "s3cret\n")
+	writeConfig(t, filepath.Join(dir, "env.json"), `{
+		"projectName": "bean",
+		"jwt": {"secret": "file://`+secret+`", "issuer": "${BEAN_TEST_ISSUER:-bean}", "expiration": "1h"}
+	}`)
+
+	_, err := LoadConfig(filepath.Join(dir, "env.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "s3cret", GetString("jwt.secret"))
+	assert.Equal(t, "bean", GetString("JWT.Issuer"))
+	assert.Equal(t, "1h", GetString("jwt.expiration"))
+
+	// An unreadable secret fails the loading instead of being used literally.
+	require.NoError(t, os.Remove(secret))
+	_, err = LoadConfig(filepath.Join(dir, "env.json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jwt.secret: failed to read secret file")
+	assert.Empty(t, GetString("jwt.secret"))
+}
+
+func TestExpandValue(t *testing.T) {
+	t.Setenv("BEAN_TEST_VAR", "value")
+
+	got, err := ExpandValue("a-${BEAN_TEST_VAR}-${BEAN_TEST_UNSET:-default}")
+	require.NoError(t, err)
+	assert.Equal(t, "a-value-default", got)
+
+	_, err = ExpandValue("${BEAN_TEST_UNSET}")
+	assert.ErrorContains(t, err, "BEAN_TEST_UNSET")
+
+	_, err = ExpandValue("file:///not/exist")
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_ProjectTemplate(t *testing.T) {
+	_, err := LoadConfig(filepath.Join("..", "cmd", "bean", "internal", "project", "env.json"))
+	require.NoError(t, err)
+}
+
+func TestCanonicalPath(t *testing.T) {
+	assert.Equal(t, "http.ssl.minTLSVersion", canonicalPath("http.ssl.mintlsversion"))
+	assert.Equal(t, "httpClients[1].circuitBreaker.failureRatio", canonicalPath("httpclients[1].circuitbreaker.failureratio"))
+	assert.Equal(t, "database.mysql.master.tls.keyFile", canonicalPath("database.mysql.master.tls.keyfile"))
+	assert.Equal(t, "maintenance.unknown.key", canonicalPath("maintenance.unknown.key"))
+
+	// Every key of the project template is spelled like the validation errors.
+	data, err := os.ReadFile(filepath.Join("..", "cmd", "bean", "internal", "project", "env.json"))
+	require.NoError(t, err)
+	var settings map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &settings))
+
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				path := key
+				if prefix != "" {
+					path = prefix + "." + key
+				}
+				if prefix == "" && isCustomSection(key) {
+					continue
+				}
+				assert.Equal(t, path, canonicalPath(strings.ToLower(path)))
+				walk(path, item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), item)
+			}
+		}
+	}
+	walk("", settings)
+}
+
+func TestLoadConfig_Validation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json")
+	writeConfig(t, path, `{
+		"projectName": "bean",
+		"jwt": {"expiration": "86400s"},
+		"http": {
+			"port": "http",
+			"timout": "10s",
+			"shutdownTimeout": "soon",
+			"allowedMethod": ["GET", "FETCH"],
+			"cors": {"allowCredentials": true, "groups": [{"pathPrefix": "/api", "allowOrigins": ["*"], "allowCredentials": true}]},
+			"ssl": {"on": true, "certFile": "cert.pem", "privFile": "key.pem", "minTLSVersion": 1}
+		},
+		"netHttpFastTransporter": {"on": true, "idleConnTimeout": "-1s"},
+		"database": {"mysql": {"master": {"driver": "oracle", "host": "mysql", "database": "bean", "reads": ["mysql-read:3307", ""], "params": "charset=%zz", "tls": {"on": true, "keyFile": "client-key.pem"}}}, "mongo": {"master": {"readPreference": "fastest", "compressors": ["zstd", "gzip"]}}, "tenant": {"on": true, "resolver": {"on": true, "sources": ["header", "cookie"]}, "reload": {"on": true, "channel": "tenants", "api": {"endPoint": "/tenants/reload"}}, "pool": {"lazy": true, "maxOpen": -1}, "retry": {"minBackoff": "1m", "maxBackoff": "10s"}}},
+		"rateLimit": {
+			"keyBy": "user",
+			"apiKeyHeadr": "X-API-Key",
+			"default": {"algorithm": "leaky_bucket", "limit": 10},
+			"routes": [{"path": "login", "limit": 1, "period": "1m"}]
+		},
+		"maintenance": {"on": true, "allowIPs": ["10.0.0.0/8", "10.0.0.300"], "api": {"endPoint": "/maintenance"}},
+		"idempotency": {"on": true, "methods": ["POST", "FETCH"]},
+		"httpCache": {"store": "disk", "routes": [{"path": "products"}]},
+		"featureFlags": {"source": "redis", "flags": [{"name": "checkout", "percentage": 101}, {"name": "checkout"}]},
+		"httpClients": [{"name": "payment", "baseURL": "payment:8080", "headers": {"X-Client": "bean"}}, {"name": "payment", "circuitBreaker": {"failureRatio": 1.5}}]
+	}`)
+
+	cfg, err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Nil(t, Bean)
+
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	paths := make([]string, 0, len(verr.Errors))
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"database.mysql.master.driver",
+		"database.mysql.master.reads[1]",
+		"database.mysql.master.params",
+		"database.mysql.master.tls.keyFile",
+		"database.mongo.master.readPreference",
+		"database.mongo.master.compressors[1]",
+		"http.allowedMethod[1]",
+		"http.cors.allowOrigins",
+		"http.cors.groups[0].allowOrigins[0]",
+		"http.port",
+		"http.shutdownTimeout",
+		"http.ssl.minTLSVersion",
+		"http.timout",
+		"maintenance.api.authBearerToken",
+		"database.tenant.reload.api.authBearerToken",
+		"netHttpFastTransporter.idleConnTimeout",
+		"rateLimit.apikeyheadr",
+		"rateLimit.default.algorithm",
+		"rateLimit.default.period",
+		"rateLimit.keyBy",
+		"rateLimit.routes[0].path",
+		"maintenance.allowIPs[1]",
+		"httpClients[0].baseURL",
+		"httpClients[1].name",
+		"httpClients[1].circuitBreaker.failureRatio",
+		"idempotency.on",
+		"idempotency.methods[1]",
+		"httpCache.store",
+		"httpCache.routes[0].path",
+		"featureFlags.source",
+		"featureFlags.flags[0].percentage",
+		"featureFlags.flags[1].name",
+		"database.tenant.resolver.sources[1]",
+		"database.tenant.reload.channel",
+		"database.tenant.pool.maxOpen",
+		"database.tenant.retry.minBackoff",
+	}, paths)
+	assert.Contains(t, err.Error(), "36 problem(s) found")
+	assert.Contains(t, err.Error(), `http.shutdownTimeout: time: invalid duration "soon"`)
+}
+
+func TestLoadConfig_ValidationTenantResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.json")
+	writeConfig(t, path, `{
+		"projectName": "bean",
+		"rateLimit": {
+			"on": true,
+			"keyBy": "tenant",
+			"default": {"limit": 10, "period": "1m"},
+			"routes": [{"path": "/login", "keyBy": "tenant", "limit": 1, "period": "1m"}],
+			"tenants": [{"tenantId": "42", "limit": 100, "period": "1m"}]
+		}
+	}`)
+
+	_, err := LoadConfig(path)
+
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	paths := make([]string, 0, len(verr.Errors))
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"rateLimit.keyBy",
+		"rateLimit.routes[0].keyBy",
+		"rateLimit.tenants",
+	}, paths)
+	assert.Contains(t, err.Error(), "rateLimit.tenants: requires database.tenant.resolver.on")
+}
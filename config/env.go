@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of the environment variables which override the config values.
+// For example, `BEAN_HTTP_PORT` overrides `http.port` and `BEAN_DATABASE_MYSQL_MASTER_PASSWORD`
+// overrides `database.mysql.master.password`. Set it before calling `LoadConfig`.
+var EnvPrefix = "BEAN"
+
+// secretFileScheme is the prefix of a config value which is read from a file, e.g. a docker or k8s secret.
+const secretFileScheme = "file://"
+
+// envRefRegex matches `${ENV_VAR}` and `${ENV_VAR:-default}` references in a config value.
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// customValues holds the resolved string values of the `AllowedCustomSections` by lowercase key, e.g. `jwt.secret`.
+// It is replaced by every successful `decode`.
+var customValues atomic.Pointer[map[string]string]
+
+// overlayFiles are merged on top of the base config file in order, e.g. `env.staging.json`.
+var overlayFiles []string
+
+// setupEnv enables the prefix based environment variable overrides for every key of `Config`,
+// including the keys which are missing in the config file.
+func setupEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	bindEnvs(reflect.TypeOf(Config{}), "")
+}
+
+func bindEnvs(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		// The embedded structs are squashed, e.g. `CORSPolicy` in `CORS`.
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			bindEnvs(field.Type, prefix)
+			continue
+		}
+
+		key := strings.ToLower(field.Name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case ft.Kind() == reflect.Struct && isBeanType(ft):
+			bindEnvs(ft, key)
+		case ft.Kind() == reflect.Func, ft.Kind() == reflect.Struct, ft.Kind() == reflect.Map:
+			// Not configurable by a single environment variable.
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			// Not configurable by a single environment variable.
+		default:
+			_ = viper.BindEnv(key)
+		}
+	}
+}
+
+// isBeanType reports whether the struct is an anonymous struct or is defined in bean.
+func isBeanType(t reflect.Type) bool {
+	return t.PkgPath() == "" || strings.HasPrefix(t.PkgPath(), "github.com/retail-ai-inc/bean/")
+}
+
+// resolveOverlays returns the existing overlay files. `<name>.<environment><ext>` next to the base
+// file is added automatically, the environment comes from `environment` in the config (which can be
+// overridden by `BEAN_ENVIRONMENT`).
+func resolveOverlays(dir, name, ext string, overlays []string) ([]string, error) {
+	files := make([]string, 0, len(overlays)+1)
+
+	if env := viper.GetString("environment"); env != "" {
+		envFile := filepath.Join(dir, name+"."+env+ext)
+		if _, err := os.Stat(envFile); err == nil {
+			files = append(files, envFile)
+		}
+	}
+
+	for _, overlay := range overlays {
+		absPath, err := filepath.Abs(overlay)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %v", err)
+		}
+		files = append(files, absPath)
+	}
+
+	return files, nil
+}
+
+// mergeOverlays merges the overlay files on top of the config which viper has read.
+func mergeOverlays() error {
+	for _, file := range overlayFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading config file, %s", err)
+		}
+
+		if err := viper.MergeConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("error merging config file %s, %s", file, err)
+		}
+	}
+
+	return nil
+}
+
+// decode unmarshals the viper settings into `cfg`, resolves the `${ENV_VAR}` and `file://` references and
+// validates the result. It returns a `*ValidationError` listing every unknown key, undecodable and invalid value.
+func decode(cfg *Config) error {
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		expandValueHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+
+	verr := &ValidationError{}
+	if err := viper.Unmarshal(cfg, hook); err != nil {
+		verr.addDecodeErrors(err)
+	}
+	verr.addUnknownKeys(viper.AllSettings())
+	values := expandCustomSections(verr)
+	cfg.validate(verr)
+
+	if err := verr.err(); err != nil {
+		return err
+	}
+	customValues.Store(&values)
+
+	return nil
+}
+
+// expandCustomSections resolves the `${ENV_VAR}` and `file://` references of the string values of the
+// `AllowedCustomSections`, which are not decoded into `Config`.
+func expandCustomSections(verr *ValidationError) map[string]string {
+	values := map[string]string{}
+	for _, key := range viper.AllKeys() {
+		if !isCustomSection(strings.SplitN(key, ".", 2)[0]) {
+			continue
+		}
+		raw, ok := viper.Get(key).(string)
+		if !ok {
+			continue
+		}
+		value, err := ExpandValue(raw)
+		if err != nil {
+			verr.add(key, "%v", err)
+			continue
+		}
+		values[key] = value
+	}
+
+	return values
+}
+
+// GetString returns the value of `key` like `viper.GetString`, with the `${ENV_VAR}` and `file://` references
+// resolved. Use it instead of viper for the keys of the `AllowedCustomSections`, e.g. `jwt.secret`. It returns an
+// empty string if the reference cannot be resolved.
+func GetString(key string) string {
+	key = strings.ToLower(key)
+	if values := customValues.Load(); values != nil {
+		if value, ok := (*values)[key]; ok {
+			return value
+		}
+	}
+
+	value, err := ExpandValue(viper.GetString(key))
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func expandValueHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, _ reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+
+		return ExpandValue(data.(string))
+	}
+}
+
+// ExpandValue resolves a config value. A value starting with `file://` is replaced by the trimmed
+// content of the file (e.g. `file:///run/secrets/db_password`), otherwise every `${ENV_VAR}` or
+// `${ENV_VAR:-default}` reference is replaced by the environment variable. It returns an error if
+// the file cannot be read or the environment variable is not set and has no default.
+func ExpandValue(value string) (string, error) {
+	if strings.HasPrefix(value, secretFileScheme) {
+		path := strings.TrimPrefix(value, secretFileScheme)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %q: %v", path, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var missing []string
+	expanded := envRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envRefRegex.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ref
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
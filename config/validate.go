@@ -0,0 +1,832 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/gommon/bytes"
+	"github.com/mitchellh/mapstructure"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// AllowedCustomSections are the top level sections (or keys) of the config file which are not part of `Config`
+// but read by the project itself, e.g. with `viper.GetDuration("jwt.expiration")`, or by the bean CLI like
+// `packagePath`. Any other unknown key is reported as a validation error. Add your own sections before calling
+// `LoadConfig`.
+var AllowedCustomSections = []string{"jwt", "packagePath"}
+
+// FieldError is a problem of a single config value. `Path` is the JSON path of the value, e.g. `http.timeout`.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found in the config.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("invalid config, %d problem(s) found:", len(e.Errors)))
+	for _, fe := range e.Errors {
+		sb.WriteString("\n  - ")
+		sb.WriteString(fe.Error())
+	}
+	return sb.String()
+}
+
+func (e *ValidationError) add(path, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil if there is no problem, otherwise the error with the problems sorted by path.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(e.Errors, func(i, j int) bool {
+		return e.Errors[i].Path < e.Errors[j].Path
+	})
+	return e
+}
+
+// decodeErrRegex splits a mapstructure error like `error decoding 'HTTP.Timeout': time: invalid duration "x"`.
+var decodeErrRegex = regexp.MustCompile(`^(?:error decoding )?'([^']*)':? (.*)$`)
+
+// addDecodeErrors adds the errors which mapstructure found while decoding the values. The paths are spelled like
+// in env.json, as the keys of the config file are case-insensitive.
+func (e *ValidationError) addDecodeErrors(err error) {
+	merr, ok := err.(*mapstructure.Error)
+	if !ok {
+		e.add("", "%v", err)
+		return
+	}
+
+	for _, msg := range merr.Errors {
+		if m := decodeErrRegex.FindStringSubmatch(msg); m != nil {
+			e.add(canonicalPath(strings.ToLower(m[1])), "%s", m[2])
+			continue
+		}
+		e.add("", "%s", msg)
+	}
+}
+
+// addUnknownKeys adds the keys of the config file which don't match any field of `Config`.
+func (e *ValidationError) addUnknownKeys(settings map[string]interface{}) {
+	for key := range settings {
+		if isCustomSection(key) {
+			delete(settings, key)
+		}
+	}
+
+	for _, key := range unknownKeys(reflect.TypeOf(Config{}), settings, "") {
+		e.add(canonicalPath(key), "unknown key")
+	}
+}
+
+// unknownKeys walks the settings along the struct type and returns the paths of the keys without a field.
+func unknownKeys(t reflect.Type, settings map[string]interface{}, prefix string) []string {
+	var keys []string
+
+	for key, value := range settings {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		field, ok := fieldByKey(t, key)
+		if !ok {
+			keys = append(keys, path)
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		switch ft.Kind() {
+		case reflect.Struct:
+			if m, ok := value.(map[string]interface{}); ok {
+				keys = append(keys, unknownKeys(ft, m, path)...)
+			}
+		case reflect.Slice:
+			et := ft.Elem()
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() != reflect.Struct {
+				continue
+			}
+			items, _ := value.([]interface{})
+			for i, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					keys = append(keys, unknownKeys(et, m, fmt.Sprintf("%s[%d]", path, i))...)
+				}
+			}
+		}
+	}
+
+	return keys
+}
+
+// fieldByKey finds the field of the struct for a config key, case-insensitive like mapstructure does.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		// The embedded structs are squashed.
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if f, ok := fieldByKey(field.Type, key); ok {
+				return f, true
+			}
+			continue
+		}
+		if strings.EqualFold(field.Name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func isCustomSection(section string) bool {
+	for _, s := range AllowedCustomSections {
+		if strings.EqualFold(s, section) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the semantic of the config values and returns a `*ValidationError` listing every problem.
+func (c *Config) Validate() error {
+	verr := &ValidationError{}
+	c.validate(verr)
+	return verr.err()
+}
+
+func (c *Config) validate(verr *ValidationError) {
+	validateHTTP(c, verr)
+	validateNetHttpFastTransporter(c, verr)
+	validateDatabase(c, verr)
+
+	validateRegexes(verr, "accessLog.skipEndpoints", c.AccessLog.SkipEndpoints)
+	validateRegexes(verr, "prometheus.skipEndpoints", c.Prometheus.SkipEndpoints)
+	validateRegexes(verr, "sentry.skipTracesEndpoints", c.Sentry.SkipTracesEndpoints)
+
+	if c.Sentry.On && c.Sentry.Dsn == "" {
+		verr.add("sentry.dsn", "is required when sentry is on")
+	}
+	validateDurations(verr, map[string]time.Duration{
+		"sentry.timeout":          c.Sentry.Timeout,
+		"health.timeout":          c.Health.Timeout,
+		"health.shutdownDelay":    c.Health.ShutdownDelay,
+		"queue.pollInterval":      c.Queue.PollInterval,
+		"queue.visibilityTimeout": c.Queue.VisibilityTimeout,
+		"queue.retryMinBackoff":   c.Queue.RetryMinBackoff,
+		"queue.retryMaxBackoff":   c.Queue.RetryMaxBackoff,
+		"queue.shutdownTimeout":   c.Queue.ShutdownTimeout,
+	})
+	if c.Queue.Concurrency < 0 {
+		verr.add("queue.concurrency", "must not be negative")
+	}
+
+	names := make(map[string]bool, len(c.AsyncPool))
+	for i, pool := range c.AsyncPool {
+		path := fmt.Sprintf("asyncPool[%d]", i)
+		if pool.Name == "" {
+			verr.add(path+".name", "is required")
+		} else if names[pool.Name] {
+			verr.add(path+".name", "duplicate pool name %q", pool.Name)
+		}
+		names[pool.Name] = true
+		if pool.Size != nil && *pool.Size <= 0 {
+			verr.add(path+".size", "must be greater than 0")
+		}
+		if pool.BlockAfter != nil && *pool.BlockAfter < 0 {
+			verr.add(path+".blockAfter", "must not be negative")
+		}
+	}
+
+	validateRateLimit(c, verr)
+	validateMaintenance(c, verr)
+	validateHTTPClients(c, verr)
+	validateCircuitBreaker(verr, "database.circuitBreaker", c.Database.CircuitBreaker)
+	validateIdempotency(c, verr)
+	validateHTTPCache(c, verr)
+	validateFeatureFlags(c, verr)
+	validateTenant(c, verr)
+}
+
+func validateIdempotency(c *Config, verr *ValidationError) {
+	idem := c.Idempotency
+
+	if idem.On && (c.Database.Redis.Master == nil || c.Database.Redis.Master.Host == "") {
+		verr.add("idempotency.on", "requires database.redis.master")
+	}
+	for i, method := range idem.Methods {
+		if !isHTTPMethod(strings.ToUpper(method)) {
+			verr.add(fmt.Sprintf("idempotency.methods[%d]", i), "unknown HTTP method %q", method)
+		}
+	}
+	for i, path := range idem.Paths {
+		if !strings.HasPrefix(path, "/") {
+			verr.add(fmt.Sprintf("idempotency.paths[%d]", i), "must be a route pattern starting with \"/\", got %q", path)
+		}
+	}
+	validateDurations(verr, map[string]time.Duration{
+		"idempotency.ttl":     idem.TTL,
+		"idempotency.lockTTL": idem.LockTTL,
+	})
+}
+
+func validateHTTPCache(c *Config, verr *ValidationError) {
+	hc := c.HTTPCache
+
+	switch hc.Store {
+	case "", "memory":
+	case "redis":
+		if hc.On && (c.Database.Redis.Master == nil || c.Database.Redis.Master.Host == "") {
+			verr.add("httpCache.store", "redis requires database.redis.master")
+		}
+	default:
+		verr.add("httpCache.store", "must be memory or redis, got %q", hc.Store)
+	}
+
+	durations := map[string]time.Duration{"httpCache.ttl": hc.TTL}
+	for i, route := range hc.Routes {
+		path := fmt.Sprintf("httpCache.routes[%d]", i)
+		if !strings.HasPrefix(route.Path, "/") {
+			verr.add(path+".path", "must be a route pattern starting with \"/\", got %q", route.Path)
+		}
+		durations[path+".ttl"] = route.TTL
+	}
+	validateDurations(verr, durations)
+}
+
+func validateFeatureFlags(c *Config, verr *ValidationError) {
+	ff := c.FeatureFlags
+
+	switch ff.Source {
+	case "", "config":
+	case "mysql":
+		if ff.On && (c.Database.MySQL.Master == nil || c.Database.MySQL.Master.Database == "") {
+			verr.add("featureFlags.source", "mysql requires database.mysql.master")
+		}
+	default:
+		verr.add("featureFlags.source", "must be config or mysql, got %q", ff.Source)
+	}
+
+	names := make(map[string]bool, len(ff.Flags))
+	for i, flag := range ff.Flags {
+		path := fmt.Sprintf("featureFlags.flags[%d]", i)
+		switch {
+		case flag.Name == "":
+			verr.add(path+".name", "must not be empty")
+		case names[flag.Name]:
+			verr.add(path+".name", "duplicate flag %q", flag.Name)
+		}
+		names[flag.Name] = true
+
+		if flag.Percentage < 0 || flag.Percentage > 100 {
+			verr.add(path+".percentage", "must be between 0 and 100, got %d", flag.Percentage)
+		}
+	}
+	validateDurations(verr, map[string]time.Duration{
+		"featureFlags.refreshInterval": ff.RefreshInterval,
+	})
+}
+
+func validateTenant(c *Config, verr *ValidationError) {
+	resolver, reload, pool := c.Database.Tenant.Resolver, c.Database.Tenant.Reload, c.Database.Tenant.Pool
+	retry := c.Database.Tenant.Retry
+
+	if resolver.On && !c.Database.Tenant.On {
+		verr.add("database.tenant.resolver.on", "requires database.tenant.on")
+	}
+	for i, source := range resolver.Sources {
+		switch source {
+		case "header", "jwt", "subdomain", "param":
+		default:
+			verr.add(fmt.Sprintf("database.tenant.resolver.sources[%d]", i), "must be one of header, jwt, subdomain or param, got %q", source)
+		}
+	}
+
+	if reload.On && !c.Database.Tenant.On {
+		verr.add("database.tenant.reload.on", "requires database.tenant.on")
+	}
+	if reload.On && reload.Channel != "" && (c.Database.Redis.Master == nil || c.Database.Redis.Master.Host == "") {
+		verr.add("database.tenant.reload.channel", "requires database.redis.master")
+	}
+	// IMPORTANT: Anyone could reopen every tenant otherwise, the end point is public without the admin listener.
+	if reload.On && reload.API.EndPoint != "" && reload.API.AuthBearerToken == "" && !c.Admin.On {
+		verr.add("database.tenant.reload.api.authBearerToken", "is required unless admin.on is true, the end point is public otherwise")
+	}
+	validateDurations(verr, map[string]time.Duration{
+		"database.tenant.reload.interval":   reload.Interval,
+		"database.tenant.reload.closeDelay": reload.CloseDelay,
+		"database.tenant.pool.idleTimeout":  pool.IdleTimeout,
+		"database.tenant.pool.closeDelay":   pool.CloseDelay,
+		"database.tenant.retry.minBackoff":  retry.MinBackoff,
+		"database.tenant.retry.maxBackoff":  retry.MaxBackoff,
+	})
+	if retry.MinBackoff > 0 && retry.MaxBackoff > 0 && retry.MinBackoff > retry.MaxBackoff {
+		verr.add("database.tenant.retry.minBackoff", "must not be greater than maxBackoff")
+	}
+
+	if pool.Lazy && !c.Database.Tenant.On {
+		verr.add("database.tenant.pool.lazy", "requires database.tenant.on")
+	}
+	if pool.MaxOpen < 0 {
+		verr.add("database.tenant.pool.maxOpen", "must not be negative")
+	}
+}
+
+func validateMySQLConnection(verr *ValidationError, path string, conn *dbdrivers.MySQLConnection) {
+	switch conn.Driver {
+	case "", dbdrivers.DriverMySQL, dbdrivers.DriverPostgres:
+	default:
+		verr.add(path+".driver", "must be one of mysql or postgres, got %q", conn.Driver)
+	}
+
+	for i, read := range conn.Reads {
+		if read == "" {
+			verr.add(fmt.Sprintf("%s.reads[%d]", path, i), "must not be empty")
+		}
+	}
+
+	if _, err := url.ParseQuery(conn.Params); err != nil {
+		verr.add(path+".params", "invalid DSN parameters %q, e.g. `charset=utf8mb4&loc=Local`", conn.Params)
+	}
+
+	if conn.TLS.KeyFile != "" && conn.TLS.CertFile == "" {
+		verr.add(path+".tls.keyFile", "requires certFile")
+	}
+}
+
+func validateMongoConnection(verr *ValidationError, path string, conn *dbdrivers.MongoConnection) {
+	if conn.URI != "" && !strings.HasPrefix(conn.URI, "mongodb://") && !strings.HasPrefix(conn.URI, "mongodb+srv://") {
+		verr.add(path+".uri", "must start with mongodb:// or mongodb+srv://")
+	}
+
+	switch strings.ToUpper(conn.AuthMechanism) {
+	case "", "SCRAM-SHA-1", "SCRAM-SHA-256", "MONGODB-X509", "MONGODB-AWS", "GSSAPI", "PLAIN":
+	default:
+		verr.add(path+".authMechanism", "unsupported authentication mechanism %q", conn.AuthMechanism)
+	}
+
+	if conn.ReadPreference != "" {
+		if _, err := readpref.ModeFromString(conn.ReadPreference); err != nil {
+			verr.add(path+".readPreference", "must be one of primary, primaryPreferred, secondary, secondaryPreferred or nearest, got %q", conn.ReadPreference)
+		}
+	}
+
+	for i, compressor := range conn.Compressors {
+		switch compressor {
+		case "snappy", "zlib", "zstd":
+		default:
+			verr.add(fmt.Sprintf("%s.compressors[%d]", path, i), "must be one of snappy, zlib or zstd, got %q", compressor)
+		}
+	}
+
+	if conn.TLS.KeyFile != "" && conn.TLS.CertFile == "" {
+		verr.add(path+".tls.keyFile", "requires certFile")
+	}
+}
+
+func validateHTTP(c *Config, verr *ValidationError) {
+	if c.HTTP.Port != "" {
+		if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 0 || port > 65535 {
+			verr.add("http.port", "invalid port %q", c.HTTP.Port)
+		}
+	}
+
+	if c.HTTP.UnixSocket.Mode != "" {
+		if _, err := strconv.ParseUint(c.HTTP.UnixSocket.Mode, 8, 32); err != nil {
+			verr.add("http.unixSocket.mode", "invalid file mode %q, must be octal like 0660", c.HTTP.UnixSocket.Mode)
+		}
+	}
+
+	if c.HTTP.BodyLimit != "" {
+		if _, err := bytes.Parse(c.HTTP.BodyLimit); err != nil {
+			verr.add("http.bodyLimit", "invalid size %q, e.g. `1M`", c.HTTP.BodyLimit)
+		}
+	}
+
+	if c.Admin.On {
+		if port, err := strconv.Atoi(c.Admin.Port); err != nil || port < 0 || port > 65535 {
+			verr.add("admin.port", "invalid port %q", c.Admin.Port)
+		} else if c.Admin.Port == c.HTTP.Port {
+			verr.add("admin.port", "must be different from http.port")
+		}
+	}
+
+	validateDurations(verr, map[string]time.Duration{
+		"http.timeout":         c.HTTP.Timeout,
+		"http.shutdownTimeout": c.HTTP.ShutdownTimeout,
+	})
+
+	validateCORSPolicy(verr, "http.cors", c.HTTP.CORS.CORSPolicy)
+	for i, group := range c.HTTP.CORS.Groups {
+		path := fmt.Sprintf("http.cors.groups[%d]", i)
+		if !strings.HasPrefix(group.PathPrefix, "/") {
+			verr.add(path+".pathPrefix", "must start with \"/\"")
+		}
+		validateCORSPolicy(verr, path, group.CORSPolicy)
+	}
+
+	for i, method := range c.HTTP.AllowedMethod {
+		if !isHTTPMethod(method) {
+			verr.add(fmt.Sprintf("http.allowedMethod[%d]", i), "unknown HTTP method %q", method)
+		}
+	}
+
+	if c.HTTP.SSL.On {
+		if c.HTTP.SSL.CertFile == "" {
+			verr.add("http.ssl.certFile", "is required when ssl is on")
+		}
+		if c.HTTP.SSL.PrivFile == "" {
+			verr.add("http.ssl.privFile", "is required when ssl is on")
+		}
+		switch strings.ToLower(c.HTTP.SSL.ClientAuth) {
+		case "", "none":
+		case "optional", "required":
+			if c.HTTP.SSL.ClientCAFile == "" {
+				verr.add("http.ssl.clientCAFile", "is required when clientAuth is %q", c.HTTP.SSL.ClientAuth)
+			}
+		default:
+			verr.add("http.ssl.clientAuth", "unknown client auth %q, must be one of \"none\", \"optional\" or \"required\"", c.HTTP.SSL.ClientAuth)
+		}
+		// IMPORTANT: 0 means the default minimum version of `crypto/tls`.
+		if v := c.HTTP.SSL.MinTLSVersion; v != 0 && (v < tls.VersionTLS10 || v > tls.VersionTLS13) {
+			verr.add("http.ssl.minTLSVersion", "unsupported TLS version %d, must be one of %d (1.0), %d (1.1), %d (1.2) or %d (1.3)",
+				v, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13)
+		}
+	}
+}
+
+func validateNetHttpFastTransporter(c *Config, verr *ValidationError) {
+	t := c.NetHttpFastTransporter
+	if !t.On {
+		return
+	}
+
+	for path, v := range map[string]*int{
+		"netHttpFastTransporter.maxIdleConns":        t.MaxIdleConns,
+		"netHttpFastTransporter.maxIdleConnsPerHost": t.MaxIdleConnsPerHost,
+		"netHttpFastTransporter.maxConnsPerHost":     t.MaxConnsPerHost,
+	} {
+		if v != nil && *v < 0 {
+			verr.add(path, "must not be negative")
+		}
+	}
+
+	for path, v := range map[string]*time.Duration{
+		"netHttpFastTransporter.idleConnTimeout": t.IdleConnTimeout,
+		"netHttpFastTransporter.dnsCacheTimeout": t.DNSCacheTimeout,
+	} {
+		if v != nil && *v < 0 {
+			verr.add(path, "must not be negative")
+		}
+	}
+}
+
+func validateDatabase(c *Config, verr *ValidationError) {
+	db := c.Database
+
+	// IMPORTANT: The tenant connections are stored in the master MySQL database.
+	if db.Tenant.On {
+		if db.MySQL.Master == nil {
+			verr.add("database.mysql.master", "is required when database.tenant.on is true")
+		} else {
+			if db.MySQL.Master.Host == "" {
+				verr.add("database.mysql.master.host", "is required when database.tenant.on is true")
+			}
+			if db.MySQL.Master.Database == "" {
+				verr.add("database.mysql.master.database", "is required when database.tenant.on is true")
+			}
+		}
+	}
+
+	if db.MySQL.Master != nil {
+		validateMySQLConnection(verr, "database.mysql.master", db.MySQL.Master)
+	}
+
+	if db.Mongo.Master != nil {
+		validateMongoConnection(verr, "database.mongo.master", db.Mongo.Master)
+	}
+
+	if c.Health.CheckTenants && !db.Tenant.On {
+		verr.add("health.checkTenants", "requires database.tenant.on to be true")
+	}
+
+	validateDurations(verr, map[string]time.Duration{
+		"database.mysql.maxConnectionLifeTime":     db.MySQL.MaxConnectionLifeTime,
+		"database.mysql.maxIdleConnectionLifeTime": db.MySQL.MaxIdleConnectionLifeTime,
+		"database.mongo.connectTimeout":            db.Mongo.ConnectTimeout,
+		"database.mongo.maxConnectionLifeTime":     db.Mongo.MaxConnectionLifeTime,
+		"database.redis.dialTimeout":               db.Redis.DialTimeout,
+		"database.redis.readTimeout":               db.Redis.ReadTimeout,
+		"database.redis.writeTimeout":              db.Redis.WriteTimeout,
+		"database.redis.poolTimeout":               db.Redis.PoolTimeout,
+	})
+
+	if db.MySQL.MaxIdleConnections < 0 {
+		verr.add("database.mysql.maxIdleConnections", "must not be negative")
+	}
+	if db.MySQL.MaxOpenConnections < 0 {
+		verr.add("database.mysql.maxOpenConnections", "must not be negative")
+	}
+	if db.Mongo.MinConnectionPoolSize > db.Mongo.MaxConnectionPoolSize && db.Mongo.MaxConnectionPoolSize > 0 {
+		verr.add("database.mongo.minConnectionPoolSize", "must not be greater than maxConnectionPoolSize")
+	}
+	if db.Redis.Master != nil && db.Redis.Master.Database < 0 {
+		verr.add("database.redis.master.database", "must not be negative")
+	}
+}
+
+func validateCORSPolicy(verr *ValidationError, path string, policy CORSPolicy) {
+	for i, origin := range policy.AllowOrigins {
+		if origin == "*" && policy.AllowCredentials {
+			verr.add(fmt.Sprintf("%s.allowOrigins[%d]", path, i), "wildcard origin \"*\" is not allowed with allowCredentials, list the origins instead")
+		}
+	}
+	// IMPORTANT: No origin means every origin.
+	if len(policy.AllowOrigins) == 0 && policy.AllowCredentials {
+		verr.add(path+".allowOrigins", "is required with allowCredentials, list the origins")
+	}
+	if policy.MaxAge < 0 {
+		verr.add(path+".maxAge", "must not be negative, got %s", policy.MaxAge)
+	}
+}
+
+func validateRateLimit(c *Config, verr *ValidationError) {
+	rl := c.RateLimit
+
+	switch rl.Store {
+	case "", "redis", "memory":
+	default:
+		verr.add("rateLimit.store", "must be one of redis or memory, got %q", rl.Store)
+	}
+	validateRateLimitKeyBy(verr, "rateLimit.keyBy", rl.KeyBy)
+	validateRateLimitRule(verr, "rateLimit.default", rl.Default)
+
+	// IMPORTANT: The tenant of a quota must be resolved by the tenant middleware, a client could send any header.
+	resolved := !rl.On || c.Database.Tenant.Resolver.On
+	if !resolved && rl.KeyBy == "tenant" {
+		verr.add("rateLimit.keyBy", "tenant requires database.tenant.resolver.on")
+	}
+	if !resolved && len(rl.Tenants) > 0 {
+		verr.add("rateLimit.tenants", "requires database.tenant.resolver.on")
+	}
+
+	for i, route := range rl.Routes {
+		path := fmt.Sprintf("rateLimit.routes[%d]", i)
+		if !strings.HasPrefix(route.Path, "/") {
+			verr.add(path+".path", "must be a route pattern starting with \"/\", got %q", route.Path)
+		}
+		if route.Method != "" && !isHTTPMethod(strings.ToUpper(route.Method)) {
+			verr.add(path+".method", "unknown HTTP method %q", route.Method)
+		}
+		validateRateLimitKeyBy(verr, path+".keyBy", route.KeyBy)
+		if !resolved && route.KeyBy == "tenant" {
+			verr.add(path+".keyBy", "tenant requires database.tenant.resolver.on")
+		}
+		validateRateLimitRule(verr, path, route.RateLimitRule)
+	}
+
+	for i, tenant := range rl.Tenants {
+		path := fmt.Sprintf("rateLimit.tenants[%d]", i)
+		if tenant.TenantID == "" {
+			verr.add(path+".tenantId", "is required")
+		}
+		validateRateLimitRule(verr, path, tenant.RateLimitRule)
+	}
+}
+
+func validateMaintenance(c *Config, verr *ValidationError) {
+	m := c.Maintenance
+
+	for i, ip := range m.AllowIPs {
+		if strings.Contains(ip, "/") {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				verr.add(fmt.Sprintf("maintenance.allowIPs[%d]", i), "invalid CIDR %q", ip)
+			}
+		} else if net.ParseIP(ip) == nil {
+			verr.add(fmt.Sprintf("maintenance.allowIPs[%d]", i), "invalid IP address %q", ip)
+		}
+	}
+	if m.API.EndPoint != "" && !strings.HasPrefix(m.API.EndPoint, "/") {
+		verr.add("maintenance.api.endPoint", "must start with \"/\", got %q", m.API.EndPoint)
+	}
+	// IMPORTANT: The end point can take every tenant offline, it is public without the admin listener.
+	if m.On && m.API.EndPoint != "" && m.API.AuthBearerToken == "" && !c.Admin.On {
+		verr.add("maintenance.api.authBearerToken", "is required unless admin.on is true, the end point is public otherwise")
+	}
+	validateDurations(verr, map[string]time.Duration{
+		"maintenance.cacheTTL":   m.CacheTTL,
+		"maintenance.retryAfter": m.RetryAfter,
+	})
+}
+
+func validateHTTPClients(c *Config, verr *ValidationError) {
+	names := make(map[string]bool, len(c.HTTPClients))
+	for i, client := range c.HTTPClients {
+		path := fmt.Sprintf("httpClients[%d]", i)
+		if client.Name == "" {
+			verr.add(path+".name", "is required")
+		} else if names[client.Name] {
+			verr.add(path+".name", "duplicate client name %q", client.Name)
+		}
+		names[client.Name] = true
+
+		if client.BaseURL != "" {
+			if u, err := url.Parse(client.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				verr.add(path+".baseURL", "must be an absolute URL, got %q", client.BaseURL)
+			}
+		}
+		validateDurations(verr, map[string]time.Duration{
+			path + ".timeout":               client.Timeout,
+			path + ".dialTimeout":           client.DialTimeout,
+			path + ".tlsHandshakeTimeout":   client.TLSHandshakeTimeout,
+			path + ".responseHeaderTimeout": client.ResponseHeaderTimeout,
+			path + ".idleConnTimeout":       client.IdleConnTimeout,
+			path + ".retryMinBackoff":       client.RetryMinBackoff,
+			path + ".retryMaxBackoff":       client.RetryMaxBackoff,
+		})
+		for key, value := range map[string]int{
+			".maxIdleConns":        client.MaxIdleConns,
+			".maxIdleConnsPerHost": client.MaxIdleConnsPerHost,
+			".maxConnsPerHost":     client.MaxConnsPerHost,
+			".retryCount":          client.RetryCount,
+		} {
+			if value < 0 {
+				verr.add(path+key, "must not be negative")
+			}
+		}
+		for j, code := range client.RetryOnStatus {
+			if code < 100 || code > 599 {
+				verr.add(fmt.Sprintf("%s.retryOnStatus[%d]", path, j), "invalid HTTP status code %d", code)
+			}
+		}
+		validateCircuitBreaker(verr, path+".circuitBreaker", client.CircuitBreaker)
+	}
+}
+
+func validateCircuitBreaker(verr *ValidationError, path string, cb CircuitBreaker) {
+	if cb.FailureRatio < 0 || cb.FailureRatio > 1 {
+		verr.add(path+".failureRatio", "must be between 0 and 1, got %v", cb.FailureRatio)
+	}
+	for key, value := range map[string]int{
+		".buckets":             cb.Buckets,
+		".minRequests":         cb.MinRequests,
+		".halfOpenMaxRequests": cb.HalfOpenMaxRequests,
+	} {
+		if value < 0 {
+			verr.add(path+key, "must not be negative")
+		}
+	}
+	validateDurations(verr, map[string]time.Duration{
+		path + ".window":      cb.Window,
+		path + ".openTimeout": cb.OpenTimeout,
+	})
+}
+
+func validateRateLimitKeyBy(verr *ValidationError, path, keyBy string) {
+	switch keyBy {
+	case "", "ip", "jwt_subject", "api_key", "tenant":
+	default:
+		verr.add(path, "must be one of ip, jwt_subject, api_key or tenant, got %q", keyBy)
+	}
+}
+
+// validateRateLimitRule accepts a zero limit, which disables the rate limiting.
+func validateRateLimitRule(verr *ValidationError, path string, rule RateLimitRule) {
+	switch rule.Algorithm {
+	case "", "token_bucket", "sliding_window":
+	default:
+		verr.add(path+".algorithm", "must be one of token_bucket or sliding_window, got %q", rule.Algorithm)
+	}
+	if rule.Limit < 0 {
+		verr.add(path+".limit", "must not be negative")
+	}
+	if rule.Limit > 0 && rule.Period <= 0 {
+		verr.add(path+".period", "must be greater than 0 when limit is set")
+	}
+	if rule.Burst < 0 {
+		verr.add(path+".burst", "must not be negative")
+	}
+}
+
+// validateDurations adds a problem for every negative duration.
+func validateDurations(verr *ValidationError, durations map[string]time.Duration) {
+	for path, d := range durations {
+		if d < 0 {
+			verr.add(path, "must not be negative, got %s", d)
+		}
+	}
+}
+
+func validateRegexes(verr *ValidationError, path string, patterns []string) {
+	for i, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			verr.add(fmt.Sprintf("%s[%d]", path, i), "invalid regular expression: %v", err)
+		}
+	}
+}
+
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// canonicalPath returns the path with the keys spelled like in env.json, e.g. `http.shutdownTimeout` for
+// `http.shutdowntimeout`, as viper and mapstructure lowercase the keys. The keys which don't match any field of
+// `Config` are kept as they are.
+func canonicalPath(path string) string {
+	if path == "" {
+		return path
+	}
+
+	segments := strings.Split(path, ".")
+	t := reflect.TypeOf(Config{})
+	for i, segment := range segments {
+		key, index, _ := strings.Cut(segment, "[")
+		if t == nil || t.Kind() != reflect.Struct {
+			break
+		}
+
+		field, ok := fieldByKey(t, key)
+		if !ok {
+			break
+		}
+		segments[i] = configKey(field)
+		if index != "" {
+			segments[i] += "[" + index
+		}
+
+		t = field.Type
+		for t.Kind() == reflect.Pointer || (index != "" && t.Kind() == reflect.Slice) {
+			t = t.Elem()
+		}
+	}
+
+	return strings.Join(segments, ".")
+}
+
+// configKeyExceptions are the keys of env.json which don't follow the spelling of `configKey`.
+var configKeyExceptions = map[string]string{
+	"MySQL":    "mysql",
+	"PoolSize": "poolsize",
+}
+
+// configKey returns the key of a field in env.json: its `json` tag if any, otherwise its name in lower camel
+// case with the leading initialism lowercased, e.g. `htmlFile` for `HTMLFile`.
+func configKey(field reflect.StructField) string {
+	if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" && tag != "-" {
+		return tag
+	}
+	if key, ok := configKeyExceptions[field.Name]; ok {
+		return key
+	}
+
+	name := []rune(field.Name)
+	upper := 0
+	for upper < len(name) && unicode.IsUpper(name[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(name) {
+		// The last upper case letter starts the next word.
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		name[i] = unicode.ToLower(name[i])
+	}
+
+	return string(name)
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/retail-ai-inc/bean/v2/log"
+	"github.com/spf13/viper"
+)
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   []func(old, new *Config)
+	watchOnce     sync.Once
+)
+
+// OnChange registers a function which is called with the previous and the new configuration
+// every time the config file is reloaded by `WatchConfig`. Subscribers are called in the
+// registration order after `Current` returns the new configuration. The global `Bean` is never replaced.
+func OnChange(fn func(old, new *Config)) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	subscribers = append(subscribers, fn)
+}
+
+// WatchConfig starts watching the config file loaded by `LoadConfig` and reloads it on change.
+// An invalid config file is ignored and the current configuration is kept. Calling it more than
+// once has no effect.
+func WatchConfig() {
+	watchOnce.Do(func() {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			if err := reload(); err != nil {
+				logError(fmt.Errorf("config reload from %s failed, keep the current config: %w", e.Name, err))
+			}
+		})
+		viper.WatchConfig()
+	})
+}
+
+// reload decodes the configuration from viper, swaps the one of `Current` and notifies the subscribers.
+func reload() error {
+	// IMPORTANT: viper only re-reads the base config file, merge the overlay files again.
+	if err := mergeOverlays(); err != nil {
+		return err
+	}
+
+	newCfg := &Config{}
+	if err := decode(newCfg); err != nil {
+		return err
+	}
+
+	old := Current()
+
+	// IMPORTANT: Sentry client options and scope are set from the code, not from the config file.
+	if old != nil {
+		newCfg.Sentry.ClientOptions = old.Sentry.ClientOptions
+		newCfg.Sentry.ConfigureScope = old.Sentry.ConfigureScope
+	}
+
+	current.Store(newCfg)
+
+	subscribersMu.RLock()
+	fns := make([]func(old, new *Config), len(subscribers))
+	copy(fns, subscribers)
+	subscribersMu.RUnlock()
+
+	for _, fn := range fns {
+		fn(old, newCfg)
+	}
+
+	if l := log.Logger(); l != nil {
+		l.Info("config has been reloaded")
+	}
+
+	return nil
+}
+
+func logError(err error) {
+	if l := log.Logger(); l != nil {
+		l.Error(err)
+	}
+}
@@ -38,6 +38,11 @@ const (
 	METHOD_NOT_ALLOWED           ErrorCode = "100006"
 	SERVICE_DOWN_FOR_MAINTENANCE ErrorCode = "100009"
 	TOO_MANY_REQUESTS            ErrorCode = "100010"
+	CIRCUIT_BREAKER_OPEN         ErrorCode = "100011"
+	IDEMPOTENCY_KEY_IN_USE       ErrorCode = "100012"
+	IDEMPOTENCY_KEY_MISMATCH     ErrorCode = "100013"
+	UNKNOWN_TENANT               ErrorCode = "100014"
+	TENANT_UNAVAILABLE           ErrorCode = "100015"
 	UNKNOWN_ERROR_CODE           ErrorCode = "100098"
 	TIMEOUT                      ErrorCode = "100099"
 
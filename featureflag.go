@@ -0,0 +1,86 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"errors"
+
+	"github.com/retail-ai-inc/bean/v2/featureflag"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+)
+
+// InitFeatureFlags loads the feature flags, sets them as the default of `featureflag.Enabled` and keeps them
+// fresh until the shutdown. The server calls it if `featureFlags.on`; a command calls it after `InitDB`.
+func (b *Bean) InitFeatureFlags() error {
+	cfg := b.Config.FeatureFlags
+
+	var source featureflag.Source
+	switch cfg.Source {
+	case featureflag.SourceMySQL:
+		if b.DBConn == nil || b.DBConn.MasterMySQLDB == nil {
+			return errors.New("featureflag: the master mysql is required, call `InitDB` first")
+		}
+		s, err := featureflag.NewMySQLSource(b.DBConn.MasterMySQLDB)
+		if err != nil {
+			return err
+		}
+		source = s
+	default:
+		source = featureflag.NewConfigSource(cfg.Flags)
+	}
+
+	var conn *dbdrivers.RedisDBConn
+	if b.DBConn != nil {
+		conn = b.DBConn.MasterRedisDB
+	}
+	flags := featureflag.NewService(source, conn, cfg.RedisKey)
+
+	// IMPORTANT: The definitions of env.json are published at startup, so a deployment replaces the snapshot of
+	// the previous version instead of waiting for it to expire.
+	ctx := context.Background()
+	load := flags.Refresh
+	if cfg.Source != featureflag.SourceMySQL {
+		load = flags.Publish
+	}
+	if err := load(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go flags.Watch(ctx, cfg.RefreshInterval, func(err error) {
+		if l := blog.Logger(); l != nil {
+			l.Errorf("featureflag: %v", err)
+		}
+	})
+	b.OnShutdown("featureflag", func(context.Context) error {
+		cancel()
+		return nil
+	})
+
+	b.FeatureFlags = flags
+	featureflag.SetDefault(flags)
+
+	return nil
+}
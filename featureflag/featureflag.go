@@ -0,0 +1,323 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package featureflag rolls the features out per tenant. The flags are evaluated locally from a snapshot of their
+// definitions, which is shared by all the instances through redis.
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+const (
+	DefaultRedisKey        = "featureflags"
+	DefaultRefreshInterval = 30 * time.Second
+	DefaultTenantHeader    = "X-Tenant-ID"
+
+	// SnapshotTTL is the lifetime of the snapshot in redis. Once it expires, the next refresh loads the
+	// definitions from the source again, so the flags changed directly in the database are picked up too.
+	SnapshotTTL = 5 * time.Minute
+)
+
+// ErrReadOnly is returned when saving a flag of a source which is not a `Writer`, e.g. `env.json`.
+var ErrReadOnly = errors.New("featureflag: the source is read only")
+
+// Flag is on for every tenant if `Enabled`, otherwise for `Percentage` percent of the tenants. `Tenants` overrides
+// both per tenant ID.
+type Flag struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	Percentage  int             `json:"percentage,omitempty"`
+	Tenants     map[string]bool `json:"tenants,omitempty"`
+}
+
+// EnabledFor reports whether the flag is on for the tenant. A tenant is always in or out of a percentage rollout,
+// and the tenants of a smaller percentage stay in a larger one.
+func (f Flag) EnabledFor(tenantID string) bool {
+	if enabled, ok := f.Tenants[tenantID]; ok && tenantID != "" {
+		return enabled
+	}
+	if f.Enabled {
+		return true
+	}
+	if f.Percentage <= 0 || tenantID == "" {
+		return false
+	}
+
+	return bucket(f.Name, tenantID) < f.Percentage
+}
+
+// bucket returns the stable bucket, from 0 to 99, of a tenant for a flag.
+func bucket(name, tenantID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + "/" + tenantID))
+	return int(h.Sum32() % 100)
+}
+
+// Source provides the definitions of the flags.
+type Source interface {
+	Load(ctx context.Context) ([]Flag, error)
+}
+
+// Writer is a source whose flags can be changed, e.g. by the `flag` command.
+type Writer interface {
+	Save(ctx context.Context, flag Flag) error
+}
+
+type snapshot struct {
+	raw   string
+	flags map[string]Flag
+}
+
+// Service evaluates the flags.
+type Service struct {
+	source   Source
+	conn     *dbdrivers.RedisDBConn
+	key      string
+	snapshot atomic.Pointer[snapshot]
+}
+
+// NewService returns the flags of the source. If conn is nil, the snapshot is refreshed from the source directly.
+func NewService(source Source, conn *dbdrivers.RedisDBConn, key string) *Service {
+	if key == "" {
+		key = DefaultRedisKey
+	}
+
+	s := &Service{source: source, conn: conn, key: key}
+	s.snapshot.Store(&snapshot{flags: map[string]Flag{}})
+
+	return s
+}
+
+// Refresh updates the local snapshot from redis. The definitions are loaded from the source and published if
+// redis has no snapshot.
+func (s *Service) Refresh(ctx context.Context) error {
+	if s.conn == nil {
+		return s.load(ctx)
+	}
+
+	raw, err := s.conn.GetString(ctx, s.key)
+	if err != nil {
+		return err
+	}
+	if raw == "" {
+		return s.Publish(ctx)
+	}
+	if raw == s.snapshot.Load().raw {
+		return nil
+	}
+
+	return s.swap(raw)
+}
+
+// Publish loads the definitions from the source and shares them with all the instances through redis.
+func (s *Service) Publish(ctx context.Context) error {
+	flags, err := s.source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(flags)
+	if err != nil {
+		return err
+	}
+
+	if s.conn != nil {
+		if err := s.conn.Set(ctx, s.key, data, SnapshotTTL); err != nil {
+			return err
+		}
+	}
+
+	return s.swap(string(data))
+}
+
+// Watch refreshes the snapshot every interval until the context is done. The errors are passed to onError, if
+// any, and the last snapshot is kept.
+func (s *Service) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Refresh(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Save creates or updates a flag in the source and publishes the new definitions.
+func (s *Service) Save(ctx context.Context, flag Flag) error {
+	w, ok := s.source.(Writer)
+	if !ok {
+		return ErrReadOnly
+	}
+	if err := w.Save(ctx, flag); err != nil {
+		return err
+	}
+
+	return s.Publish(ctx)
+}
+
+// Flag returns the definition of a flag.
+func (s *Service) Flag(name string) (Flag, bool) {
+	f, ok := s.snapshot.Load().flags[name]
+	return f, ok
+}
+
+// Flags returns the definitions of the flags sorted by name.
+func (s *Service) Flags() []Flag {
+	flags := make([]Flag, 0, len(s.snapshot.Load().flags))
+	for _, f := range s.snapshot.Load().flags {
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+	return flags
+}
+
+// Enabled reports whether the flag is on for the tenant of the context. An unknown flag is off.
+func (s *Service) Enabled(ctx context.Context, name string) bool {
+	return s.EnabledFor(TenantFromContext(ctx), name)
+}
+
+// EnabledFor reports whether the flag is on for the tenant. An unknown flag is off.
+func (s *Service) EnabledFor(tenantID, name string) bool {
+	f, ok := s.Flag(name)
+	return ok && f.EnabledFor(tenantID)
+}
+
+func (s *Service) load(ctx context.Context) error {
+	flags, err := s.source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(flags)
+	if err != nil {
+		return err
+	}
+
+	return s.swap(string(data))
+}
+
+func (s *Service) swap(raw string) error {
+	var flags []Flag
+	if err := json.Unmarshal([]byte(raw), &flags); err != nil {
+		return err
+	}
+
+	m := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		m[f.Name] = f
+	}
+	s.snapshot.Store(&snapshot{raw: raw, flags: m})
+
+	return nil
+}
+
+var defaultService atomic.Pointer[Service]
+
+// SetDefault sets the service used by `Enabled` and the `featureEnabled` template function.
+func SetDefault(s *Service) {
+	defaultService.Store(s)
+}
+
+// Default returns the service set by `SetDefault`, or nil.
+func Default() *Service {
+	return defaultService.Load()
+}
+
+// Enabled reports whether the flag is on for the tenant of the context, using the default service. Every flag is
+// off if the feature flags are not initialized.
+func Enabled(ctx context.Context, name string) bool {
+	s := Default()
+	return s != nil && s.Enabled(ctx, name)
+}
+
+// TemplateFunc is the `featureEnabled` template function. The first argument is the `echo.Context` or the
+// `context.Context` of the request, e.g. `{{ if featureEnabled .ctx "new_checkout" }}`.
+func TemplateFunc(v interface{}, name string) bool {
+	switch ctx := v.(type) {
+	case echo.Context:
+		return Enabled(ctx.Request().Context(), name)
+	case context.Context:
+		return Enabled(ctx, name)
+	default:
+		return false
+	}
+}
+
+type tenantKey struct{}
+
+// NewContext returns a copy of the context which carries the tenant ID evaluated by `Enabled`.
+func NewContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID set by `NewContext`, or by the tenant middleware, or an empty string.
+func TenantFromContext(ctx context.Context) string {
+	if tenantID, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenantID
+	}
+	if id, ok := tenant.FromContext(ctx); ok {
+		return strconv.FormatUint(id, 10)
+	}
+	return ""
+}
+
+// Middleware sets the tenant ID of the header of the request in the request context. It is not needed with the
+// tenant middleware.
+func Middleware(header string) echo.MiddlewareFunc {
+	if header == "" {
+		header = DefaultTenantHeader
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if tenantID := c.Request().Header.Get(header); tenantID != "" {
+				req := c.Request()
+				c.SetRequest(req.WithContext(NewContext(req.Context(), tenantID)))
+			}
+			return next(c)
+		}
+	}
+}
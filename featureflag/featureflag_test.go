@@ -0,0 +1,187 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package featureflag
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySource is a writable source for the tests.
+type memorySource struct {
+	mu    sync.Mutex
+	flags map[string]Flag
+}
+
+func (s *memorySource) Load(context.Context) ([]Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flags := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+func (s *memorySource) Save(_ context.Context, flag Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flags[flag.Name] = flag
+	return nil
+}
+
+func newRedisConn(t *testing.T) (*dbdrivers.RedisDBConn, *miniredis.Miniredis) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return &dbdrivers.RedisDBConn{Primary: client}, s
+}
+
+func TestFlag_EnabledFor(t *testing.T) {
+	f := Flag{Name: "checkout", Tenants: map[string]bool{"1": true}}
+	assert.True(t, f.EnabledFor("1"))
+	assert.False(t, f.EnabledFor("2"))
+	assert.False(t, f.EnabledFor(""))
+
+	f.Enabled = true
+	f.Tenants["2"] = false
+	assert.True(t, f.EnabledFor("3"))
+	assert.True(t, f.EnabledFor(""))
+	assert.False(t, f.EnabledFor("2"))
+
+	// The tenants of a percentage stay in the larger ones.
+	f = Flag{Name: "checkout"}
+	enabled := func(percentage int) map[string]bool {
+		f.Percentage = percentage
+		in := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			if id := strconv.Itoa(i); f.EnabledFor(id) {
+				in[id] = true
+			}
+		}
+		return in
+	}
+
+	none, quarter, half, all := enabled(0), enabled(25), enabled(50), enabled(100)
+	assert.Empty(t, none)
+	assert.Len(t, all, 1000)
+	assert.InDelta(t, 250, len(quarter), 50)
+	assert.InDelta(t, 500, len(half), 50)
+	for id := range quarter {
+		assert.True(t, half[id], id)
+	}
+	assert.False(t, f.EnabledFor(""))
+}
+
+func TestService_Redis(t *testing.T) {
+	conn, s := newRedisConn(t)
+	ctx := context.Background()
+
+	source := &memorySource{flags: map[string]Flag{"checkout": {Name: "checkout", Tenants: map[string]bool{"1": true}}}}
+	first := NewService(source, conn, "flags")
+	second := NewService(source, conn, "flags")
+
+	// The first refresh publishes the definitions.
+	require.NoError(t, first.Refresh(ctx))
+	assert.True(t, s.Exists("flags"))
+	assert.Equal(t, SnapshotTTL, s.TTL("flags"))
+	assert.True(t, first.EnabledFor("1", "checkout"))
+	assert.False(t, first.EnabledFor("1", "unknown"))
+
+	require.NoError(t, second.Refresh(ctx))
+	assert.Equal(t, []Flag{{Name: "checkout", Tenants: map[string]bool{"1": true}}}, second.Flags())
+
+	// A flag saved by an instance is picked up by the others at their next refresh.
+	require.NoError(t, first.Save(ctx, Flag{Name: "search", Enabled: true}))
+	assert.True(t, first.EnabledFor("", "search"))
+	assert.False(t, second.EnabledFor("", "search"))
+
+	require.NoError(t, second.Refresh(ctx))
+	assert.True(t, second.EnabledFor("", "search"))
+
+	// The snapshot is kept if redis is down.
+	s.Close()
+	assert.Error(t, second.Refresh(ctx))
+	assert.True(t, second.EnabledFor("", "search"))
+}
+
+func TestService_Watch(t *testing.T) {
+	conn, s := newRedisConn(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flags := NewService(NewConfigSource(nil), conn, "")
+	require.NoError(t, flags.Refresh(ctx))
+	assert.Empty(t, flags.Flags())
+
+	go flags.Watch(ctx, 10*time.Millisecond, nil)
+
+	s.Set(DefaultRedisKey, `[{"name":"checkout","enabled":true}]`)
+	assert.Eventually(t, func() bool {
+		return flags.EnabledFor("1", "checkout")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestService_ConfigSource(t *testing.T) {
+	flags := NewService(NewConfigSource([]config.FeatureFlag{
+		{Name: "checkout", Percentage: 100},
+		{Name: "search", Tenants: map[string]bool{"2": true}},
+	}), nil, "")
+	require.NoError(t, flags.Refresh(context.Background()))
+
+	ctx := NewContext(context.Background(), "2")
+	assert.True(t, flags.Enabled(ctx, "checkout"))
+	assert.True(t, flags.Enabled(ctx, "search"))
+	assert.False(t, flags.Enabled(context.Background(), "search"))
+
+	assert.ErrorIs(t, flags.Save(ctx, Flag{Name: "search"}), ErrReadOnly)
+}
+
+func TestEnabled_Default(t *testing.T) {
+	t.Cleanup(func() { SetDefault(nil) })
+
+	ctx := NewContext(context.Background(), "1")
+	assert.False(t, Enabled(ctx, "checkout"))
+
+	flags := NewService(NewConfigSource([]config.FeatureFlag{{Name: "checkout", Tenants: map[string]bool{"1": true}}}), nil, "")
+	require.NoError(t, flags.Refresh(ctx))
+	SetDefault(flags)
+
+	e := echo.New()
+	e.Use(Middleware(""))
+	e.GET("/", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]bool{
+			"service":  Enabled(c.Request().Context(), "checkout"),
+			"template": TemplateFunc(c, "checkout"),
+		})
+	})
+
+	for tenantID, want := range map[string]string{"1": `{"service":true,"template":true}`, "2": `{"service":false,"template":false}`} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultTenantHeader, tenantID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.JSONEq(t, want, rec.Body.String(), tenantID)
+	}
+
+	assert.True(t, TemplateFunc(ctx, "checkout"))
+	assert.False(t, TemplateFunc(nil, "checkout"))
+}
@@ -0,0 +1,158 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/retail-ai-inc/bean/v2/config"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The sources of the definitions.
+const (
+	SourceConfig = "config"
+	SourceMySQL  = "mysql"
+)
+
+type configSource struct {
+	flags []Flag
+}
+
+// NewConfigSource returns the flags defined in `featureFlags.flags` of env.json.
+func NewConfigSource(defs []config.FeatureFlag) Source {
+	flags := make([]Flag, 0, len(defs))
+	for _, d := range defs {
+		flags = append(flags, Flag{
+			Name:        d.Name,
+			Description: d.Description,
+			Enabled:     d.Enabled,
+			Percentage:  d.Percentage,
+			Tenants:     d.Tenants,
+		})
+	}
+
+	return &configSource{flags: flags}
+}
+
+func (s *configSource) Load(context.Context) ([]Flag, error) {
+	return s.flags, nil
+}
+
+// FeatureFlags represents a flag record in the master database, alongside `TenantConnections`.
+type FeatureFlags struct {
+	ID          uint64         `gorm:"primary_key;AUTO_INCREMENT;column:Id"`
+	Name        string         `gorm:"type:VARCHAR(100);not null;unique;column:Name"`
+	Description string         `gorm:"type:VARCHAR(255);not null;default:'';column:Description"`
+	Enabled     bool           `gorm:"not null;default:false;column:Enabled"`
+	Percentage  int            `gorm:"not null;default:0;column:Percentage"`
+	Tenants     datatypes.JSON `gorm:"column:Tenants"`
+	CreatedAt   time.Time      `gorm:"type:timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP;column:CreatedAt"`
+	UpdatedAt   time.Time      `gorm:"type:timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;column:UpdatedAt"`
+}
+
+func (FeatureFlags) TableName() string {
+	return "FeatureFlags"
+}
+
+type mysqlSource struct {
+	db *gorm.DB
+}
+
+// createFeatureFlagsPostgres is the PostgreSQL version of the DDL of `FeatureFlags`, whose gorm tags are MySQL
+// specific.
+const createFeatureFlagsPostgres = `CREATE TABLE IF NOT EXISTS "FeatureFlags" (
+	"Id" BIGSERIAL PRIMARY KEY,
+	"Name" VARCHAR(100) NOT NULL UNIQUE,
+	"Description" VARCHAR(255) NOT NULL DEFAULT '',
+	"Enabled" BOOLEAN NOT NULL DEFAULT FALSE,
+	"Percentage" BIGINT NOT NULL DEFAULT 0,
+	"Tenants" JSONB,
+	"CreatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	"UpdatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// NewMySQLSource returns the flags of the `FeatureFlags` table of the master database, MySQL or PostgreSQL. The
+// table is created if it does not exist.
+func NewMySQLSource(db *gorm.DB) (Source, error) {
+	if db.Dialector.Name() == "postgres" {
+		if err := db.Exec(createFeatureFlagsPostgres).Error; err != nil {
+			return nil, err
+		}
+	} else if !db.Migrator().HasTable(&FeatureFlags{}) {
+		if err := db.Migrator().CreateTable(&FeatureFlags{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &mysqlSource{db: db}, nil
+}
+
+func (s *mysqlSource) Load(ctx context.Context) ([]Flag, error) {
+	var records []*FeatureFlags
+	if err := s.db.WithContext(ctx).Order(clause.OrderByColumn{Column: clause.Column{Name: "Name"}}).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	flags := make([]Flag, 0, len(records))
+	for _, r := range records {
+		f := Flag{
+			Name:        r.Name,
+			Description: r.Description,
+			Enabled:     r.Enabled,
+			Percentage:  r.Percentage,
+		}
+		if len(r.Tenants) > 0 {
+			if err := json.Unmarshal(r.Tenants, &f.Tenants); err != nil {
+				return nil, err
+			}
+		}
+		flags = append(flags, f)
+	}
+
+	return flags, nil
+}
+
+func (s *mysqlSource) Save(ctx context.Context, flag Flag) error {
+	tenants, err := json.Marshal(flag.Tenants)
+	if err != nil {
+		return err
+	}
+
+	record := &FeatureFlags{
+		Name:        flag.Name,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Percentage:  flag.Percentage,
+		Tenants:     tenants,
+	}
+
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "Name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"Description", "Enabled", "Percentage", "Tenants"}),
+	}).Create(record).Error
+}
@@ -0,0 +1,244 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/gorm"
+)
+
+const (
+	healthStatusOK           = "ok"
+	healthStatusDegraded     = "degraded"
+	healthStatusUnavailable  = "unavailable"
+	healthStatusShuttingDown = "shutting_down"
+)
+
+// HealthCheckFunc reports whether a dependency is healthy by returning a nil error.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheckResult is the result of a single readiness check.
+type HealthCheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthResponse is the JSON body of the liveness and readiness endpoints. `UnavailableTenants` holds the error
+// of the tenants whose connections could not be opened, by tenant ID.
+type HealthResponse struct {
+	Status             string                       `json:"status"`
+	Checks             map[string]HealthCheckResult `json:"checks,omitempty"`
+	UnavailableTenants map[string]string            `json:"unavailableTenants,omitempty"`
+}
+
+// AddHealthCheck registers a custom readiness check in addition to the database checks.
+func (b *Bean) AddHealthCheck(name string, check HealthCheckFunc) {
+	b.healthChecksMu.Lock()
+	defer b.healthChecksMu.Unlock()
+
+	if b.healthChecks == nil {
+		b.healthChecks = make(map[string]HealthCheckFunc)
+	}
+	b.healthChecks[name] = check
+}
+
+// LivenessHandler reports that the process is up and able to serve HTTP requests.
+func (b *Bean) LivenessHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthResponse{Status: healthStatusOK})
+}
+
+// ReadinessHandler pings every database connection in `DBDeps` and the custom checks, each with
+// `health.timeout`. It returns `503 Service Unavailable` if any check fails or the server is shutting down.
+// The tenants whose connections could not be opened do not fail it, the status is `degraded` instead, so the
+// healthy tenants keep being served.
+func (b *Bean) ReadinessHandler(c echo.Context) error {
+	if b.shuttingDown.Load() {
+		return c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: healthStatusShuttingDown})
+	}
+
+	results := b.runHealthChecks(c.Request().Context())
+
+	resp := HealthResponse{Status: healthStatusOK, Checks: results}
+	code := http.StatusOK
+	if d := b.DBConn; d != nil {
+		for _, f := range d.Tenants().Failures() {
+			if resp.UnavailableTenants == nil {
+				resp.UnavailableTenants = make(map[string]string)
+			}
+			resp.UnavailableTenants[strconv.FormatUint(f.ID, 10)] = f.Err.Error()
+			resp.Status = healthStatusDegraded
+		}
+	}
+
+	for _, r := range results {
+		if r.Status != healthStatusOK {
+			resp.Status = healthStatusUnavailable
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	return c.JSON(code, resp)
+}
+
+func (b *Bean) runHealthChecks(ctx context.Context) map[string]HealthCheckResult {
+	checks := b.collectHealthChecks()
+
+	timeout := b.Config.Health.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]HealthCheckResult, len(checks))
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheckFunc) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runHealthCheck(checkCtx, check)
+			result := HealthCheckResult{Status: healthStatusOK, Latency: time.Since(start).String()}
+			if err != nil {
+				result.Status = healthStatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runHealthCheck returns as soon as the context is done even if the check ignores the context.
+func runHealthCheck(ctx context.Context, check HealthCheckFunc) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- check(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bean) collectHealthChecks() map[string]HealthCheckFunc {
+	checks := make(map[string]HealthCheckFunc)
+
+	if d := b.DBConn; d != nil {
+		if d.MasterMySQLDB != nil {
+			// IMPORTANT: Named after the driver, `mysql` or `postgres`.
+			checks[d.MasterMySQLDB.Dialector.Name()] = pingMySQL(d.MasterMySQLDB)
+		}
+		if d.MasterMongoDB != nil {
+			checks["mongo"] = pingMongo(d.MasterMongoDB)
+		}
+		if d.MasterRedisDB != nil {
+			checks["redis"] = pingRedis(d.MasterRedisDB)
+		}
+
+		if b.Config.Health.CheckTenants {
+			// In the lazy mode, only the tenants with open connections are checked.
+			for _, conns := range d.Tenants().All() {
+				id := strconv.FormatUint(conns.ID, 10)
+				if conns.MySQLDB != nil {
+					checks[conns.MySQLDB.Dialector.Name()+".tenant."+id] = pingMySQL(conns.MySQLDB)
+				}
+				if conns.MongoDB != nil {
+					checks["mongo.tenant."+id] = pingMongo(conns.MongoDB)
+				}
+				if conns.RedisDB != nil {
+					checks["redis.tenant."+id] = pingRedis(conns.RedisDB)
+				}
+			}
+		}
+	}
+
+	b.healthChecksMu.RLock()
+	for name, check := range b.healthChecks {
+		checks[name] = check
+	}
+	b.healthChecksMu.RUnlock()
+
+	return checks
+}
+
+func pingMySQL(db *gorm.DB) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+func pingMongo(client *mongo.Client) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
+}
+
+func pingRedis(conn *dbdrivers.RedisDBConn) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return conn.Primary.Ping(ctx).Err()
+	}
+}
+
+// healthPaths returns the liveness and readiness paths, `/healthz` and `/readyz` by default.
+func healthPaths() (livenessPath, readinessPath string) {
+	livenessPath = config.Bean.Health.LivenessPath
+	if livenessPath == "" {
+		livenessPath = "/healthz"
+	}
+
+	readinessPath = config.Bean.Health.ReadinessPath
+	if readinessPath == "" {
+		readinessPath = "/readyz"
+	}
+
+	return livenessPath, readinessPath
+}
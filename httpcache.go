@@ -0,0 +1,55 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"errors"
+
+	"github.com/retail-ai-inc/bean/v2/httpcache"
+	"github.com/retail-ai-inc/bean/v2/store/memory"
+)
+
+// useHTTPCache adds the response cache middleware. The responses are kept in the memory database unless `store`
+// is `redis`, then they are shared by all the instances through the master redis.
+func (b *Bean) useHTTPCache() error {
+	var store httpcache.Store
+	switch b.Config.HTTPCache.Store {
+	case httpcache.StoreRedis:
+		if b.DBConn == nil || b.DBConn.MasterRedisDB == nil {
+			return errors.New("httpcache: the master redis is required, call `InitDB` first")
+		}
+		store = httpcache.NewRedisStore(b.DBConn.MasterRedisDB)
+	default:
+		// The memory cache is a singleton, so the entries can be deleted through `DBConn.MemoryDB` as well.
+		cache := memory.NewMemoryCache()
+		if b.DBConn != nil && b.DBConn.MemoryDB != nil {
+			cache = b.DBConn.MemoryDB
+		}
+		store = httpcache.NewMemoryStore(cache)
+	}
+
+	b.HTTPCache = httpcache.New(b.Config.HTTPCache, store)
+	b.Echo.Use(b.HTTPCache.Middleware())
+
+	return nil
+}
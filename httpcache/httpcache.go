@@ -0,0 +1,366 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+const (
+	DefaultPrefix       = "httpcache"
+	DefaultTTL          = time.Minute
+	DefaultTenantHeader = "X-Tenant-ID"
+
+	// HeaderCache is set to `HIT` or `MISS` on the responses of the cached routes.
+	HeaderCache = "X-Cache"
+
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// AllTenants invalidates the responses of every tenant.
+const AllTenants = "*"
+
+// The headers which are never stored with a response.
+var skippedHeaders = []string{
+	echo.HeaderSetCookie,
+	echo.HeaderXRequestID,
+	"Date",
+	"Age",
+	HeaderCache,
+}
+
+type route struct {
+	ttl         time.Duration
+	varyHeaders []string
+}
+
+// Cache is the response cache of the configured routes.
+type Cache struct {
+	store        Store
+	prefix       string
+	tenantHeader string
+	routes       map[string]route
+}
+
+// New returns the response cache of the `httpCache` config.
+func New(cfg config.HTTPCache, store Store) *Cache {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	tenantHeader := cfg.TenantHeader
+	if tenantHeader == "" {
+		tenantHeader = DefaultTenantHeader
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	routes := make(map[string]route, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		rt := route{ttl: ttl}
+		if r.TTL > 0 {
+			rt.ttl = r.TTL
+		}
+		varyHeaders := cfg.VaryHeaders
+		if len(r.VaryHeaders) > 0 {
+			varyHeaders = r.VaryHeaders
+		}
+		for _, h := range varyHeaders {
+			rt.varyHeaders = append(rt.varyHeaders, http.CanonicalHeaderKey(h))
+		}
+		routes[r.Path] = rt
+	}
+
+	return &Cache{
+		store:        store,
+		prefix:       prefix,
+		tenantHeader: tenantHeader,
+		routes:       routes,
+	}
+}
+
+// Key returns the key of the response of a request path. It looks like
+// `<prefix>:<tenant>:<path>|<sorted query>|<hash of the vary headers>`, so all the variants of a path are matched by
+// `<prefix>:<tenant>:<path>|*`, e.g. with the `delKeyAPI` end point of the memory database.
+func (ch *Cache) Key(tenantID, path, query, vary string) string {
+	return ch.prefix + ":" + tenantID + ":" + path + "|" + query + "|" + vary
+}
+
+// Invalidate deletes the cached responses of a request path, e.g. `/products/42`, for every query and vary
+// header. The path can have a wildcard (`*`), e.g. `/products/*`. Use `AllTenants` to invalidate the responses of
+// every tenant.
+func (ch *Cache) Invalidate(ctx context.Context, tenantID, path string) error {
+	return ch.store.Delete(ctx, ch.prefix+":"+tenantID+":"+path+"|*")
+}
+
+// Middleware caches the `200 OK` responses of the `GET` requests of the configured routes. It honors the
+// `Cache-Control` header of the request and of the response, sets a strong `ETag` and answers `If-None-Match`
+// with `304 Not Modified`.
+func (ch *Cache) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			rt, ok := ch.routes[c.Path()]
+			if !ok || req.Method != http.MethodGet {
+				return next(c)
+			}
+
+			reqCC := parseCacheControl(req.Header.Get(echo.HeaderCacheControl))
+			if _, ok := reqCC["no-store"]; ok {
+				return next(c)
+			}
+
+			if len(rt.varyHeaders) > 0 {
+				c.Response().Header().Add(echo.HeaderVary, strings.Join(rt.varyHeaders, ", "))
+			}
+
+			ctx := req.Context()
+			key := ch.Key(tenant.FromRequest(req, ch.tenantHeader), req.URL.Path, req.URL.Query().Encode(), varyHash(req, rt.varyHeaders))
+
+			// `no-cache` and `max-age=0` ask for a fresh response, which is stored for the next requests.
+			_, noCache := reqCC["no-cache"]
+			if !noCache && reqCC["max-age"] != "0" {
+				entry, ok, err := ch.store.Get(ctx, key)
+				if err != nil {
+					c.Logger().Errorf("httpcache: %v", err)
+				} else if ok {
+					return hit(c, entry)
+				}
+			}
+
+			res := c.Response()
+			writer := res.Writer
+			rec := &recorder{ResponseWriter: writer, status: http.StatusOK}
+			res.Writer = rec
+			err := next(c)
+			res.Writer = writer
+
+			if rec.passthrough || !res.Committed {
+				return err
+			}
+
+			h := res.Header()
+			h.Set(HeaderCache, "MISS")
+			body := rec.body.Bytes()
+			if rec.status == http.StatusOK && h.Get(headerETag) == "" {
+				h.Set(headerETag, etagOf(body))
+			}
+
+			if ttl, ok := storable(rec.status, h, rt.ttl); ok && err == nil {
+				entry := &Entry{
+					Status:   rec.status,
+					Header:   storedHeader(h),
+					Body:     body,
+					ETag:     h.Get(headerETag),
+					StoredAt: time.Now(),
+				}
+				if err := ch.store.Set(ctx, key, entry, ttl); err != nil {
+					c.Logger().Errorf("httpcache: %v", err)
+				}
+			}
+
+			if rec.status == http.StatusOK && matchETag(req.Header.Get(headerIfNoneMatch), h.Get(headerETag)) {
+				notModified(writer, h)
+				return err
+			}
+
+			writer.WriteHeader(rec.status)
+			if _, werr := writer.Write(body); werr != nil && err == nil {
+				err = werr
+			}
+
+			return err
+		}
+	}
+}
+
+func hit(c echo.Context, entry *Entry) error {
+	res := c.Response()
+	h := res.Header()
+	for k, v := range entry.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(HeaderCache, "HIT")
+	h.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+
+	if matchETag(c.Request().Header.Get(headerIfNoneMatch), entry.ETag) {
+		res.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	res.WriteHeader(entry.Status)
+	_, err := res.Write(entry.Body)
+	return err
+}
+
+// notModified writes a `304 Not Modified` response, which has no body.
+func notModified(w http.ResponseWriter, h http.Header) {
+	h.Del(echo.HeaderContentLength)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// storable returns the TTL of a response, or false if it must not be stored.
+func storable(status int, h http.Header, ttl time.Duration) (time.Duration, bool) {
+	if status != http.StatusOK || h.Get(echo.HeaderSetCookie) != "" {
+		return 0, false
+	}
+
+	cc := parseCacheControl(h.Get(echo.HeaderCacheControl))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0, false
+		}
+	}
+
+	// `s-maxage` is meant for the shared caches, so it wins over `max-age`.
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil {
+				continue
+			}
+			ttl = time.Duration(secs) * time.Second
+			break
+		}
+	}
+
+	return ttl, ttl > 0
+}
+
+func storedHeader(h http.Header) map[string][]string {
+	stored := h.Clone()
+	for _, k := range skippedHeaders {
+		stored.Del(k)
+	}
+	return stored
+}
+
+// parseCacheControl returns the directives of a `Cache-Control` header, in lower case, with their value if any.
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+// matchETag reports whether the `If-None-Match` header matches the ETag. The comparison is weak, as RFC 9110
+// requires for `If-None-Match`.
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagOf returns the strong ETag of a body.
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func varyHash(req *http.Request, headers []string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, name := range headers {
+		h.Write([]byte(name + ":" + strings.Join(req.Header.Values(name), ",") + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// recorder buffers the response to set the `ETag` before the body is sent. A streamed (flushed or hijacked)
+// response is passed through and never stored.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	passthrough bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.passthrough {
+		return r.ResponseWriter.Write(b)
+	}
+	return r.body.Write(b)
+}
+
+func (r *recorder) Flush() {
+	if !r.passthrough {
+		r.passthrough = true
+		r.ResponseWriter.WriteHeader(r.status)
+		if _, err := r.ResponseWriter.Write(r.body.Bytes()); err != nil {
+			return
+		}
+		r.body.Reset()
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.passthrough = true
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,227 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/store/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisStore(t *testing.T) (Store, *miniredis.Miniredis) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewRedisStore(&dbdrivers.RedisDBConn{Primary: client}), s
+}
+
+// newTestEcho serves `/products/:id`, which counts its calls, with the cache in front of it.
+func newTestEcho(cfg config.HTTPCache, store Store, handle func(c echo.Context) error) (*echo.Echo, *Cache, *atomic.Int32) {
+	cache := New(cfg, store)
+	calls := new(atomic.Int32)
+
+	e := echo.New()
+	e.Use(cache.Middleware())
+	e.GET("/products/:id", func(c echo.Context) error {
+		n := calls.Add(1)
+		if handle != nil {
+			return handle(c)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id"), "call": n})
+	})
+
+	return e, cache, calls
+}
+
+func get(e *echo.Echo, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_HitAndConditional(t *testing.T) {
+	store, _ := newRedisStore(t)
+	e, _, calls := newTestEcho(config.HTTPCache{
+		Routes: []config.HTTPCacheRoute{{Path: "/products/:id", VaryHeaders: []string{"accept-language"}}},
+	}, store, nil)
+
+	first := get(e, "/products/1?b=2&a=1")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "MISS", first.Header().Get(HeaderCache))
+	assert.Equal(t, "Accept-Language", first.Header().Get(echo.HeaderVary))
+	etag := first.Header().Get("ETag")
+	assert.Equal(t, etagOf(first.Body.Bytes()), etag)
+
+	// The order of the query does not matter.
+	second := get(e, "/products/1?a=1&b=2")
+	assert.Equal(t, "HIT", second.Header().Get(HeaderCache))
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+	assert.Equal(t, echo.MIMEApplicationJSON, second.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	notModified := get(e, "/products/1?a=1&b=2", "If-None-Match", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+
+	// A different query or vary header is another response.
+	assert.Equal(t, "MISS", get(e, "/products/1").Header().Get(HeaderCache))
+	assert.Equal(t, "MISS", get(e, "/products/1?a=1&b=2", "Accept-Language", "ja").Header().Get(HeaderCache))
+	assert.Equal(t, int32(3), calls.Load())
+
+	// The fresh response of a miss is conditional too.
+	rec := get(e, "/products/2", "If-None-Match", "*")
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderCache))
+}
+
+func TestMiddleware_CacheControl(t *testing.T) {
+	store, s := newRedisStore(t)
+
+	var cacheControl atomic.Value
+	cacheControl.Store("")
+	e, _, calls := newTestEcho(config.HTTPCache{
+		TTL:    time.Hour,
+		Routes: []config.HTTPCacheRoute{{Path: "/products/:id"}},
+	}, store, func(c echo.Context) error {
+		if cc := cacheControl.Load().(string); cc != "" {
+			c.Response().Header().Set(echo.HeaderCacheControl, cc)
+		}
+		return c.String(http.StatusOK, "product")
+	})
+
+	get(e, "/products/1")
+	assert.Equal(t, time.Hour, s.TTL("httpcache::/products/1||"))
+
+	// `no-store` bypasses the cache.
+	rec := get(e, "/products/1", echo.HeaderCacheControl, "no-store")
+	assert.Empty(t, rec.Header().Get(HeaderCache))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// `no-cache` fetches a fresh response.
+	assert.Equal(t, "MISS", get(e, "/products/1", echo.HeaderCacheControl, "no-cache").Header().Get(HeaderCache))
+	assert.Equal(t, "MISS", get(e, "/products/1", echo.HeaderCacheControl, "max-age=0").Header().Get(HeaderCache))
+	assert.Equal(t, "HIT", get(e, "/products/1").Header().Get(HeaderCache))
+	assert.Equal(t, int32(4), calls.Load())
+
+	cacheControl.Store("public, max-age=60, s-maxage=30")
+	get(e, "/products/2")
+	assert.Equal(t, 30*time.Second, s.TTL("httpcache::/products/2||"))
+
+	cacheControl.Store("private, max-age=60")
+	get(e, "/products/3")
+	assert.False(t, s.Exists("httpcache::/products/3||"))
+}
+
+func TestMiddleware_NotStored(t *testing.T) {
+	store, s := newRedisStore(t)
+
+	e, _, _ := newTestEcho(config.HTTPCache{
+		Routes: []config.HTTPCacheRoute{{Path: "/products/:id"}},
+	}, store, func(c echo.Context) error {
+		switch c.Param("id") {
+		case "cookie":
+			c.SetCookie(&http.Cookie{Name: "session", Value: "s"})
+			return c.String(http.StatusOK, "product")
+		case "missing":
+			return c.String(http.StatusNotFound, "missing")
+		default:
+			return echo.NewHTTPError(http.StatusBadGateway)
+		}
+	})
+	e.GET("/categories", func(c echo.Context) error {
+		return c.String(http.StatusOK, "categories")
+	})
+
+	for _, target := range []string{"/products/cookie", "/products/missing", "/products/error", "/categories"} {
+		get(e, target)
+	}
+	assert.Empty(t, s.Keys())
+
+	rec := get(e, "/products/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "missing", rec.Body.String())
+	assert.Equal(t, http.StatusBadGateway, get(e, "/products/error").Code)
+	assert.Empty(t, get(e, "/categories").Header().Get(HeaderCache))
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	store, s := newRedisStore(t)
+	e, cache, calls := newTestEcho(config.HTTPCache{
+		Prefix: "shop",
+		Routes: []config.HTTPCacheRoute{{Path: "/products/:id"}},
+	}, store, nil)
+
+	for _, tenantID := range []string{"1", "2"} {
+		for _, target := range []string{"/products/1", "/products/1?page=2", "/products/10", "/products/[2]"} {
+			get(e, target, DefaultTenantHeader, tenantID)
+		}
+	}
+	require.Len(t, s.Keys(), 8)
+
+	ctx := context.Background()
+	require.NoError(t, cache.Invalidate(ctx, "1", "/products/1"))
+	assert.ElementsMatch(t, []string{
+		"shop:1:/products/10||",
+		"shop:1:/products/[2]||",
+		"shop:2:/products/1||",
+		"shop:2:/products/1|page=2|",
+		"shop:2:/products/10||",
+		"shop:2:/products/[2]||",
+	}, s.Keys())
+
+	// The glob characters of redis other than `*` are literal.
+	require.NoError(t, cache.Invalidate(ctx, AllTenants, "/products/[2]"))
+	require.NoError(t, cache.Invalidate(ctx, "2", "/products/*"))
+	assert.Equal(t, []string{"shop:1:/products/10||"}, s.Keys())
+
+	n := calls.Load()
+	assert.Equal(t, "MISS", get(e, "/products/1", DefaultTenantHeader, "1").Header().Get(HeaderCache))
+	assert.Equal(t, n+1, calls.Load())
+}
+
+func TestMemoryStore(t *testing.T) {
+	m := memory.NewMemoryCache()
+	prefix := "test_httpcache_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	e, cache, calls := newTestEcho(config.HTTPCache{
+		Store:  StoreMemory,
+		Prefix: prefix,
+		Routes: []config.HTTPCacheRoute{{Path: "/products/:id"}},
+	}, NewMemoryStore(m), nil)
+
+	get(e, "/products/1")
+	get(e, "/products/2")
+	assert.Equal(t, "HIT", get(e, "/products/1").Header().Get(HeaderCache))
+
+	_, ok := m.GetMemory(cache.Key("", "/products/1", "", ""))
+	assert.True(t, ok)
+
+	require.NoError(t, cache.Invalidate(context.Background(), "", "/products/1"))
+	assert.Equal(t, "MISS", get(e, "/products/1").Header().Get(HeaderCache))
+	assert.Equal(t, "HIT", get(e, "/products/2").Header().Get(HeaderCache))
+
+	// The entries can be deleted with the wildcard of `DelMemory`, like the `delKeyAPI` end point does.
+	m.DelMemory(prefix + ":*")
+	assert.Equal(t, "MISS", get(e, "/products/2").Header().Get(HeaderCache))
+	assert.Equal(t, int32(4), calls.Load())
+}
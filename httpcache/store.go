@@ -0,0 +1,157 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package httpcache caches the responses of the `GET` routes in the memory store or in redis, and answers the
+// conditional requests with `304 Not Modified` thanks to strong ETags.
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/store/memory"
+)
+
+// The stores of the responses.
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Status   int                 `json:"status"`
+	Header   map[string][]string `json:"header"`
+	Body     []byte              `json:"body"`
+	ETag     string              `json:"etag"`
+	StoredAt time.Time           `json:"storedAt"`
+}
+
+// Store keeps the cached responses.
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, bool, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	// Delete deletes the key, or all the keys matching the pattern if it has a wildcard (`*`).
+	Delete(ctx context.Context, pattern string) error
+}
+
+type memoryStore struct {
+	cache memory.Cache
+}
+
+// NewMemoryStore returns a store which keeps the responses in the memory cache, e.g. `DBConn.MemoryDB`. The
+// entries can be deleted with `DelMemory` and the `delKeyAPI` endpoint too.
+func NewMemoryStore(cache memory.Cache) Store {
+	return &memoryStore{cache: cache}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (*Entry, bool, error) {
+	v, ok := s.cache.GetMemory(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry, ok := v.(*Entry)
+	return entry, ok, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	s.cache.SetMemory(key, entry, ttl)
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, pattern string) error {
+	s.cache.DelMemory(pattern)
+	return nil
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+type redisStore struct {
+	conn *dbdrivers.RedisDBConn
+}
+
+// NewRedisStore returns a store which shares the responses between all the instances.
+func NewRedisStore(conn *dbdrivers.RedisDBConn) Store {
+	return &redisStore{conn: conn}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (*Entry, bool, error) {
+	data, err := s.conn.GetString(ctx, key)
+	if err != nil || data == "" {
+		return nil, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return nil, false, err
+	}
+
+	return &entry, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return s.conn.Set(ctx, key, data, ttl)
+}
+
+func (s *redisStore) Delete(ctx context.Context, pattern string) error {
+	if !strings.Contains(pattern, "*") {
+		return s.conn.DelKey(ctx, pattern)
+	}
+
+	// Like `DelMemory`, only `*` is a wildcard, the other glob characters of redis are matched literally.
+	pattern = globEscaper.Replace(pattern)
+
+	// IMPORTANT: Use `SCAN` rather than `KEYS`, which blocks the server. In a cluster, every master is scanned.
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, pattern, 1000).Iterator()
+		pipe := client.Pipeline()
+		for iter.Next(ctx) {
+			pipe.Unlink(ctx, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		if pipe.Len() == 0 {
+			return nil
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+
+	if cluster, ok := s.conn.Primary.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	}
+
+	return scan(ctx, s.conn.Primary)
+}
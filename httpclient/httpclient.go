@@ -0,0 +1,287 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package httpclient builds the named outgoing HTTP clients of `env.json`. The clients retry with a jittered
+// exponential backoff, propagate the Sentry trace headers and the `X-Request-ID` of the incoming request, add a
+// Sentry span and record the Prometheus metrics of every outgoing call.
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/retail-ai-inc/bean/v2/circuitbreaker"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+)
+
+const (
+	DefaultTimeout         = 30 * time.Second
+	DefaultDialTimeout     = 5 * time.Second
+	DefaultRetryMinBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 2 * time.Second
+)
+
+// DefaultRetryOnStatus are the response status codes retried if `retryOnStatus` is not set.
+var DefaultRetryOnStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+var (
+	clientsMu sync.RWMutex
+	clients   = make(map[string]*resty.Client)
+)
+
+type options struct {
+	transport http.RoundTripper
+}
+
+// Option configures `New`.
+type Option func(*options)
+
+// WithTransport replaces the transport built from the config, e.g. by `bean.NetHttpFastTransporter`. The
+// connection limits and the timeouts of the transport are not applied then.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// New returns a client built from the config.
+func New(cfg config.HTTPClient, opts ...Option) *resty.Client {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	base := o.transport
+	if base == nil {
+		base = newTransport(cfg)
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	var rt http.RoundTripper = &instrumentedTransport{client: cfg.Name, next: base}
+	if cfg.CircuitBreaker.On {
+		// IMPORTANT: The rejected calls are not sent, so they are not instrumented either.
+		group := circuitbreaker.NewGroup("http:"+cfg.Name, circuitbreaker.SettingsFromConfig(cfg.CircuitBreaker))
+		rt = circuitbreaker.Transport(group, rt)
+	}
+
+	client := resty.NewWithClient(&http.Client{
+		Transport: rt,
+		Timeout:   timeout,
+	})
+
+	if cfg.BaseURL != "" {
+		client.SetBaseURL(cfg.BaseURL)
+	}
+	for k, v := range cfg.Headers {
+		client.SetHeader(k, v)
+	}
+
+	if cfg.RetryCount > 0 {
+		setRetry(client, cfg)
+	}
+
+	return client
+}
+
+func newTransport(cfg config.HTTPClient) *http.Transport {
+	dialTimeout := cfg.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	if cfg.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+
+	return t
+}
+
+func setRetry(client *resty.Client, cfg config.HTTPClient) {
+	minBackoff, maxBackoff := cfg.RetryMinBackoff, cfg.RetryMaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultRetryMinBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = DefaultRetryMaxBackoff
+		if maxBackoff < minBackoff {
+			maxBackoff = minBackoff
+		}
+	}
+
+	retryOnStatus := cfg.RetryOnStatus
+	if len(retryOnStatus) == 0 {
+		retryOnStatus = DefaultRetryOnStatus
+	}
+	statuses := make(map[int]bool, len(retryOnStatus))
+	for _, code := range retryOnStatus {
+		statuses[code] = true
+	}
+
+	client.
+		SetRetryCount(cfg.RetryCount).
+		SetRetryWaitTime(minBackoff).
+		SetRetryMaxWaitTime(maxBackoff).
+		SetRetryAfter(func(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+			// Respect the `Retry-After` of the server, capped by `retryMaxBackoff`.
+			if seconds, err := strconv.Atoi(resp.Header().Get("Retry-After")); err == nil && seconds > 0 {
+				return min(time.Duration(seconds)*time.Second, maxBackoff), nil
+			}
+			attempt := 0
+			if resp.Request != nil && resp.Request.Attempt > 0 {
+				attempt = resp.Request.Attempt - 1
+			}
+			return helpers.JitterBackoff(minBackoff, maxBackoff, attempt), nil
+		}).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			if errors.Is(err, circuitbreaker.ErrOpen) {
+				return false
+			}
+			if resp == nil || resp.Request == nil {
+				return err != nil
+			}
+			// IMPORTANT: A non idempotent request may have been processed by the server.
+			if !cfg.RetryNonIdempotent && !isIdempotent(resp.Request.Method) {
+				return false
+			}
+			return err != nil || statuses[resp.StatusCode()]
+		})
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Register makes a client available by the provided name. If Register is called twice with the same name or
+// if client is nil, it returns error.
+func Register(name string, client *resty.Client) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if client == nil {
+		return errors.New("httpclient: Register client is nil")
+	}
+
+	if _, dup := clients[name]; dup {
+		return errors.New("httpclient: Register called twice for client " + name)
+	}
+
+	clients[name] = client
+	return nil
+}
+
+// Init builds and registers the clients of `httpClients` in `env.json`.
+func Init(cfgs []config.HTTPClient, opts ...Option) error {
+	for _, cfg := range cfgs {
+		if err := Register(cfg.Name, New(cfg, opts...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the client registered by the name.
+func Get(name string) (*resty.Client, error) {
+	clientsMu.RLock()
+	client, ok := clients[name]
+	clientsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("httpclient: unknown client name %q", name)
+	}
+
+	return client, nil
+}
+
+// Clients returns the sorted names of the registered clients.
+func Clients() []string {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	list := make([]string, 0, len(clients))
+	for name := range clients {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// CloseIdleConnections closes the idle connections of all the registered clients.
+func CloseIdleConnections() {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	for _, client := range clients {
+		client.GetClient().CloseIdleConnections()
+	}
+}
+
+// UnregisterAll removes all the registered clients.
+func UnregisterAll() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients = make(map[string]*resty.Client)
+}
@@ -0,0 +1,127 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_Retry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(config.HTTPClient{
+		Name:            "retry",
+		BaseURL:         srv.URL,
+		RetryCount:      3,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 5 * time.Millisecond,
+	})
+
+	resp, err := client.R().Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, int32(3), calls.Load())
+
+	// A non idempotent request is not retried.
+	calls.Store(0)
+	resp, err = client.R().Post("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal(t, int32(1), calls.Load())
+
+	assert.Equal(t, 4.0, testutil.ToFloat64(requestsTotal.WithLabelValues("retry", http.MethodGet, srv.Listener.Addr().String(), "503"))+
+		testutil.ToFloat64(requestsTotal.WithLabelValues("retry", http.MethodGet, srv.Listener.Addr().String(), "200"))+
+		testutil.ToFloat64(requestsTotal.WithLabelValues("retry", http.MethodPost, srv.Listener.Addr().String(), "503")))
+}
+
+func TestNew_RetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(config.HTTPClient{
+		Name:            "retry-after",
+		BaseURL:         srv.URL,
+		RetryCount:      1,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 5 * time.Millisecond,
+	})
+
+	// The `Retry-After` of the server is capped by `retryMaxBackoff`.
+	start := time.Now()
+	resp, err := client.R().Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestNew_Propagation(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	client := New(config.HTTPClient{
+		Name:    "propagation",
+		BaseURL: srv.URL,
+		Headers: map[string]string{"x-client": "bean"},
+	})
+
+	span := sentry.StartSpan(context.Background(), "test")
+	defer span.Finish()
+	ctx := trace.WithRequestID(span.Context(), "request-id")
+
+	_, err := client.R().SetContext(ctx).Get("/")
+	require.NoError(t, err)
+
+	assert.Equal(t, "request-id", header.Get("X-Request-ID"))
+	assert.Equal(t, "bean", header.Get("X-Client"))
+	assert.Len(t, header.Values(sentry.SentryTraceHeader), 1)
+	assert.Contains(t, header.Get(sentry.SentryTraceHeader), span.TraceID.String())
+}
+
+func TestRegistry(t *testing.T) {
+	t.Cleanup(UnregisterAll)
+
+	require.NoError(t, Init([]config.HTTPClient{{Name: "a"}, {Name: "b"}}))
+	assert.Equal(t, []string{"a", "b"}, Clients())
+
+	client, err := Get("a")
+	require.NoError(t, err)
+	assert.NotNil(t, client)
+
+	_, err = Get("c")
+	assert.Error(t, err)
+
+	assert.Error(t, Register("a", New(config.HTTPClient{})))
+	assert.Error(t, Register("d", nil))
+}
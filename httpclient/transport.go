@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/v2/trace"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "http_client",
+		Name:      "requests_total",
+		Help:      "How many outgoing HTTP requests processed, partitioned by client, method, host and status code.",
+	}, []string{"client", "method", "host", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "The outgoing HTTP request latencies in seconds, partitioned by client, method and host.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"client", "method", "host"})
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers the metrics to the default prometheus registry, which is exposed on `/metrics`.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		for _, c := range []prometheus.Collector{requestsTotal, requestDuration} {
+			if err := prometheus.Register(c); err != nil {
+				var are prometheus.AlreadyRegisteredError
+				if !errors.As(err, &are) {
+					panic(err)
+				}
+			}
+		}
+	})
+}
+
+// instrumentedTransport instruments every attempt of a request.
+type instrumentedTransport struct {
+	client string
+	next   http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	registerMetrics()
+
+	ctx := req.Context()
+
+	// Only trace the calls made within a transaction, e.g. of an incoming request.
+	var span *sentry.Span
+	if sentry.SpanFromContext(ctx) != nil {
+		span = sentry.StartSpan(ctx, "http.client",
+			sentry.WithDescription(req.Method+" "+req.URL.Redacted()))
+		span.SetData("http.request.method", req.Method)
+		span.SetData("server.address", req.URL.Host)
+		ctx = span.Context()
+	}
+
+	// IMPORTANT: A `RoundTripper` must not modify the request, and the headers must not be added twice on retry.
+	req = req.Clone(ctx)
+	for k, v := range trace.PropagateToHTTP(ctx, http.Header{}) {
+		req.Header[k] = v
+	}
+	if id := trace.RequestIDFromContext(ctx); id != "" && req.Header.Get(echo.HeaderXRequestID) == "" {
+		req.Header.Set(echo.HeaderXRequestID, id)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	requestsTotal.WithLabelValues(t.client, req.Method, req.URL.Host, code).Inc()
+	requestDuration.WithLabelValues(t.client, req.Method, req.URL.Host).Observe(elapsed.Seconds())
+
+	if span != nil {
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+		} else {
+			span.Status = sentry.HTTPtoSpanStatus(resp.StatusCode)
+			span.SetData("http.response.status_code", resp.StatusCode)
+		}
+		span.Finish()
+	}
+
+	return resp, err
+}
@@ -0,0 +1,54 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/idempotency"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+// useIdempotency adds the `Idempotency-Key` middleware. The responses are stored in the redis of the tenant of
+// the request if there is one, otherwise in the master redis.
+func (b *Bean) useIdempotency() error {
+	if b.DBConn == nil || b.DBConn.MasterRedisDB == nil {
+		return errors.New("idempotency: the master redis is required, call `InitDB` first")
+	}
+
+	deps := b.DBConn
+	b.Echo.Use(idempotency.Middleware(b.Config.Idempotency, func(c echo.Context) *dbdrivers.RedisDBConn {
+		// IMPORTANT: Only trust the tenant resolved by the tenant middleware, an arbitrary header would open the
+		// connections of any tenant.
+		if tenantID, ok := tenant.FromContext(c.Request().Context()); ok {
+			if conns, err := deps.Tenant(tenantID); err == nil && conns.RedisDB != nil {
+				return conns.RedisDB
+			}
+		}
+		return deps.MasterRedisDB
+	}))
+
+	return nil
+}
@@ -0,0 +1,330 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package idempotency makes the retries of the unsafe requests, e.g. a payment, safe. The first response to an
+// `Idempotency-Key` is stored in redis and replayed for the duplicates.
+package idempotency
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+const (
+	DefaultHeader       = "Idempotency-Key"
+	DefaultPrefix       = "idempotency"
+	DefaultTTL          = 24 * time.Hour
+	DefaultLockTTL      = time.Minute
+	DefaultAPIKeyHeader = "X-API-Key"
+
+	// HeaderReplayed is set on the replayed responses.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// DefaultMethods are the methods handled if `methods` is not set.
+var DefaultMethods = []string{http.MethodPost, http.MethodPatch}
+
+// The states returned by `acquireScript`.
+const (
+	stateAcquired = iota
+	stateStored
+	stateLocked
+)
+
+// acquireScript returns the stored response or takes the lock of the key.
+// It returns {state, stored response or lock value}.
+var acquireScript = redis.NewScript(`
+local resp = redis.call('GET', KEYS[1])
+if resp then
+	return {1, resp}
+end
+if redis.call('SET', KEYS[2], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return {0, ''}
+end
+return {2, redis.call('GET', KEYS[2]) or ''}
+`)
+
+// releaseScript deletes the lock only if it is still held by the request.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ConnResolver returns the redis connection of the request, e.g. the tenant's one. A nil connection skips the
+// middleware.
+type ConnResolver func(c echo.Context) *dbdrivers.RedisDBConn
+
+// response is the stored response.
+type response struct {
+	Fingerprint string              `json:"fingerprint"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+// Middleware returns a middleware which stores the first response to an `Idempotency-Key` for `ttl` and replays
+// it for the duplicates. A duplicate gets `409` while the first request is in flight, and `422` if its method,
+// path or body differ from the first request. The `5xx` responses are not stored, so the request can be retried.
+// A key is scoped by the tenant resolved by the `tenant` middleware and by the caller (see `callerOf`), so two
+// callers never share a response.
+func Middleware(cfg config.Idempotency, resolve ConnResolver) echo.MiddlewareFunc {
+	header := cfg.Header
+	if header == "" {
+		header = DefaultHeader
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	lockTTL := cfg.LockTTL
+	if lockTTL <= 0 {
+		lockTTL = DefaultLockTTL
+	}
+	apiKeyHeader := cfg.APIKeyHeader
+	if apiKeyHeader == "" {
+		apiKeyHeader = DefaultAPIKeyHeader
+	}
+
+	methods := map[string]bool{}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = DefaultMethods
+	}
+	for _, m := range cfg.Methods {
+		methods[strings.ToUpper(m)] = true
+	}
+	paths := map[string]bool{}
+	for _, p := range cfg.Paths {
+		paths[p] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(header)
+			if key == "" || !methods[req.Method] || (len(paths) > 0 && !paths[c.Path()]) {
+				return next(c)
+			}
+
+			if len(key) > maxKeyLength {
+				return c.JSON(http.StatusBadRequest, berror.ErrorResp{
+					ErrorCode: berror.API_DATA_VALIDATION_FAILED,
+					ErrorMsg:  header + " must not be longer than 255 characters",
+				})
+			}
+
+			conn := resolve(c)
+			if conn == nil {
+				return next(c)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := fingerprintOf(req.Method, c.Path(), body)
+
+			// IMPORTANT: The hash tag keeps both keys in the same slot of a redis cluster.
+			var tenantID string
+			if id, ok := tenant.FromContext(req.Context()); ok {
+				tenantID = strconv.FormatUint(id, 10)
+			}
+			base := prefix + ":{" + tenantID + ":" + callerOf(c, apiKeyHeader) + ":" + key + "}"
+			respKey, lockKey := base+":response", base+":lock"
+			lockValue := fingerprint + "|" + uuid.NewString()
+
+			ctx := req.Context()
+			v, err := conn.Run(ctx, acquireScript, []string{respKey, lockKey}, lockValue, lockTTL.Milliseconds())
+			if err != nil {
+				return err
+			}
+			values, _ := v.([]interface{})
+			if len(values) != 2 {
+				return errors.New("idempotency: unexpected reply of the acquire script")
+			}
+			state, _ := values[0].(int64)
+			data, _ := values[1].(string)
+
+			switch state {
+			case stateStored:
+				var stored response
+				if err := json.Unmarshal([]byte(data), &stored); err != nil {
+					return err
+				}
+				if stored.Fingerprint != fingerprint {
+					return mismatch(c, header)
+				}
+				return replay(c, stored)
+
+			case stateLocked:
+				if !strings.HasPrefix(data, fingerprint+"|") {
+					return mismatch(c, header)
+				}
+				return c.JSON(http.StatusConflict, berror.ErrorResp{
+					ErrorCode: berror.IDEMPOTENCY_KEY_IN_USE,
+					ErrorMsg:  "a request with the same " + header + " is in progress",
+				})
+			}
+
+			defer func() {
+				// Do not release the lock with the canceled request context.
+				if _, err := conn.Run(context.WithoutCancel(ctx), releaseScript, []string{lockKey}, lockValue); err != nil {
+					c.Logger().Errorf("idempotency: failed to release the lock: %v", err)
+				}
+			}()
+
+			res := c.Response()
+			rec := &recorder{ResponseWriter: res.Writer}
+			res.Writer = rec
+
+			// IMPORTANT: Handle the error here, so that the error response is stored too.
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			res.Writer = rec.ResponseWriter
+
+			if res.Status >= http.StatusInternalServerError || !res.Committed {
+				return nil
+			}
+
+			stored := response{
+				Fingerprint: fingerprint,
+				Status:      res.Status,
+				Header:      map[string][]string{},
+				Body:        rec.body.Bytes(),
+			}
+			for k, vs := range res.Header() {
+				switch k {
+				case "Date", "Content-Length", echo.HeaderXRequestID:
+					continue
+				}
+				stored.Header[k] = vs
+			}
+
+			b, err := json.Marshal(stored)
+			if err != nil {
+				return err
+			}
+			if err := conn.Set(context.WithoutCancel(ctx), respKey, b, ttl); err != nil {
+				c.Logger().Errorf("idempotency: failed to store the response: %v", err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// callerOf returns the identity of the caller: the subject of a valid JWT, the hash of the API key, or the client
+// IP without them.
+func callerOf(c echo.Context, apiKeyHeader string) string {
+	claims := &jwt.RegisteredClaims{}
+	if err := helpers.DecodeJWT(c, claims, config.GetString("jwt.secret")); err == nil && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+	if key := c.Request().Header.Get(apiKeyHeader); key != "" {
+		// Do not store the API keys in plain text.
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+
+	return "ip:" + c.RealIP()
+}
+
+func fingerprintOf(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func mismatch(c echo.Context, header string) error {
+	return c.JSON(http.StatusUnprocessableEntity, berror.ErrorResp{
+		ErrorCode: berror.IDEMPOTENCY_KEY_MISMATCH,
+		ErrorMsg:  header + " was already used with a different request",
+	})
+}
+
+func replay(c echo.Context, stored response) error {
+	h := c.Response().Header()
+	for k, vs := range stored.Header {
+		h[k] = vs
+	}
+	h.Set(HeaderReplayed, "true")
+
+	c.Response().WriteHeader(stored.Status)
+	_, err := c.Response().Write(stored.Body)
+	return err
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,224 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEcho(t *testing.T, cfg config.Idempotency) (*echo.Echo, *miniredis.Miniredis) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	conn := &dbdrivers.RedisDBConn{Primary: client}
+
+	e := echo.New()
+	e.Use(Middleware(cfg, func(echo.Context) *dbdrivers.RedisDBConn { return conn }))
+
+	return e, s
+}
+
+func do(e *echo.Echo, method, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(DefaultHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_Replay(t *testing.T) {
+	e, s := newTestEcho(t, config.Idempotency{TTL: time.Hour})
+
+	var calls atomic.Int32
+	e.POST("/payments", func(c echo.Context) error {
+		n := calls.Add(1)
+		c.Response().Header().Set("X-Payment", "p1")
+		return c.JSON(http.StatusCreated, map[string]int32{"call": n})
+	})
+	e.GET("/payments", func(c echo.Context) error {
+		calls.Add(1)
+		return c.NoContent(http.StatusOK)
+	})
+
+	first := do(e, http.MethodPost, "/payments", "k1", `{"amount":100}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(HeaderReplayed))
+
+	second := do(e, http.MethodPost, "/payments", "k1", `{"amount":100}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	assert.Equal(t, "p1", second.Header().Get("X-Payment"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	ttl := s.TTL("idempotency:{:ip:192.0.2.1:k1}:response")
+	assert.Equal(t, time.Hour, ttl)
+	assert.False(t, s.Exists("idempotency:{:ip:192.0.2.1:k1}:lock"))
+
+	// A different payload.
+	rec := do(e, http.MethodPost, "/payments", "k1", `{"amount":200}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"100013"`)
+
+	// Another key, without key and a safe method are not replayed.
+	assert.Equal(t, http.StatusCreated, do(e, http.MethodPost, "/payments", "k2", `{"amount":100}`).Code)
+	assert.Equal(t, http.StatusCreated, do(e, http.MethodPost, "/payments", "", `{"amount":100}`).Code)
+	assert.Equal(t, http.StatusOK, do(e, http.MethodGet, "/payments", "k1", "").Code)
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestMiddleware_Errors(t *testing.T) {
+	e, _ := newTestEcho(t, config.Idempotency{})
+
+	var calls atomic.Int32
+	e.POST("/fail", func(c echo.Context) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+	e.POST("/invalid", func(c echo.Context) error {
+		calls.Add(1)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid")
+	})
+
+	// The 5xx responses are not stored.
+	assert.Equal(t, http.StatusInternalServerError, do(e, http.MethodPost, "/fail", "k", "").Code)
+	assert.Equal(t, http.StatusInternalServerError, do(e, http.MethodPost, "/fail", "k", "").Code)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// The error responses are stored.
+	assert.Equal(t, http.StatusBadRequest, do(e, http.MethodPost, "/invalid", "k", "").Code)
+	rec := do(e, http.MethodPost, "/invalid", "k", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(3), calls.Load())
+
+	assert.Equal(t, http.StatusBadRequest, do(e, http.MethodPost, "/invalid", strings.Repeat("k", 256), "").Code)
+}
+
+func TestMiddleware_Concurrent(t *testing.T) {
+	e, _ := newTestEcho(t, config.Idempotency{Paths: []string{"/slow"}})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	e.POST("/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var first *httptest.ResponseRecorder
+	go func() {
+		defer wg.Done()
+		first = do(e, http.MethodPost, "/slow", "k", "body")
+	}()
+
+	<-started
+	rec := do(e, http.MethodPost, "/slow", "k", "body")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"100012"`)
+	assert.Equal(t, http.StatusUnprocessableEntity, do(e, http.MethodPost, "/slow", "k", "other").Code)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, http.StatusNoContent, first.Code)
+
+	assert.Equal(t, http.StatusNoContent, do(e, http.MethodPost, "/slow", "k", "body").Code)
+}
+
+func TestMiddleware_Caller(t *testing.T) {
+	// The secret is resolved like the config values.
+	secretFile := filepath.Join(t.TempDir(), "jwt_secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("secret\n"), 0o600))
+	viper.Set("jwt.secret", "file://"+secretFile)
+	t.Cleanup(viper.Reset)
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	conn := &dbdrivers.RedisDBConn{Primary: client}
+
+	lookup := func(value string) (uint64, bool) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		return id, err == nil && id == 42
+	}
+
+	e := echo.New()
+	e.Use(tenant.Middleware(config.TenantResolver{}, lookup))
+	e.Use(Middleware(config.Idempotency{}, func(echo.Context) *dbdrivers.RedisDBConn { return conn }))
+
+	var calls atomic.Int32
+	e.POST("/payments", func(c echo.Context) error {
+		calls.Add(1)
+		return c.NoContent(http.StatusCreated)
+	})
+
+	token, err := helpers.EncodeJWT(jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}, "secret")
+	require.NoError(t, err)
+
+	do := func(headers map[string]string, remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodPost, "/payments", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(DefaultHeader, "k")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Header().Get(HeaderReplayed)
+	}
+
+	callers := []map[string]string{
+		{echo.HeaderAuthorization: "Bearer " + token},
+		{"X-API-Key": "alice"},
+		{"X-API-Key": "bob"},
+		{"X-Tenant-ID": "42"},
+		// An unknown tenant is the same caller as without it.
+		{"X-Tenant-ID": "43"},
+		nil,
+	}
+	for _, headers := range callers {
+		do(headers, "192.0.2.1:1234")
+	}
+	assert.Equal(t, int32(5), calls.Load())
+
+	// The JWT subject and the API key do not depend on the client IP.
+	assert.Equal(t, "true", do(callers[0], "192.0.2.2:1234"))
+	assert.Equal(t, "true", do(callers[1], "192.0.2.2:1234"))
+	assert.Empty(t, do(nil, "192.0.2.2:1234"))
+	assert.Equal(t, int32(6), calls.Load())
+
+	assert.True(t, s.Exists("idempotency:{:sub:alice:k}:response"))
+	assert.True(t, s.Exists("idempotency:{42:ip:192.0.2.1:k}:response"))
+	assert.NotContains(t, s.Keys(), "idempotency:{:key:alice:k}:response")
+}
@@ -24,7 +24,13 @@ package dbdrivers
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -32,17 +38,13 @@ import (
 	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"gorm.io/gorm"
 )
 
 type MongoConfig struct {
-	Master *struct {
-		Database string
-		Username string
-		Password string
-		Host     string
-		Port     string
-	}
+	Master                *MongoConnection
 	ConnectTimeout        time.Duration
 	MaxConnectionPoolSize uint64
 	MinConnectionPoolSize uint64
@@ -50,106 +52,155 @@ type MongoConfig struct {
 	Debug                 bool
 }
 
+// MongoConnection holds the options of a mongo database: the master one, or the `mongodb` object of the
+// `Connections` JSON of a tenant. `URI` is a full connection string, e.g. `mongodb+srv://cluster0.example.com`,
+// which replaces `Host` and `Port`. The other options take precedence over the ones of the URI.
+type MongoConnection struct {
+	Database       string   `json:"database"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Host           string   `json:"host"`
+	Port           string   `json:"port"`
+	URI            string   `json:"uri"`
+	ReplicaSet     string   `json:"replicaSet"`
+	AuthMechanism  string   `json:"authMechanism"`
+	AuthSource     string   `json:"authSource"`
+	TLS            MongoTLS `json:"tls"`
+	ReadPreference string   `json:"readPreference"`
+	WriteConcern   string   `json:"writeConcern"`
+	RetryWrites    *bool    `json:"retryWrites"`
+	Compressors    []string `json:"compressors"`
+}
+
+// MongoTLS enables TLS. `CertFile` is the client certificate for the `MONGODB-X509` authentication, with its key
+// in `KeyFile` or in the same PEM file.
+type MongoTLS struct {
+	On                 bool   `json:"on"`
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
 // Init the mongo database connection map.
 func InitMongoTenantConns(config MongoConfig, master *gorm.DB, tenantAlterDbHostParam, tenantDBPassPhraseKey string, logger echo.Logger) (map[uint64]*mongo.Client, map[uint64]string) {
 
 	tenantCfgs := GetAllTenantCfgs(master)
 
-	return getAllMongoTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey, logger)
+	mongoConns, mongoDBNames, err := getAllMongoTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	return mongoConns, mongoDBNames
 }
 
 func InitMongoMasterConn(config MongoConfig, logger echo.Logger) (*mongo.Client, string) {
 
 	masterCfg := config.Master
 	if masterCfg != nil && masterCfg.Database != "" {
-		return connectMongoDB(masterCfg.Username, masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
+		client, dbName, err := connectMongoDB(masterCfg,
 			config.MaxConnectionPoolSize, config.MinConnectionPoolSize,
 			config.ConnectTimeout, config.MaxConnectionLifeTime,
 			config.Debug, logger,
 		)
+		if err != nil {
+			panic(err)
+		}
+		return client, dbName
 	}
 
 	return nil, ""
 }
 
-func getAllMongoTenantDB(config MongoConfig, tenantCfgs []*TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string, logger echo.Logger) (map[uint64]*mongo.Client, map[uint64]string) {
+func getAllMongoTenantDB(config MongoConfig, tenantCfgs []*TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string, logger echo.Logger) (map[uint64]*mongo.Client, map[uint64]string, error) {
 
 	mongoConns := make(map[uint64]*mongo.Client, len(tenantCfgs))
 	mongoDBNames := make(map[uint64]string, len(tenantCfgs))
 
 	for _, t := range tenantCfgs {
+		client, dbName, err := openMongoTenantDB(config, t, tenantAlterDbHostParam, tenantDBPassPhraseKey, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		mongoConns[t.TenantID], mongoDBNames[t.TenantID] = client, dbName
+	}
+
+	return mongoConns, mongoDBNames, nil
+}
+
+// openMongoTenantDB returns the mongo client of a tenant, or nil if it has no `mongodb` object.
+func openMongoTenantDB(config MongoConfig, t *TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string, logger echo.Logger) (*mongo.Client, string, error) {
+
+	var cfgsMap map[string]map[string]interface{}
+	var conns struct {
+		Mongo MongoConnection `json:"mongodb"`
+	}
+	var err error
+	if t.Connections != nil {
+		if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
+			return nil, "", err
+		}
+		if err = json.Unmarshal(t.Connections, &conns); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// IMPORTANT: Check the `mongodb` object exist in the Connections column or not.
+	mongoCfg, ok := cfgsMap["mongodb"]
+	if !ok {
+		return nil, "", nil
+	}
+
+	// IMPORTANT: The `host` and `port` are optional with a `uri`.
+	conn := conns.Mongo
 
-		var cfgsMap map[string]map[string]interface{}
-		var err error
-		if t.Connections != nil {
-			if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
-				panic(err)
-			}
+	// IMPORTANT: If tenant database password is encrypted in master db config.
+	if tenantDBPassPhraseKey != "" && conn.Password != "" {
+		conn.Password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, conn.Password)
+		if err != nil {
+			return nil, "", err
 		}
+	}
 
-		// IMPORTANT: Check the `mongodb` object exist in the Connections column or not.
-		if mongoCfg, ok := cfgsMap["mongodb"]; ok {
-			userName := mongoCfg["username"].(string)
-			password := mongoCfg["password"].(string)
-
-			// IMPORTANT: If tenant database password is encrypted in master db config.
-			if tenantDBPassPhraseKey != "" {
-				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
-				if err != nil {
-					panic(err)
-				}
-			}
-
-			host := mongoCfg["host"].(string)
-
-			// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
-			// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
-			// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
-			if tenantAlterDbHostParam != "" && mongoCfg[tenantAlterDbHostParam] != nil {
-				host = mongoCfg[tenantAlterDbHostParam].(string)
-			}
-
-			port := mongoCfg["port"].(string)
-			dbName := mongoCfg["database"].(string)
-
-			mongoConns[t.TenantID], mongoDBNames[t.TenantID] = connectMongoDB(
-				userName, password, host, port, dbName,
-				config.MaxConnectionPoolSize, config.MinConnectionPoolSize,
-				config.ConnectTimeout, config.MaxConnectionLifeTime,
-				config.Debug, logger,
-			)
-
-		} else {
-			mongoConns[t.TenantID], mongoDBNames[t.TenantID] = nil, ""
+	// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
+	// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
+	// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
+	if tenantAlterDbHostParam != "" && mongoCfg[tenantAlterDbHostParam] != nil {
+		host, ok := mongoCfg[tenantAlterDbHostParam].(string)
+		if !ok {
+			return nil, "", fmt.Errorf("mongodb.%s of tenant %d must be a string", tenantAlterDbHostParam, t.TenantID)
 		}
+		conn.Host = host
 	}
 
-	return mongoConns, mongoDBNames
+	return connectMongoDB(
+		&conn,
+		config.MaxConnectionPoolSize, config.MinConnectionPoolSize,
+		config.ConnectTimeout, config.MaxConnectionLifeTime,
+		config.Debug, logger,
+	)
 }
 
-func connectMongoDB(userName, password, host, port, dbName string,
+func connectMongoDB(conn *MongoConnection,
 	maxPoolSize, minPoolSize uint64,
 	connectTimeout, maxConnIdleTime time.Duration,
 	debug bool, logger echo.Logger,
-) (*mongo.Client, string) {
-
-	connStr := "mongodb://" + host + ":" + port
+) (*mongo.Client, string, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Client().
-		ApplyURI(connStr).
-		SetConnectTimeout(connectTimeout).
+	opts, err := mongoClientOptions(conn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	opts.SetConnectTimeout(connectTimeout).
 		SetMaxPoolSize(maxPoolSize).
 		SetMinPoolSize(minPoolSize).
 		SetMaxConnIdleTime(maxConnIdleTime)
 
-	if userName != "" && password != "" {
-		credential := options.Credential{Username: userName, Password: password, AuthSource: dbName}
-		opts.SetAuth(credential)
-	}
-
 	// log monitor
 	var logMonitor = event.CommandMonitor{
 		Started: func(ctx context.Context, startedEvent *event.CommandStartedEvent) {
@@ -172,14 +223,127 @@ func connectMongoDB(userName, password, host, port, dbName string,
 
 	mdb, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		panic(err)
+		return nil, "", err
 	}
 
 	// Check the connection
 	err = mdb.Ping(ctx, nil)
 	if err != nil {
-		panic(err)
+		mdb.Disconnect(ctx)
+		return nil, "", err
+	}
+
+	return mdb, conn.Database, nil
+}
+
+// mongoClientOptions returns the client options of a connection, without the pool settings.
+func mongoClientOptions(conn *MongoConnection) (*options.ClientOptions, error) {
+	uri := conn.URI
+	if uri == "" {
+		uri = "mongodb://" + conn.Host
+		// The host is either a single host or a comma separated list of `host:port`, e.g. a replica set.
+		if conn.Port != "" && !strings.Contains(conn.Host, ",") {
+			uri += ":" + conn.Port
+		}
+	}
+
+	opts := options.Client().ApplyURI(uri)
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if conn.ReplicaSet != "" {
+		opts.SetReplicaSet(conn.ReplicaSet)
+	}
+
+	if (conn.Username != "" && conn.Password != "") || conn.AuthMechanism != "" {
+		authSource := conn.AuthSource
+		if authSource == "" && conn.AuthMechanism != "MONGODB-X509" {
+			authSource = conn.Database
+		}
+		opts.SetAuth(options.Credential{
+			AuthMechanism: conn.AuthMechanism,
+			AuthSource:    authSource,
+			Username:      conn.Username,
+			Password:      conn.Password,
+			PasswordSet:   conn.Password != "",
+		})
+	}
+
+	if conn.TLS.On {
+		tlsCfg, err := clientTLSConfig(conn.TLS.CAFile, conn.TLS.CertFile, conn.TLS.KeyFile, conn.TLS.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+
+	if conn.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(conn.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	if conn.WriteConcern != "" {
+		opts.SetWriteConcern(parseMongoWriteConcern(conn.WriteConcern))
+	}
+
+	if conn.RetryWrites != nil {
+		opts.SetRetryWrites(*conn.RetryWrites)
+	}
+
+	if len(conn.Compressors) > 0 {
+		opts.SetCompressors(conn.Compressors)
+	}
+
+	return opts, nil
+}
+
+// parseMongoWriteConcern converts `majority`, a number of nodes like `1` or a tag set name to a write concern.
+func parseMongoWriteConcern(w string) *writeconcern.WriteConcern {
+	if strings.EqualFold(w, "majority") {
+		return writeconcern.Majority()
+	}
+	if n, err := strconv.Atoi(w); err == nil {
+		return &writeconcern.WriteConcern{W: n}
+	}
+
+	return writeconcern.Custom(w)
+}
+
+// clientTLSConfig returns the TLS config of a database client, trusting the CA of `caFile` if it is set. The key
+// of the client certificate is in `certFile` unless `keyFile` is set.
+func clientTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if certFile != "" {
+		if keyFile == "" {
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
 	}
 
-	return mdb, dbName
+	return tlsCfg, nil
 }
@@ -0,0 +1,70 @@
+package dbdrivers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func Test_mongoClientOptions(t *testing.T) {
+	retryWrites := false
+
+	opts, err := mongoClientOptions(&MongoConnection{
+		Database:       "bean",
+		Username:       "bean",
+		Password:       "secret",
+		Host:           "mongo-0:27017,mongo-1:27017",
+		Port:           "27017",
+		ReplicaSet:     "rs0",
+		ReadPreference: "secondaryPreferred",
+		WriteConcern:   "majority",
+		RetryWrites:    &retryWrites,
+		Compressors:    []string{"zstd"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"mongo-0:27017", "mongo-1:27017"}, opts.Hosts)
+	assert.Equal(t, "rs0", *opts.ReplicaSet)
+	assert.Equal(t, readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+	assert.Equal(t, "majority", opts.WriteConcern.W)
+	assert.False(t, *opts.RetryWrites)
+	assert.Equal(t, []string{"zstd"}, opts.Compressors)
+	assert.Equal(t, "bean", opts.Auth.AuthSource)
+	assert.Equal(t, "bean", opts.Auth.Username)
+
+	// The options override the ones of the URI.
+	opts, err = mongoClientOptions(&MongoConnection{
+		URI:            "mongodb://mongo:27018/?replicaSet=rs1&readPreference=nearest",
+		ReadPreference: "primary",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mongo:27018"}, opts.Hosts)
+	assert.Equal(t, "rs1", *opts.ReplicaSet)
+	assert.Equal(t, readpref.PrimaryMode, opts.ReadPreference.Mode())
+	assert.Nil(t, opts.Auth)
+
+	opts, err = mongoClientOptions(&MongoConnection{Host: "mongo", AuthMechanism: "MONGODB-X509", TLS: MongoTLS{On: true}})
+	require.NoError(t, err)
+	assert.Equal(t, "MONGODB-X509", opts.Auth.AuthMechanism)
+	assert.Empty(t, opts.Auth.AuthSource)
+	assert.NotNil(t, opts.TLSConfig)
+
+	_, err = mongoClientOptions(&MongoConnection{Host: "mongo", TLS: MongoTLS{On: true, CAFile: filepath.Join(t.TempDir(), "ca.pem")}})
+	assert.Error(t, err)
+
+	_, err = mongoClientOptions(&MongoConnection{Host: "mongo", ReadPreference: "fastest"})
+	assert.Error(t, err)
+
+	_, err = mongoClientOptions(&MongoConnection{URI: "postgres://mongo"})
+	assert.Error(t, err)
+}
+
+func Test_parseMongoWriteConcern(t *testing.T) {
+	assert.Equal(t, writeconcern.Majority(), parseMongoWriteConcern("Majority"))
+	assert.Equal(t, &writeconcern.WriteConcern{W: 2}, parseMongoWriteConcern("2"))
+	assert.Equal(t, writeconcern.Custom("dc-east"), parseMongoWriteConcern("dc-east"))
+}
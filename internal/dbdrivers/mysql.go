@@ -23,25 +23,32 @@
 package dbdrivers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/retail-ai-inc/bean/v2/aes"
 	"gorm.io/datatypes"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
+// The SQL drivers of `MySQLConnection.Driver`.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// SQLConfig is the `database.mysql` config, of a MySQL or a PostgreSQL master database depending on its driver.
 type SQLConfig struct {
-	Master *struct {
-		Database string
-		Username string
-		Password string
-		Host     string
-		Port     string
-	}
+	Master                    *MySQLConnection
 	MaxIdleConnections        int
 	MaxOpenConnections        int
 	MaxConnectionLifeTime     time.Duration
@@ -49,6 +56,53 @@ type SQLConfig struct {
 	Debug                     bool
 }
 
+// MySQLConnection holds the options of a SQL database: the master one, or the `mysql` object of the
+// `Connections` JSON of a tenant. `Driver` is `mysql` by default, or `postgres`; the one of a tenant defaults
+// to the one of the master.
+type MySQLConnection struct {
+	Driver   string `json:"driver"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	// Reads are the hosts of the read replicas, with the credentials and the port of the master unless the
+	// host is like `host:port`.
+	Reads []string `json:"reads"`
+	TLS   SQLTLS   `json:"tls"`
+	// Params are extra DSN parameters like `charset=utf8mb4&loc=Local&interpolateParams=true`, which override
+	// the defaults `parseTime=true&multiStatements=true`, or the parameters of a PostgreSQL connection URI like
+	// `sslmode=verify-full&search_path=myschema`.
+	Params string `json:"params"`
+}
+
+// SQLTLS enables TLS. `ServerName` defaults to the host, and `CertFile` is the client certificate, with its key
+// in `KeyFile` or in the same PEM file.
+type SQLTLS struct {
+	On                 bool   `json:"on"`
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// MySQLDatabase is the database a new connection is dialed to, as passed to `MySQLCredentials`.
+type MySQLDatabase struct {
+	// TenantID is 0 for the master database.
+	TenantID uint64
+	Driver   string
+	Host     string
+	Port     string
+	Database string
+	Username string
+}
+
+// MySQLCredentials, if set, is called each time a new MySQL or PostgreSQL connection is dialed, so a rotated
+// password or a short-lived token like an IAM one is used without a restart. An empty username keeps the
+// configured one.
+var MySQLCredentials func(ctx context.Context, db MySQLDatabase) (username, password string, err error)
+
 // TenantConnections represent a tenant database configuration record in master database
 type TenantConnections struct {
 	ID          uint64         `gorm:"primary_key;AUTO_INCREMENT;column:Id"`
@@ -68,17 +122,21 @@ func (TenantConnections) TableName() string {
 	return "TenantConnections"
 }
 
-// InitMysqlMasterConn returns mysql master db connection.
+// InitMysqlMasterConn returns the master db connection, MySQL or PostgreSQL depending on its driver.
 func InitMysqlMasterConn(config SQLConfig) (*gorm.DB, string) {
 
 	masterCfg := config.Master
 
 	if masterCfg != nil && masterCfg.Database != "" {
-		return connectMysqlDB(
-			masterCfg.Username, masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
+		db, dbName, err := connectSQLDB(
+			masterCfg, 0,
 			config.MaxIdleConnections, config.MaxOpenConnections, config.MaxConnectionLifeTime, config.MaxIdleConnectionLifeTime,
 			config.Debug,
 		)
+		if err != nil {
+			panic(err)
+		}
+		return db, dbName
 	}
 
 	return nil, ""
@@ -93,15 +151,18 @@ func InitMysqlTenantConns(config SQLConfig, master *gorm.DB, tenantAlterDbHostPa
 
 	tenantCfgs := GetAllTenantCfgs(master)
 
-	return getAllMysqlTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+	mysqlConns, mysqlDBNames, err := getAllMysqlTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return mysqlConns, mysqlDBNames
 }
 
 // GetAllTenantCfgs return all Tenant data from master db.
 func GetAllTenantCfgs(db *gorm.DB) []*TenantConnections {
 
-	var tt []*TenantConnections
-
-	err := db.Table("TenantConnections").Find(&tt).Error
+	tt, err := LoadTenantCfgs(context.Background(), db)
 	if err != nil {
 		panic(err)
 	}
@@ -113,84 +174,132 @@ func GetAllTenantCfgs(db *gorm.DB) []*TenantConnections {
 
 // getAllMysqlTenantDB returns all tenant db connection.
 func getAllMysqlTenantDB(config SQLConfig, tenantCfgs []*TenantConnections,
-	tenantAlterDbHostParam, tenantDBPassPhraseKey string) (map[uint64]*gorm.DB, map[uint64]string) {
+	tenantAlterDbHostParam, tenantDBPassPhraseKey string) (map[uint64]*gorm.DB, map[uint64]string, error) {
 
 	mysqlConns := make(map[uint64]*gorm.DB, len(tenantCfgs))
 	mysqlDBNames := make(map[uint64]string, len(tenantCfgs))
 
 	for _, t := range tenantCfgs {
-
-		var cfgsMap map[string]map[string]interface{}
-		var err error
-		if t.Connections != nil {
-			if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
-				panic(err)
-			}
+		db, dbName, err := openMysqlTenantDB(config, t, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+		if err != nil {
+			return nil, nil, err
 		}
+		mysqlConns[t.TenantID], mysqlDBNames[t.TenantID] = db, dbName
+	}
 
-		// IMPORTANT: Check the `mysql` object exist in the Connections column or not.
-		if mysqlCfg, ok := cfgsMap["mysql"]; ok {
-			userName := mysqlCfg["username"].(string)
-			password := mysqlCfg["password"].(string)
+	return mysqlConns, mysqlDBNames, nil
+}
 
-			// IMPORTANT: If tenant database password is encrypted in master db config.
-			if tenantDBPassPhraseKey != "" {
-				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
-				if err != nil {
-					panic(err)
-				}
-			}
+// openMysqlTenantDB returns the db connection of a tenant, or nil if it has no `mysql` object.
+func openMysqlTenantDB(config SQLConfig, t *TenantConnections,
+	tenantAlterDbHostParam, tenantDBPassPhraseKey string) (*gorm.DB, string, error) {
 
-			host := mysqlCfg["host"].(string)
+	var cfgsMap map[string]map[string]interface{}
+	var conns struct {
+		MySQL MySQLConnection `json:"mysql"`
+	}
+	var err error
+	if t.Connections != nil {
+		if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
+			return nil, "", err
+		}
+		if err = json.Unmarshal(t.Connections, &conns); err != nil {
+			return nil, "", err
+		}
+	}
 
-			// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
-			// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
-			// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
-			if tenantAlterDbHostParam != "" && mysqlCfg[tenantAlterDbHostParam] != nil {
-				host = mysqlCfg[tenantAlterDbHostParam].(string)
-			}
+	// IMPORTANT: Check the `mysql` object exist in the Connections column or not.
+	mysqlCfg, ok := cfgsMap["mysql"]
+	if !ok {
+		return nil, "", nil
+	}
 
-			port := mysqlCfg["port"].(string)
-			dbName := mysqlCfg["database"].(string)
+	conn := conns.MySQL
+	if conn.Driver == "" && config.Master != nil {
+		conn.Driver = config.Master.Driver
+	}
 
-			mysqlConns[t.TenantID], mysqlDBNames[t.TenantID] = connectMysqlDB(
-				userName, password, host, port, dbName, config.MaxIdleConnections,
-				config.MaxOpenConnections, config.MaxConnectionLifeTime, config.MaxIdleConnectionLifeTime,
-				config.Debug,
-			)
+	// IMPORTANT: If tenant database password is encrypted in master db config.
+	if tenantDBPassPhraseKey != "" && conn.Password != "" {
+		conn.Password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, conn.Password)
+		if err != nil {
+			return nil, "", err
+		}
+	}
 
-		} else {
-			mysqlConns[t.TenantID], mysqlDBNames[t.TenantID] = nil, ""
+	// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
+	// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
+	// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
+	if tenantAlterDbHostParam != "" && mysqlCfg[tenantAlterDbHostParam] != nil {
+		host, ok := mysqlCfg[tenantAlterDbHostParam].(string)
+		if !ok {
+			return nil, "", fmt.Errorf("mysql.%s of tenant %d must be a string", tenantAlterDbHostParam, t.TenantID)
 		}
+		conn.Host = host
 	}
 
-	return mysqlConns, mysqlDBNames
+	// IMPORTANT: The reads are routed to the read replicas if they are available.
+	return connectSQLDB(
+		&conn, t.TenantID, config.MaxIdleConnections,
+		config.MaxOpenConnections, config.MaxConnectionLifeTime, config.MaxIdleConnectionLifeTime,
+		config.Debug,
+	)
 }
 
-func connectMysqlDB(userName, password, host, port, dbName string,
+func connectSQLDB(conn *MySQLConnection, tenantID uint64,
 	maxIdleConnections, maxOpenConnections int, maxConnectionLifeTime, maxIdleConnectionLifeTime time.Duration,
-	debug bool) (*gorm.DB, string) {
+	debug bool) (*gorm.DB, string, error) {
 
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?parseTime=true&multiStatements=true",
-		userName, password, host, port, dbName,
-	)
+	dialector, err := sqlDialector(conn, tenantID, conn.Host, conn.Port)
+	if err != nil {
+		return nil, "", err
+	}
 
 	var db *gorm.DB
-	var err error
 
 	if debug {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
+		db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
 	} else {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		db, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
 	}
 	if err != nil {
-		panic(err)
+		return nil, "", err
 	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
-		panic(err)
+		return nil, "", err
+	}
+
+	if len(conn.Reads) > 0 {
+		replicas := make([]gorm.Dialector, 0, len(conn.Reads))
+		for _, read := range conn.Reads {
+			readHost, readPort := read, conn.Port
+			if h, p, err := net.SplitHostPort(read); err == nil {
+				readHost, readPort = h, p
+			}
+			replica, err := sqlDialector(conn, tenantID, readHost, readPort)
+			if err != nil {
+				sqlDB.Close()
+				return nil, "", err
+			}
+			replicas = append(replicas, replica)
+		}
+
+		resolver := dbresolver.Register(dbresolver.Config{Replicas: replicas, Policy: dbresolver.RandomPolicy{}}).
+			SetMaxIdleConns(maxIdleConnections).
+			SetMaxOpenConns(maxOpenConnections)
+		if maxConnectionLifeTime > 0 {
+			resolver.SetConnMaxLifetime(maxConnectionLifeTime)
+		}
+		if maxIdleConnectionLifeTime > 0 {
+			resolver.SetConnMaxIdleTime(maxIdleConnectionLifeTime)
+		}
+
+		if err := useReadReplicas(db, resolver); err != nil {
+			sqlDB.Close()
+			return nil, "", err
+		}
 	}
 
 	sqlDB.SetMaxIdleConns(maxIdleConnections)
@@ -204,11 +313,153 @@ func connectMysqlDB(userName, password, host, port, dbName string,
 		sqlDB.SetConnMaxIdleTime(maxIdleConnectionLifeTime)
 	}
 
-	return db, dbName
+	return db, conn.Database, nil
+}
+
+// sqlDialector opens a pool to the database of the connection on the host with the driver of the connection.
+func sqlDialector(conn *MySQLConnection, tenantID uint64, host, port string) (gorm.Dialector, error) {
+	switch conn.Driver {
+	case "", DriverMySQL:
+		if port == "" {
+			port = "3306"
+		}
+		return mysqlDialector(conn, tenantID, host, port)
+	case DriverPostgres:
+		if port == "" {
+			port = "5432"
+		}
+		return postgresDialector(conn, tenantID, host, port)
+	default:
+		return nil, fmt.Errorf("unsupported sql driver %q, must be mysql or postgres", conn.Driver)
+	}
+}
+
+// mysqlDialector opens a pool from the driver config instead of a DSN, which can't hold the TLS config and the
+// credential provider.
+func mysqlDialector(conn *MySQLConnection, tenantID uint64, host, port string) (gorm.Dialector, error) {
+	cfg, err := mysqlDriverConfig(conn, tenantID, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := mysqldriver.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return mysql.New(mysql.Config{Conn: sql.OpenDB(connector), DSNConfig: cfg}), nil
+}
+
+// mysqlDriverConfig returns the driver config to dial the database of the connection on the host.
+func mysqlDriverConfig(conn *MySQLConnection, tenantID uint64, host, port string) (*mysqldriver.Config, error) {
+	params := url.Values{"parseTime": {"true"}, "multiStatements": {"true"}}
+	if conn.Params != "" {
+		extra, err := url.ParseQuery(conn.Params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mysql params %q: %w", conn.Params, err)
+		}
+		for k, v := range extra {
+			params[k] = v
+		}
+	}
+
+	addr := net.JoinHostPort(host, port)
+	cfg, err := mysqldriver.ParseDSN(fmt.Sprintf("tcp(%s)/%s?%s", addr, url.PathEscape(conn.Database), params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	// IMPORTANT: Not in the DSN, so the credentials don't need to be escaped.
+	cfg.User, cfg.Passwd = conn.Username, conn.Password
+
+	if conn.TLS.On {
+		tlsCfg, err := clientTLSConfig(conn.TLS.CAFile, conn.TLS.CertFile, conn.TLS.KeyFile, conn.TLS.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ServerName = conn.TLS.ServerName
+		cfg.TLS = tlsCfg
+	}
+
+	if provider := MySQLCredentials; provider != nil {
+		db := MySQLDatabase{TenantID: tenantID, Driver: DriverMySQL, Host: host, Port: port, Database: conn.Database, Username: conn.Username}
+		err := cfg.Apply(mysqldriver.BeforeConnect(func(ctx context.Context, cfg *mysqldriver.Config) error {
+			username, password, err := providedCredentials(ctx, provider, db)
+			if err != nil {
+				return err
+			}
+			cfg.User, cfg.Passwd = username, password
+			return nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// providedCredentials asks the provider for the credentials of the database, with the configured username if
+// the provider returns an empty one.
+func providedCredentials(ctx context.Context, provider func(context.Context, MySQLDatabase) (string, string, error),
+	db MySQLDatabase) (string, string, error) {
+
+	username, password, err := provider(ctx, db)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get the %s credentials of %s: %w", db.Driver, net.JoinHostPort(db.Host, db.Port), err)
+	}
+	if username == "" {
+		username = db.Username
+	}
+
+	return username, password, nil
+}
+
+type primaryKey struct{}
+
+// WithPrimary returns a copy of the context which sends the reads of gorm to the primary database instead of a
+// read replica, e.g. to read a row right after writing it, without the replication lag.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary tells whether the reads of the context go to the primary database.
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// useReadReplicas routes the reads to the replicas of the resolver, unless the context of the statement comes
+// from `WithPrimary`. The writes and the transactions always go to the primary.
+func useReadReplicas(db *gorm.DB, resolver *dbresolver.DBResolver) error {
+	forcePrimary := func(db *gorm.DB) {
+		if ctx := db.Statement.Context; ctx != nil && UsesPrimary(ctx) {
+			dbresolver.Write.ModifyStatement(db.Statement)
+		}
+	}
+
+	// IMPORTANT: Register it before the resolver, so it runs first.
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("*").Register("bean:primary", forcePrimary),
+		cb.Row().Before("*").Register("bean:primary", forcePrimary),
+		cb.Raw().Before("*").Register("bean:primary", forcePrimary),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Use(resolver)
 }
 
 func createTenantConnectionsTableIfNotExist(masterDb *gorm.DB) error {
 
+	// IMPORTANT: The gorm tags of `TenantConnections` are MySQL specific.
+	if masterDb.Dialector.Name() == DriverPostgres {
+		return masterDb.Exec(createTenantConnectionsPostgres).Error
+	}
+
 	if !masterDb.Migrator().HasTable("TenantConnections") {
 		err := masterDb.Migrator().CreateTable(&TenantConnections{})
 		return err
@@ -0,0 +1,128 @@
+package dbdrivers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// namedPool fails every statement with its name, to tell which database a statement was sent to.
+type namedPool struct {
+	name string
+}
+
+func (p namedPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New(p.name)
+}
+
+func (p namedPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New(p.name)
+}
+
+func (p namedPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New(p.name)
+}
+
+func (p namedPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func namedDialector(name string) gorm.Dialector {
+	return mysql.New(mysql.Config{Conn: namedPool{name: name}, SkipInitializeWithVersion: true})
+}
+
+func Test_useReadReplicas(t *testing.T) {
+	db, err := gorm.Open(namedDialector("primary"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{namedDialector("replica")}})
+	require.NoError(t, useReadReplicas(db, resolver))
+
+	type user struct {
+		ID   uint64
+		Name string
+	}
+	ctx := context.Background()
+
+	var users []user
+	assert.EqualError(t, db.WithContext(ctx).Find(&users).Error, "replica")
+	assert.EqualError(t, db.WithContext(ctx).Raw("SELECT * FROM users").Scan(&users).Error, "replica")
+	assert.EqualError(t, db.WithContext(ctx).Create(&user{Name: "bean"}).Error, "primary")
+	assert.EqualError(t, db.WithContext(ctx).Exec("UPDATE users SET name = ?", "bean").Error, "primary")
+
+	// Read after write.
+	primary := WithPrimary(ctx)
+	assert.True(t, UsesPrimary(primary))
+	assert.False(t, UsesPrimary(ctx))
+	assert.EqualError(t, db.WithContext(primary).Find(&users).Error, "primary")
+	assert.EqualError(t, db.WithContext(primary).Raw("SELECT * FROM users").Scan(&users).Error, "primary")
+}
+
+func Test_mysqlDriverConfig(t *testing.T) {
+	conn := &MySQLConnection{Database: "bean", Username: "root", Password: "p@ss:w/rd", Host: "mysql", Port: "3306"}
+
+	cfg, err := mysqlDriverConfig(conn, 0, "mysql-read", "3307")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", cfg.Net)
+	assert.Equal(t, "mysql-read:3307", cfg.Addr)
+	assert.Equal(t, "bean", cfg.DBName)
+	assert.Equal(t, "root", cfg.User)
+	assert.Equal(t, "p@ss:w/rd", cfg.Passwd)
+	assert.True(t, cfg.ParseTime)
+	assert.True(t, cfg.MultiStatements)
+	assert.Nil(t, cfg.TLS)
+
+	conn.Params = "multiStatements=false&loc=Local&interpolateParams=true&charset=utf8mb4"
+	conn.TLS = SQLTLS{On: true, ServerName: "mysql.example.com"}
+	cfg, err = mysqlDriverConfig(conn, 0, conn.Host, conn.Port)
+	require.NoError(t, err)
+	assert.True(t, cfg.ParseTime)
+	assert.False(t, cfg.MultiStatements)
+	assert.True(t, cfg.InterpolateParams)
+	assert.Equal(t, time.Local, cfg.Loc)
+	assert.Equal(t, "utf8mb4", cfg.Params["charset"])
+	require.NotNil(t, cfg.TLS)
+	assert.Equal(t, "mysql.example.com", cfg.TLS.ServerName)
+
+	_, err = mysqlDriverConfig(&MySQLConnection{Host: "mysql", Port: "3306", Params: "charset=%zz"}, 0, "mysql", "3306")
+	assert.ErrorContains(t, err, "invalid mysql params")
+
+	_, err = mysqlDriverConfig(&MySQLConnection{Host: "mysql", Port: "3306", TLS: SQLTLS{On: true, CAFile: filepath.Join(t.TempDir(), "ca.pem")}}, 0, "mysql", "3306")
+	assert.Error(t, err)
+}
+
+func Test_mysqlDriverConfig_credentials(t *testing.T) {
+	var got []MySQLDatabase
+	MySQLCredentials = func(ctx context.Context, db MySQLDatabase) (string, string, error) {
+		got = append(got, db)
+		return "", "", errors.New("token expired")
+	}
+	t.Cleanup(func() { MySQLCredentials = nil })
+
+	conn := &MySQLConnection{Database: "tenant_1", Username: "app", Password: "stale", Host: "mysql", Port: "3306"}
+	cfg, err := mysqlDriverConfig(conn, 1, conn.Host, conn.Port)
+	require.NoError(t, err)
+
+	connector, err := mysqldriver.NewConnector(cfg)
+	require.NoError(t, err)
+
+	// IMPORTANT: The provider is called on every dial, before the network connection is made.
+	for i := 0; i < 2; i++ {
+		_, err = connector.Connect(context.Background())
+		assert.ErrorContains(t, err, "failed to get the mysql credentials of mysql:3306: token expired")
+	}
+
+	want := MySQLDatabase{TenantID: 1, Driver: DriverMySQL, Host: "mysql", Port: "3306", Database: "tenant_1", Username: "app"}
+	assert.Equal(t, []MySQLDatabase{want, want}, got)
+}
@@ -0,0 +1,107 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// createTenantConnectionsPostgres is the PostgreSQL version of the DDL of `TenantConnections`. PostgreSQL has no
+// `ON UPDATE CURRENT_TIMESTAMP`, gorm sets `UpdatedAt` on every update instead.
+const createTenantConnectionsPostgres = `CREATE TABLE IF NOT EXISTS "TenantConnections" (
+	"Id" BIGSERIAL PRIMARY KEY,
+	"Uuid" CHAR(36) NOT NULL UNIQUE,
+	"TenantId" BIGINT NOT NULL,
+	"Code" VARCHAR(20) NOT NULL UNIQUE,
+	"Connections" JSONB NOT NULL,
+	"CreatedBy" BIGINT NOT NULL DEFAULT 0,
+	"UpdatedBy" BIGINT NOT NULL DEFAULT 0,
+	"DeletedBy" BIGINT DEFAULT NULL,
+	"CreatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	"UpdatedAt" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	"DeletedAt" TIMESTAMP NULL DEFAULT NULL
+)`
+
+// postgresDialector opens a pool from the pgx config, like `mysqlDialector`.
+func postgresDialector(conn *MySQLConnection, tenantID uint64, host, port string) (gorm.Dialector, error) {
+	cfg, err := postgresDriverConfig(conn, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []stdlib.OptionOpenDB
+	if provider := MySQLCredentials; provider != nil {
+		db := MySQLDatabase{TenantID: tenantID, Driver: DriverPostgres, Host: host, Port: port, Database: conn.Database, Username: conn.Username}
+		opts = append(opts, stdlib.OptionBeforeConnect(func(ctx context.Context, cfg *pgx.ConnConfig) error {
+			username, password, err := providedCredentials(ctx, provider, db)
+			if err != nil {
+				return err
+			}
+			cfg.User, cfg.Password = username, password
+			return nil
+		}))
+	}
+
+	return postgres.New(postgres.Config{Conn: stdlib.OpenDB(*cfg, opts...)}), nil
+}
+
+// postgresDriverConfig returns the pgx config to dial the database of the connection on the host. The params
+// are the ones of a connection URI, e.g. `sslmode`, `search_path` or `application_name`.
+func postgresDriverConfig(conn *MySQLConnection, host, port string) (*pgx.ConnConfig, error) {
+	if _, err := url.ParseQuery(conn.Params); err != nil {
+		return nil, fmt.Errorf("invalid postgres params %q: %w", conn.Params, err)
+	}
+
+	dsn := url.URL{Scheme: "postgres", Host: net.JoinHostPort(host, port), Path: "/" + conn.Database, RawQuery: conn.Params}
+	cfg, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// IMPORTANT: Not in the URI, so the credentials don't need to be escaped.
+	cfg.User, cfg.Password = conn.Username, conn.Password
+
+	if conn.TLS.On {
+		tlsCfg, err := clientTLSConfig(conn.TLS.CAFile, conn.TLS.CertFile, conn.TLS.KeyFile, conn.TLS.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ServerName = conn.TLS.ServerName
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = host
+		}
+		cfg.TLSConfig = tlsCfg
+		// IMPORTANT: Never fall back to a plaintext connection, unlike `sslmode=prefer`.
+		cfg.Fallbacks = nil
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,99 @@
+package dbdrivers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// execPool records the statements it executes.
+type execPool struct {
+	namedPool
+	queries []string
+}
+
+func (p *execPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.queries = append(p.queries, query)
+	return driver.RowsAffected(0), nil
+}
+
+func Test_postgresDriverConfig(t *testing.T) {
+	conn := &MySQLConnection{Driver: DriverPostgres, Database: "bean", Username: "postgres", Password: "p@ss:w/rd"}
+
+	cfg, err := postgresDriverConfig(conn, "postgres-read", "5433")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres-read", cfg.Host)
+	assert.Equal(t, uint16(5433), cfg.Port)
+	assert.Equal(t, "bean", cfg.Database)
+	assert.Equal(t, "postgres", cfg.User)
+	assert.Equal(t, "p@ss:w/rd", cfg.Password)
+
+	conn.Params = "sslmode=disable&search_path=myschema&application_name=bean"
+	cfg, err = postgresDriverConfig(conn, "postgres", "5432")
+	require.NoError(t, err)
+	assert.Nil(t, cfg.TLSConfig)
+	assert.Equal(t, "myschema", cfg.RuntimeParams["search_path"])
+	assert.Equal(t, "bean", cfg.RuntimeParams["application_name"])
+
+	conn.Params = ""
+	conn.TLS = SQLTLS{On: true}
+	cfg, err = postgresDriverConfig(conn, "postgres", "5432")
+	require.NoError(t, err)
+	require.NotNil(t, cfg.TLSConfig)
+	assert.Equal(t, "postgres", cfg.TLSConfig.ServerName)
+	assert.Empty(t, cfg.Fallbacks)
+
+	_, err = postgresDriverConfig(&MySQLConnection{Params: "sslmode=%zz"}, "postgres", "5432")
+	assert.ErrorContains(t, err, "invalid postgres params")
+
+	_, err = postgresDriverConfig(&MySQLConnection{TLS: SQLTLS{On: true, CAFile: filepath.Join(t.TempDir(), "ca.pem")}}, "postgres", "5432")
+	assert.Error(t, err)
+}
+
+func Test_postgresDialector_credentials(t *testing.T) {
+	var got []MySQLDatabase
+	MySQLCredentials = func(ctx context.Context, db MySQLDatabase) (string, string, error) {
+		got = append(got, db)
+		return "", "", errors.New("token expired")
+	}
+	t.Cleanup(func() { MySQLCredentials = nil })
+
+	conn := &MySQLConnection{Driver: DriverPostgres, Database: "tenant_1", Username: "app", Host: "postgres"}
+	dialector, err := sqlDialector(conn, 1, conn.Host, conn.Port)
+	require.NoError(t, err)
+
+	sqlDB := dialector.(*postgres.Dialector).Conn.(*sql.DB)
+	defer sqlDB.Close()
+
+	// IMPORTANT: The provider is called on every dial, before the network connection is made.
+	err = sqlDB.PingContext(context.Background())
+	assert.ErrorContains(t, err, "failed to get the postgres credentials of postgres:5432: token expired")
+
+	require.NotEmpty(t, got)
+	assert.Equal(t, MySQLDatabase{TenantID: 1, Driver: DriverPostgres, Host: "postgres", Port: "5432", Database: "tenant_1", Username: "app"}, got[0])
+}
+
+func Test_sqlDialector_unsupported(t *testing.T) {
+	_, err := sqlDialector(&MySQLConnection{Driver: "oracle"}, 0, "oracle", "1521")
+	assert.EqualError(t, err, `unsupported sql driver "oracle", must be mysql or postgres`)
+}
+
+func Test_createTenantConnectionsTableIfNotExist_postgres(t *testing.T) {
+	pool := &execPool{namedPool: namedPool{name: "postgres"}}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+
+	require.NoError(t, createTenantConnectionsTableIfNotExist(db))
+	require.Len(t, pool.queries, 1)
+	assert.Contains(t, pool.queries[0], `CREATE TABLE IF NOT EXISTS "TenantConnections"`)
+	assert.Contains(t, pool.queries[0], `"Connections" JSONB NOT NULL`)
+}
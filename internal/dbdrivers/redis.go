@@ -81,7 +81,11 @@ func InitRedisTenantConns(config RedisConfig, masterMySQL *gorm.DB, tenantAlterD
 	tenantCfgs := GetAllTenantCfgs(masterMySQL)
 
 	if len(tenantCfgs) > 0 {
-		return getAllRedisTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+		tenantRedisDB, err := getAllRedisTenantDB(config, tenantCfgs, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+		if err != nil {
+			panic(err)
+		}
+		return tenantRedisDB
 	}
 
 	return nil
@@ -96,11 +100,15 @@ func InitRedisMasterConn(config RedisConfig) *RedisDBConn {
 
 		masterRedisDB = &RedisDBConn{}
 
-		masterRedisDB.Primary, masterRedisDB.Name = connectRedisDB(
+		var err error
+		masterRedisDB.Primary, masterRedisDB.Name, err = connectRedisDB(
 			masterCfg.Password, masterCfg.Host, masterCfg.Port, masterCfg.Database,
 			config.Maxretries, config.PoolSize, config.MinIdleConnections, config.DialTimeout,
 			config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, false,
 		)
+		if err != nil {
+			panic(err)
+		}
 
 		// when `len(strings.Split(masterCfg.Host, ","))>1`, it means that Redis will operate in `cluster` mode, and the `read` config will be ignored.
 		if len(strings.Split(masterCfg.Host, ",")) > 1 {
@@ -111,11 +119,14 @@ func InitRedisMasterConn(config RedisConfig) *RedisDBConn {
 			redisReadConn := make(map[uint64]redis.UniversalClient, len(masterCfg.Reads))
 
 			for i, readHost := range masterCfg.Reads {
-				redisReadConn[uint64(i)], _ = connectRedisDB(
+				redisReadConn[uint64(i)], _, err = connectRedisDB(
 					masterCfg.Password, readHost, masterCfg.Port, masterCfg.Database,
 					config.Maxretries, config.PoolSize, config.MinIdleConnections, config.DialTimeout,
 					config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, true,
 				)
+				if err != nil {
+					panic(err)
+				}
 			}
 
 			masterRedisDB.Reads = redisReadConn
@@ -719,6 +730,22 @@ func (clients *RedisDBConn) Run(ctx context.Context, script *redis.Script, keys
 	return v, nil
 }
 
+// Close closes the primary and the read replica clients. It returns the first error.
+func (clients *RedisDBConn) Close() error {
+	var err error
+	if clients.Primary != nil {
+		err = clients.Primary.Close()
+	}
+
+	for _, read := range clients.Reads {
+		if rErr := read.Close(); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+
+	return errors.WithStack(err)
+}
+
 func wrapMSet(ctx context.Context, clients redis.UniversalClient, ttl time.Duration, values ...interface{}) error {
 	var dst []interface{}
 	switch len(values) {
@@ -784,88 +811,133 @@ func wrapMGet(ctx context.Context, clients redis.UniversalClient, keys ...string
 }
 
 // getAllRedisTenantDB returns a singleton tenant db connection for each tenant.
-func getAllRedisTenantDB(config RedisConfig, tenantCfgs []*TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string) map[uint64]*RedisDBConn {
+func getAllRedisTenantDB(config RedisConfig, tenantCfgs []*TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string) (map[uint64]*RedisDBConn, error) {
 
 	tenantRedisDB := make(map[uint64]*RedisDBConn, len(tenantCfgs))
 
 	for _, t := range tenantCfgs {
+		conn, err := openRedisTenantDB(config, t, tenantAlterDbHostParam, tenantDBPassPhraseKey)
+		if err != nil {
+			return nil, err
+		}
+		if conn != nil {
+			tenantRedisDB[t.TenantID] = conn
+		}
+	}
 
-		var cfgsMap map[string]map[string]interface{}
-		var err error
-		if t.Connections != nil {
-			if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
-				panic(err)
-			}
+	return tenantRedisDB, nil
+}
+
+// openRedisTenantDB returns the redis connection of a tenant, or nil if it has no `redis` object.
+func openRedisTenantDB(config RedisConfig, t *TenantConnections, tenantAlterDbHostParam, tenantDBPassPhraseKey string) (*RedisDBConn, error) {
+
+	var cfgsMap map[string]map[string]interface{}
+	var err error
+	if t.Connections != nil {
+		if err = json.Unmarshal(t.Connections, &cfgsMap); err != nil {
+			return nil, errors.WithStack(err)
 		}
+	}
 
-		// IMPORTANT: Check the `redis` object exist in the Connections column or not.
-		if redisCfg, ok := cfgsMap["redis"]; ok {
-			password := redisCfg["password"].(string)
+	// IMPORTANT: Check the `redis` object exist in the Connections column or not.
+	redisCfg, ok := cfgsMap["redis"]
+	if !ok {
+		return nil, nil
+	}
 
-			// IMPORTANT: If tenant database password is encrypted in master mysql db config.
-			if tenantDBPassPhraseKey != "" {
-				password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
-				if err != nil {
-					panic(err)
-				}
-			}
+	stringOf := func(key string) (string, error) {
+		value, ok := redisCfg[key].(string)
+		if !ok {
+			return "", errors.Errorf("redis.%s of tenant %d must be a string", key, t.TenantID)
+		}
+		return value, nil
+	}
 
-			host := redisCfg["host"].(string)
+	password, err := stringOf("password")
+	if err != nil {
+		return nil, err
+	}
 
-			// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
-			// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
-			// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
-			if tenantAlterDbHostParam != "" && redisCfg[tenantAlterDbHostParam] != nil {
-				host = redisCfg[tenantAlterDbHostParam].(string)
-			}
+	// IMPORTANT: If tenant database password is encrypted in master mysql db config.
+	if tenantDBPassPhraseKey != "" {
+		password, err = aes.BeanAESDecrypt(tenantDBPassPhraseKey, password)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			port := redisCfg["port"].(string)
-			var dbName int
-			if _dbName, ok := redisCfg["database"].(float64); ok {
-				dbName = int(_dbName)
-			}
+	host, err := stringOf("host")
+	if err != nil {
+		return nil, err
+	}
 
-			tenantRedisDB[t.TenantID] = &RedisDBConn{}
+	// IMPORTANT - If a command or service wants to use a different `host` parameter for tenant database connection
+	// then it's easy to do just by passing that parameter string name using `bean.TenantAlterDbHostParam`.
+	// Therfore, `bean` will overwrite all host string in `TenantConnections`.`Connections` JSON.
+	if tenantAlterDbHostParam != "" && redisCfg[tenantAlterDbHostParam] != nil {
+		if host, err = stringOf(tenantAlterDbHostParam); err != nil {
+			return nil, err
+		}
+	}
 
-			tenantRedisDB[t.TenantID].Primary, tenantRedisDB[t.TenantID].Name = connectRedisDB(
-				password, host, port, dbName, config.Maxretries, config.PoolSize, config.MinIdleConnections,
-				config.DialTimeout, config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, false,
-			)
+	port, err := stringOf("port")
+	if err != nil {
+		return nil, err
+	}
+	var dbName int
+	if _dbName, ok := redisCfg["database"].(float64); ok {
+		dbName = int(_dbName)
+	}
 
-			// IMPORTANT: Let's initialize the read replica connection if it is available.
-			// when `len(strings.Split(host, ","))>1`, it means that Redis will operate in `cluster` mode, and the `read` config will be ignored.
-			if len(strings.Split(host, ",")) > 1 {
+	conn := &RedisDBConn{}
 
-				tenantRedisDB[t.TenantID].isCluster = true
+	conn.Primary, conn.Name, err = connectRedisDB(
+		password, host, port, dbName, config.Maxretries, config.PoolSize, config.MinIdleConnections,
+		config.DialTimeout, config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, false,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-			} else if readHostArray, ok := redisCfg["reads"]; ok && len(strings.Split(host, ",")) == 1 {
-				if readHost, ok := readHostArray.([]interface{}); ok {
-					redisReadConn := make(map[uint64]redis.UniversalClient, len(readHost))
+	// IMPORTANT: Let's initialize the read replica connection if it is available.
+	// when `len(strings.Split(host, ","))>1`, it means that Redis will operate in `cluster` mode, and the `read` config will be ignored.
+	if len(strings.Split(host, ",")) > 1 {
 
-					for i, h := range readHost {
+		conn.isCluster = true
 
-						var host, port = h.(string), redisCfg["port"].(string)
+	} else if readHostArray, ok := redisCfg["reads"]; ok {
+		if readHost, ok := readHostArray.([]interface{}); ok {
+			conn.Reads = make(map[uint64]redis.UniversalClient, len(readHost))
 
-						redisReadConn[uint64(i)], _ = connectRedisDB(
-							password, host, port, dbName, config.Maxretries, config.PoolSize, config.MinIdleConnections,
-							config.DialTimeout, config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, true,
-						)
-					}
+			for i, h := range readHost {
+				host, ok := h.(string)
+				if !ok {
+					conn.Close()
+					return nil, errors.Errorf("redis.reads[%d] of tenant %d must be a string", i, t.TenantID)
+				}
 
-					tenantRedisDB[t.TenantID].Reads = redisReadConn
-					tenantRedisDB[t.TenantID].readCount = len(tenantRedisDB[t.TenantID].Reads)
+				read, _, err := connectRedisDB(
+					password, host, port, dbName, config.Maxretries, config.PoolSize, config.MinIdleConnections,
+					config.DialTimeout, config.ReadTimeout, config.WriteTimeout, config.PoolTimeout, true,
+				)
+				if err != nil {
+					conn.Close()
+					return nil, err
 				}
+				conn.Reads[uint64(i)] = read
 			}
+
+			conn.readCount = len(conn.Reads)
 		}
 	}
 
-	return tenantRedisDB
+	return conn, nil
 }
 
 func connectRedisDB(
 	password, host, port string, dbName int, maxretries, poolsize, minIdleConnections int,
 	dialTimeout, readTimeout, writeTimeout, poolTimeout time.Duration, readOnly bool,
-) (redis.UniversalClient, int) {
+) (redis.UniversalClient, int, error) {
 
 	hosts := strings.Split(host, ",")
 	for i, h := range hosts {
@@ -891,10 +963,11 @@ func connectRedisDB(
 	// Check the connection
 	_, err := rdb.Ping(context.TODO()).Result()
 	if err != nil {
-		panic(err)
+		rdb.Close()
+		return nil, 0, errors.WithStack(err)
 	}
 
-	return rdb, dbName
+	return rdb, dbName, nil
 }
 
 func GetRedisCachePrefix() string {
@@ -0,0 +1,117 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dbdrivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// TenantDBs holds the connections of a tenant opened by `OpenTenantDBs`.
+type TenantDBs struct {
+	MySQL     *gorm.DB
+	MySQLName string
+	Mongo     *mongo.Client
+	MongoName string
+	Redis     *RedisDBConn
+}
+
+// LoadTenantCfgs returns the tenants of the master db, without the soft deleted ones. Unlike `GetAllTenantCfgs`,
+// it returns the error instead of panicking, so it can be called at runtime.
+func LoadTenantCfgs(ctx context.Context, db *gorm.DB) ([]*TenantConnections, error) {
+	var tt []*TenantConnections
+
+	if err := db.WithContext(ctx).Table("TenantConnections").Find(&tt).Error; err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+// InitTenantCfgs returns the tenants of the master db without opening any connection, so `OpenTenantDBs` opens
+// the connections of each tenant, at startup or on its first use, without panicking.
+func InitTenantCfgs(redisConfig RedisConfig, master *gorm.DB) []*TenantConnections {
+	if err := createTenantConnectionsTableIfNotExist(master); err != nil {
+		panic(err)
+	}
+
+	cachePrefix = redisConfig.Prefix
+
+	return GetAllTenantCfgs(master)
+}
+
+// OpenTenantDBs opens the MySQL, mongo and redis connections of a tenant. Unlike the `Init*TenantConns`
+// functions, it returns the error instead of panicking, and closes the connections already opened.
+func OpenTenantDBs(mysqlCfg SQLConfig, mongoCfg MongoConfig, redisCfg RedisConfig, t *TenantConnections,
+	tenantAlterDbHostParam, tenantDBPassPhraseKey string, logger echo.Logger) (TenantDBs, error) {
+
+	var dbs TenantDBs
+	var err error
+
+	fail := func(err error) (TenantDBs, error) {
+		dbs.Close(context.Background())
+		return TenantDBs{}, fmt.Errorf("failed to open the connections of tenant %d: %w", t.TenantID, err)
+	}
+
+	if dbs.MySQL, dbs.MySQLName, err = openMysqlTenantDB(mysqlCfg, t, tenantAlterDbHostParam, tenantDBPassPhraseKey); err != nil {
+		return fail(err)
+	}
+	if dbs.Mongo, dbs.MongoName, err = openMongoTenantDB(mongoCfg, t, tenantAlterDbHostParam, tenantDBPassPhraseKey, logger); err != nil {
+		return fail(err)
+	}
+	if dbs.Redis, err = openRedisTenantDB(redisCfg, t, tenantAlterDbHostParam, tenantDBPassPhraseKey); err != nil {
+		return fail(err)
+	}
+
+	return dbs, nil
+}
+
+// Close closes the connections which are open.
+func (dbs TenantDBs) Close(ctx context.Context) error {
+	var errs []error
+
+	if dbs.MySQL != nil {
+		if sqlDB, err := dbs.MySQL.DB(); err != nil {
+			errs = append(errs, err)
+		} else if err := sqlDB.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if dbs.Mongo != nil {
+		if err := dbs.Mongo.Disconnect(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if dbs.Redis != nil {
+		if err := dbs.Redis.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
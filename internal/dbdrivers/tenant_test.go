@@ -0,0 +1,41 @@
+package dbdrivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestOpenTenantDBs_errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections string
+		wantErr     string
+	}{
+		{
+			name:        "invalid json",
+			connections: `{"mysql": [}`,
+			wantErr:     "failed to open the connections of tenant 1: invalid character '}' looking for beginning of value",
+		},
+		{
+			name:        "unsupported sql driver",
+			connections: `{"mysql": {"driver": "oracle", "host": "oracle", "database": "tenant_1"}}`,
+			wantErr:     `failed to open the connections of tenant 1: unsupported sql driver "oracle", must be mysql or postgres`,
+		},
+		{
+			name:        "redis host not a string",
+			connections: `{"redis": {"password": "", "host": 6379, "port": "6379"}}`,
+			wantErr:     "failed to open the connections of tenant 1: redis.host of tenant 1 must be a string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The errors are returned, they do not panic.
+			dbs, err := OpenTenantDBs(SQLConfig{}, MongoConfig{}, RedisConfig{},
+				&TenantConnections{TenantID: 1, Connections: datatypes.JSON(tt.connections)}, "", "", nil)
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Equal(t, TenantDBs{}, dbs)
+		})
+	}
+}
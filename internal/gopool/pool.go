@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/panjf2000/ants/v2"
 )
@@ -67,6 +68,24 @@ func UnregisterAllPools() {
 	pools = make(map[string]*ants.Pool)
 }
 
+// ReleaseAllPools releases and unregisters all the pools. It waits up to the timeout for the running
+// workers of every pool to finish.
+func ReleaseAllPools(timeout time.Duration) error {
+	poolsMu.Lock()
+	released := pools
+	pools = make(map[string]*ants.Pool)
+	poolsMu.Unlock()
+
+	var errs []error
+	for name, pool := range released {
+		if err := pool.ReleaseTimeout(timeout); err != nil {
+			errs = append(errs, fmt.Errorf("gopool: release pool %q: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // Pools returns a sorted list of the names of the registered pools.
 func Pools() []string {
 	poolsMu.RLock()
@@ -93,3 +112,14 @@ func GetPool(poolName string) (*ants.Pool, error) {
 
 	return pool, nil
 }
+
+// Tune changes the capacity of a registered pool at runtime.
+func Tune(poolName string, size int) error {
+	pool, err := GetPool(poolName)
+	if err != nil {
+		return err
+	}
+
+	pool.Tune(size)
+	return nil
+}
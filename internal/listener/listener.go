@@ -0,0 +1,141 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package listener creates the listeners of the HTTP servers: TCP, Unix domain socket or the sockets
+// inherited from systemd (socket activation).
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd, see sd_listen_fds(3).
+const listenFdsStart = 3
+
+// Unix listens on a Unix domain socket. A stale socket file left by a crashed process is removed first.
+// The socket file is removed when the listener is closed. `mode` is applied to the socket file if it isn't 0.
+func Unix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	return ln, nil
+}
+
+// ParseMode parses an octal file mode like `0660`.
+func ParseMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q, must be octal like 0660", mode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+// Socket is a listener passed by systemd with its name.
+type Socket struct {
+	net.Listener
+	// Name is the `FileDescriptorName=` of the socket unit, which defaults to the name of the unit, e.g.
+	// `myapp.socket`, or the index of the socket, e.g. `0`, without `LISTEN_FDNAMES`.
+	Name string
+}
+
+// Systemd returns the listeners passed by systemd socket activation (`LISTEN_PID`, `LISTEN_FDS` and
+// `LISTEN_FDNAMES`) in the order of the file descriptors. It returns nil if the process wasn't socket
+// activated. The environment variables are unset so that the child processes don't inherit them.
+func Systemd() ([]Socket, error) {
+	return systemd(listenFdsStart)
+}
+
+func systemd(fdsStart int) ([]Socket, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	sockets := make([]Socket, 0, nfds)
+	var errs []error
+	for i := 0; i < nfds; i++ {
+		fd := fdsStart + i
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(file)
+		// IMPORTANT: `FileListener` duplicates the file descriptor with close-on-exec, close the inherited one.
+		file.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("socket %q: %w", name, err))
+			continue
+		}
+
+		sockets = append(sockets, Socket{Listener: ln, Name: name})
+	}
+
+	if len(errs) > 0 {
+		for _, s := range sockets {
+			s.Close()
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	return sockets, nil
+}
@@ -0,0 +1,88 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bean.sock")
+
+	// A stale socket file is replaced.
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	ln, err := Unix(path, 0o660)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), fi.Mode().Perm())
+
+	// The socket file is removed on close.
+	require.NoError(t, ln.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// A regular file is never removed.
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+	_, err = Unix(path, 0)
+	assert.Error(t, err)
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("0660")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), mode)
+
+	mode, err = ParseMode("")
+	require.NoError(t, err)
+	assert.Zero(t, mode)
+
+	_, err = ParseMode("rw")
+	assert.Error(t, err)
+}
+
+func TestSystemd_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := Systemd()
+	require.NoError(t, err)
+	assert.Nil(t, listeners)
+}
+
+func TestSystemd(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	file, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "foo.socket")
+
+	// IMPORTANT: The inherited file descriptor is closed by `systemd`, don't close `file`.
+	sockets, err := systemd(int(file.Fd()))
+	require.NoError(t, err)
+	require.Len(t, sockets, 1)
+	defer sockets[0].Close()
+
+	assert.Equal(t, "foo.socket", sockets[0].Name)
+	assert.Equal(t, tcp.Addr().String(), sockets[0].Addr().String())
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	conn, err := net.Dial("tcp", sockets[0].Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+}
@@ -0,0 +1,86 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/v2/config"
+)
+
+type corsGroup struct {
+	prefix  string
+	handler echo.HandlerFunc
+}
+
+// CORS applies the CORS policy of the longest matching route group, or the default policy. All the policies
+// live in one middleware so that the preflight requests of a group are answered by its own policy.
+func CORS(cfg config.CORS, allowMethods []string) echo.MiddlewareFunc {
+	groups := make([]config.CORSGroup, len(cfg.Groups))
+	copy(groups, cfg.Groups)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].PathPrefix) > len(groups[j].PathPrefix)
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		defaultHandler := echomiddleware.CORSWithConfig(corsConfig(cfg.CORSPolicy, allowMethods))(next)
+
+		handlers := make([]corsGroup, 0, len(groups))
+		for _, g := range groups {
+			handlers = append(handlers, corsGroup{
+				prefix:  strings.TrimSuffix(g.PathPrefix, "/"),
+				handler: echomiddleware.CORSWithConfig(corsConfig(g.CORSPolicy, allowMethods))(next),
+			})
+		}
+
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			for _, g := range handlers {
+				if path == g.prefix || strings.HasPrefix(path, g.prefix+"/") {
+					return g.handler(c)
+				}
+			}
+
+			return defaultHandler(c)
+		}
+	}
+}
+
+func corsConfig(policy config.CORSPolicy, allowMethods []string) echomiddleware.CORSConfig {
+	allowOrigins := policy.AllowOrigins
+	if len(allowOrigins) == 0 {
+		allowOrigins = []string{"*"}
+	}
+
+	return echomiddleware.CORSConfig{
+		AllowOrigins:     allowOrigins,
+		AllowMethods:     allowMethods,
+		AllowHeaders:     policy.AllowHeaders,
+		ExposeHeaders:    policy.ExposeHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           int(policy.MaxAge.Seconds()),
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := config.CORS{
+		CORSPolicy: config.CORSPolicy{
+			AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+			AllowHeaders:     []string{"Authorization"},
+			ExposeHeaders:    []string{"X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Groups: []config.CORSGroup{
+			{PathPrefix: "/public", CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"*"}}},
+		},
+	}
+
+	e := echo.New()
+	e.Use(CORS(cfg, []string{http.MethodGet, http.MethodPost}))
+	e.GET("/*", func(c echo.Context) error { return c.String(http.StatusOK, "OK") })
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		wantOrigin  string
+		wantCreds   string
+		wantMaxAge  string
+		wantExposed string
+	}{
+		{
+			name:        "allowed origin",
+			method:      http.MethodGet,
+			path:        "/users",
+			origin:      "https://app.example.com",
+			wantOrigin:  "https://app.example.com",
+			wantCreds:   "true",
+			wantExposed: "X-Request-ID",
+		},
+		{
+			name:        "wildcard subdomain",
+			method:      http.MethodGet,
+			path:        "/users",
+			origin:      "https://shop.example.org",
+			wantOrigin:  "https://shop.example.org",
+			wantCreds:   "true",
+			wantExposed: "X-Request-ID",
+		},
+		{
+			name:   "unknown origin",
+			method: http.MethodGet,
+			path:   "/users",
+			origin: "https://evil.com",
+		},
+		{
+			name:       "preflight",
+			method:     http.MethodOptions,
+			path:       "/users",
+			origin:     "https://app.example.com",
+			wantOrigin: "https://app.example.com",
+			wantCreds:  "true",
+			wantMaxAge: "600",
+		},
+		{
+			name:       "group override",
+			method:     http.MethodGet,
+			path:       "/public/docs",
+			origin:     "https://evil.com",
+			wantOrigin: "*",
+		},
+		{
+			name:        "not a group path",
+			method:      http.MethodGet,
+			path:        "/publicity",
+			origin:      "https://evil.com",
+			wantOrigin:  "",
+			wantExposed: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantOrigin, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			assert.Equal(t, tt.wantCreds, rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+			assert.Equal(t, tt.wantMaxAge, rec.Header().Get(echo.HeaderAccessControlMaxAge))
+			assert.Equal(t, tt.wantExposed, rec.Header().Get(echo.HeaderAccessControlExposeHeaders))
+		})
+	}
+}
@@ -3,29 +3,25 @@ package regex
 import (
 	"errors"
 	"regexp"
+	"sync/atomic"
 )
 
-var traceSkipPaths []*regexp.Regexp
+// The compiled skip paths are swapped atomically so that they can be recompiled while serving requests
+// (e.g. when the config file is reloaded).
+var (
+	traceSkipPaths      atomic.Pointer[[]*regexp.Regexp]
+	accessLogSkipPaths  atomic.Pointer[[]*regexp.Regexp]
+	prometheusSkipPaths atomic.Pointer[[]*regexp.Regexp]
+)
 
 func CompileTraceSkipPaths(skipPaths []string) {
-	uniquePaths := make(map[string]struct{})
-	for _, path := range skipPaths {
-		uniquePaths[path] = struct{}{}
-	}
-
-	for path := range uniquePaths {
-		traceSkipPaths = append(traceSkipPaths, regexp.MustCompile(path))
-	}
+	traceSkipPaths.Store(compileUnique(skipPaths))
 }
 
 // MatchAnyTraceSkipPath checks if the path should be skipped from tracing.
 // It returns false if compiling is not done beforehand and regexes are empty.
 func MatchAnyTraceSkipPath(path string) bool {
-	if len(traceSkipPaths) == 0 {
-		return false
-	}
-
-	for _, r := range traceSkipPaths {
+	for _, r := range TraceSkipPaths() {
 		if r.MatchString(path) {
 			return true
 		}
@@ -34,20 +30,19 @@ func MatchAnyTraceSkipPath(path string) bool {
 	return false
 }
 
-var AccessLogSkipPaths []*regexp.Regexp
+// TraceSkipPaths returns the currently compiled trace skip paths.
+func TraceSkipPaths() []*regexp.Regexp {
+	return load(&traceSkipPaths)
+}
 
 func CompileAccessLogSkipPaths(skipPaths []string) {
-	uniquePaths := make(map[string]struct{})
-	for _, path := range skipPaths {
-		uniquePaths[path] = struct{}{}
-	}
-
-	for path := range uniquePaths {
-		AccessLogSkipPaths = append(AccessLogSkipPaths, regexp.MustCompile(path))
-	}
+	accessLogSkipPaths.Store(compileUnique(skipPaths))
 }
 
-var PrometheusSkipPaths []*regexp.Regexp
+// AccessLogSkipPaths returns the currently compiled access log skip paths.
+func AccessLogSkipPaths() []*regexp.Regexp {
+	return load(&accessLogSkipPaths)
+}
 
 func CompilePrometheusSkipPaths(skipPaths []string, metricsPath string) error {
 
@@ -55,14 +50,33 @@ func CompilePrometheusSkipPaths(skipPaths []string, metricsPath string) error {
 		return errors.New("metrics path is empty")
 	}
 
+	prometheusSkipPaths.Store(compileUnique(append([]string{metricsPath}, skipPaths...)))
+	return nil
+}
+
+// PrometheusSkipPaths returns the currently compiled prometheus skip paths.
+func PrometheusSkipPaths() []*regexp.Regexp {
+	return load(&prometheusSkipPaths)
+}
+
+func compileUnique(skipPaths []string) *[]*regexp.Regexp {
 	uniquePaths := make(map[string]struct{})
+	regexes := make([]*regexp.Regexp, 0, len(skipPaths))
+
 	for _, path := range skipPaths {
+		if _, ok := uniquePaths[path]; ok {
+			continue
+		}
 		uniquePaths[path] = struct{}{}
+		regexes = append(regexes, regexp.MustCompile(path))
 	}
-	uniquePaths[metricsPath] = struct{}{}
 
-	for path := range uniquePaths {
-		PrometheusSkipPaths = append(PrometheusSkipPaths, regexp.MustCompile(path))
+	return &regexes
+}
+
+func load(p *atomic.Pointer[[]*regexp.Regexp]) []*regexp.Regexp {
+	if regexes := p.Load(); regexes != nil {
+		return *regexes
 	}
 	return nil
 }
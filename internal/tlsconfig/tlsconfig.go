@@ -0,0 +1,232 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package tlsconfig builds the TLS configuration of the HTTPS listener. The server certificate and the client
+// CA bundle are reloaded on file change or `SIGHUP` without restarting the server.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The values of `http.ssl.clientAuth`.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequired = "required"
+)
+
+// reloadDelay debounces the file events, e.g. a certificate and a key are written one after the other.
+const reloadDelay = 200 * time.Millisecond
+
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   string
+	MinVersion   uint16
+}
+
+// Reloader holds the current certificate and client CA pool. It is safe for concurrent use.
+type Reloader struct {
+	opts       Options
+	clientAuth tls.ClientAuthType
+	cert       atomic.Pointer[tls.Certificate]
+	clientCAs  atomic.Pointer[x509.CertPool]
+}
+
+// ParseClientAuth converts `none`, `optional` or `required` to the client authentication policy of `crypto/tls`.
+// The client certificates are always verified against the client CA bundle when they are presented.
+func ParseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(clientAuth) {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequired:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+
+	return tls.NoClientCert, fmt.Errorf("unknown client auth %q, must be one of %q, %q or %q",
+		clientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequired)
+}
+
+// New loads the certificate and the client CA bundle.
+func New(opts Options) (*Reloader, error) {
+	clientAuth, err := ParseClientAuth(opts.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientAuth != tls.NoClientCert && opts.ClientCAFile == "" {
+		return nil, errors.New("client CA file is required to verify the client certificates")
+	}
+
+	r := &Reloader{opts: opts, clientAuth: clientAuth}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again. The current certificate and client CA pool are kept if it fails.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the client CA file: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in the client CA file %q", r.opts.ClientCAFile)
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+
+	return nil
+}
+
+// Certificate returns the current certificate.
+func (r *Reloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// TLSConfig returns the configuration which always serves the current certificate and verifies the client
+// certificates with the current CA pool.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		// IMPORTANT: The config returned by `GetConfigForClient` replaces the one of `http.Server`, which adds `h2`
+		// to its own copy only. Without the protocols here, ALPN falls back to HTTP/1.1.
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: r.opts.MinVersion,
+		ClientAuth: r.clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+
+	cfg := base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.ClientCAs = r.clientCAs.Load()
+		return c, nil
+	}
+
+	return cfg
+}
+
+// Watch reloads the files when they change or the process receives `SIGHUP` until the context is done.
+// `onReload` is called with the result of every reload and with the errors of the watcher. The directories are
+// watched instead of the files so that atomic replacements, like the k8s secret volume updates, are detected.
+func (r *Reloader) Watch(ctx context.Context, onReload func(error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, file := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		files[absPath] = true
+		dirs[filepath.Dir(absPath)] = true
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// The timer fires once after the last file event.
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	reload := func() {
+		if onReload != nil {
+			onReload(r.Reload())
+		} else {
+			_ = r.Reload()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload()
+		case <-timer.C:
+			reload()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// IMPORTANT: k8s swaps the `..data` symlink of the secret volume, the files themselves never change.
+			if files[filepath.Clean(event.Name)] || strings.Contains(filepath.Base(event.Name), "..data") {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}
+}
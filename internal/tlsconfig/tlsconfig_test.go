@@ -0,0 +1,246 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "server-1", ca).write(t, certFile, keyFile)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, "server-1", mustParse(t, r).cert.Subject.CommonName)
+
+	newTestCert(t, "server-2", ca).write(t, certFile, keyFile)
+	require.NoError(t, r.Reload())
+	assert.Equal(t, "server-2", mustParse(t, r).cert.Subject.CommonName)
+
+	// A broken file keeps the current certificate.
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, "server-2", mustParse(t, r).cert.Subject.CommonName)
+}
+
+func mustParse(t *testing.T, r *Reloader) *testCert {
+	t.Helper()
+
+	cert, err := x509.ParseCertificate(r.Certificate().Certificate[0])
+	require.NoError(t, err)
+	return &testCert{cert: cert}
+}
+
+func TestReloader_ClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, caFile, "")
+	newTestCert(t, "server", ca).write(t, certFile, keyFile)
+	client := newTestCert(t, "client", ca)
+	stranger := newTestCert(t, "stranger", newTestCert(t, "other-ca", nil))
+
+	_, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequired})
+	assert.Error(t, err)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthRequired})
+	require.NoError(t, err)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	require.NoError(t, err)
+	defer ln.Close()
+
+	peers := make(chan string, 3)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err != nil {
+				peers <- ""
+			} else {
+				peers <- tlsConn.ConnectionState().VerifiedChains[0][0].Subject.CommonName
+			}
+			conn.Close()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(certs ...tls.Certificate) string {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots, Certificates: certs})
+		if err == nil {
+			// IMPORTANT: With TLS 1.3 the client learns the rejection on the first read.
+			_, _ = conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		return <-peers
+	}
+
+	assert.Equal(t, "client", dial(client.tlsCertificate()))
+	assert.Equal(t, "", dial())
+	assert.Equal(t, "", dial(stranger.tlsCertificate()))
+}
+
+func TestReloader_HTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "server", ca).write(t, certFile, keyFile)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(req.Proto))
+		}),
+		TLSConfig: r.TLSConfig(),
+	}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + ln.Addr().String())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "h2", resp.TLS.NegotiatedProtocol)
+}
+
+func TestParseClientAuth(t *testing.T) {
+	for in, want := range map[string]tls.ClientAuthType{
+		"":         tls.NoClientCert,
+		"none":     tls.NoClientCert,
+		"optional": tls.VerifyClientCertIfGiven,
+		"Required": tls.RequireAndVerifyClientCert,
+	} {
+		got, err := ParseClientAuth(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := ParseClientAuth("always")
+	assert.Error(t, err)
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	ca := newTestCert(t, "ca", nil)
+	newTestCert(t, "server-1", ca).write(t, certFile, keyFile)
+
+	r, err := New(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan error, 10)
+	go func() {
+		_ = r.Watch(ctx, func(err error) { reloaded <- err })
+	}()
+	// Wait for the watcher to be ready.
+	time.Sleep(100 * time.Millisecond)
+
+	newTestCert(t, "server-2", ca).write(t, certFile, keyFile)
+
+	select {
+	case err := <-reloaded:
+		require.NoError(t, err)
+		assert.Equal(t, "server-2", mustParse(t, r).cert.Subject.CommonName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate was not reloaded")
+	}
+}
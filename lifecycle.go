@@ -0,0 +1,230 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/retail-ai-inc/bean/v2/async"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/gopool"
+)
+
+// The priorities of the shutdown hooks which bean registers by itself. The shutdown hooks run in ascending
+// order of priority, so a hook registered with the default priority (0) runs before bean drains the async
+// tasks and closes the database connections.
+const (
+	ShutdownPriorityAsync    = 100
+	ShutdownPriorityDatabase = 200
+	ShutdownPrioritySentry   = 300
+)
+
+// HookFunc is executed at a lifecycle event of bean. The context is canceled when the hook times out.
+type HookFunc func(ctx context.Context) error
+
+type hook struct {
+	name     string
+	fn       HookFunc
+	priority int
+	timeout  time.Duration
+	seq      int
+}
+
+type HookOption func(*hook)
+
+// WithPriority sets the order of a hook. The hooks run in ascending order of priority. The start hooks with the
+// same priority run in the order of registration and the shutdown hooks in the reverse order, like `defer`.
+func WithPriority(priority int) HookOption {
+	return func(h *hook) {
+		h.priority = priority
+	}
+}
+
+// WithTimeout limits the execution time of a hook. The shutdown hooks are also limited by `http.shutdownTimeout`.
+func WithTimeout(timeout time.Duration) HookOption {
+	return func(h *hook) {
+		h.timeout = timeout
+	}
+}
+
+type lifecycle struct {
+	mu            sync.Mutex
+	seq           int
+	startHooks    []hook
+	shutdownHooks []hook
+	shutdownOnce  sync.Once
+	shutdownErr   error
+}
+
+func (l *lifecycle) add(hooks *[]hook, name string, fn HookFunc, opts []HookOption) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	h := hook{name: name, fn: fn, seq: l.seq}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	*hooks = append(*hooks, h)
+}
+
+// sorted returns a copy of the hooks in execution order.
+func (l *lifecycle) sorted(hooks []hook, lifo bool) []hook {
+	l.mu.Lock()
+	sorted := make([]hook, len(hooks))
+	copy(sorted, hooks)
+	l.mu.Unlock()
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].priority != sorted[j].priority {
+			return sorted[i].priority < sorted[j].priority
+		}
+		if lifo {
+			return sorted[i].seq > sorted[j].seq
+		}
+		return sorted[i].seq < sorted[j].seq
+	})
+
+	return sorted
+}
+
+// OnStart registers a hook which runs in `ServeAt` after `BeforeServe` and before the server starts to listen.
+// If a start hook fails, the server doesn't start and the shutdown hooks run to release the resources.
+func (b *Bean) OnStart(name string, fn HookFunc, opts ...HookOption) {
+	b.lifecycle.add(&b.lifecycle.startHooks, name, fn, opts)
+}
+
+// OnShutdown registers a hook which runs after the server stops accepting requests, e.g. to stop a worker
+// or close a client. Bean registers its own hooks to drain the async tasks and goroutine pools, close the
+// database connections and flush sentry.
+func (b *Bean) OnShutdown(name string, fn HookFunc, opts ...HookOption) {
+	b.lifecycle.add(&b.lifecycle.shutdownHooks, name, fn, opts)
+}
+
+// Start runs the start hooks in order and stops at the first failure.
+func (b *Bean) Start(ctx context.Context) error {
+	for _, h := range b.lifecycle.sorted(b.lifecycle.startHooks, false) {
+		if err := runHook(ctx, h); err != nil {
+			return fmt.Errorf("start hook %q failed: %w", h.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Shutdown runs the shutdown hooks in order until the context is done. Every hook runs even if a previous one
+// failed, the errors are joined. It is safe to call more than once, the hooks only run the first time.
+func (b *Bean) Shutdown(ctx context.Context) error {
+	b.lifecycle.shutdownOnce.Do(func() {
+		var errs []error
+		for _, h := range b.lifecycle.sorted(b.lifecycle.shutdownHooks, true) {
+			if err := runHook(ctx, h); err != nil {
+				errs = append(errs, fmt.Errorf("shutdown hook %q failed: %w", h.name, err))
+			}
+		}
+		b.lifecycle.shutdownErr = errors.Join(errs...)
+	})
+
+	return b.lifecycle.shutdownErr
+}
+
+// runHook executes the hook and gives up waiting when the hook times out, even if it ignores the context.
+func runHook(ctx context.Context, h hook) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- h.fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitGroup waits for the goroutines of `wg` until the context is done, e.g. a shutdown hook waits for the
+// in-flight work of a watcher before the database connections are closed.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainAsync waits for the in-flight async tasks, then releases the goroutine pools.
+func drainAsync(ctx context.Context) error {
+	if err := async.Wait(ctx); err != nil {
+		return fmt.Errorf("async tasks are still running: %w", err)
+	}
+
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	return gopool.ReleaseAllPools(timeout)
+}
+
+// flushSentry sends the buffered sentry events.
+func flushSentry(ctx context.Context) error {
+	timeout := config.Bean.Sentry.Timeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout <= 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+
+	if !sentry.Flush(timeout) {
+		return errors.New("failed to flush sentry events")
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBean_ShutdownHooks(t *testing.T) {
+	b := &Bean{}
+
+	var order []string
+	record := func(name string) HookFunc {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	b.OnShutdown("database", record("database"), WithPriority(ShutdownPriorityDatabase))
+	b.OnShutdown("worker", record("worker"))
+	b.OnShutdown("client", record("client"))
+	b.OnShutdown("failing", func(ctx context.Context) error { return errors.New("boom") })
+	b.OnShutdown("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithTimeout(10*time.Millisecond), WithPriority(ShutdownPriorityAsync))
+	b.OnShutdown("panic", func(ctx context.Context) error { panic("oops") }, WithPriority(ShutdownPrioritySentry))
+
+	err := b.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `shutdown hook "failing" failed: boom`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, `shutdown hook "panic" failed: panic: oops`)
+
+	// The hooks with the same priority run in the reverse order of registration.
+	assert.Equal(t, []string{"client", "worker", "database"}, order)
+
+	// The hooks run only once.
+	assert.Equal(t, err, b.Shutdown(context.Background()))
+	assert.Len(t, order, 3)
+}
+
+func TestBean_StartHooks(t *testing.T) {
+	b := &Bean{}
+
+	var order []string
+	b.OnStart("second", func(ctx context.Context) error {
+		order = append(order, "second")
+		return errors.New("boom")
+	})
+	b.OnStart("first", func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	}, WithPriority(-1))
+	b.OnStart("third", func(ctx context.Context) error {
+		order = append(order, "third")
+		return nil
+	})
+
+	err := b.Start(context.Background())
+	assert.EqualError(t, err, `start hook "second" failed: boom`)
+	assert.Equal(t, []string{"first", "second"}, order)
+}
+
+func TestWaitGroup(t *testing.T) {
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-release
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, waitGroup(ctx, &wg), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, waitGroup(context.Background(), &wg))
+}
@@ -0,0 +1,75 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/maintenance"
+)
+
+// useMaintenance adds the maintenance middleware and the `maintenance.api` endpoint. The state is kept in the
+// master redis if there is one. The `maintenance.active` flag is applied on config reload.
+func (b *Bean) useMaintenance() {
+	cfg := b.Config.Maintenance
+
+	var conn *dbdrivers.RedisDBConn
+	if b.DBConn != nil {
+		conn = b.DBConn.MasterRedisDB
+	}
+
+	sw := maintenance.NewSwitch(conn, cfg.RedisKey, cfg.CacheTTL)
+	sw.SetFlag(cfg.Active)
+	config.OnChange(func(_, newCfg *config.Config) {
+		sw.SetFlag(newCfg.Maintenance.Active)
+	})
+	b.Maintenance = sw
+
+	// The k8s probes and the operational routes of the public listener must keep working.
+	skipPaths := map[string]bool{}
+	if b.AdminEcho == nil {
+		if b.Config.Health.On {
+			livenessPath, readinessPath := healthPaths()
+			skipPaths[livenessPath] = true
+			skipPaths[readinessPath] = true
+		}
+		if b.Config.Prometheus.On {
+			skipPaths[metricsPath] = true
+		}
+		if cfg.API.EndPoint != "" {
+			skipPaths[cfg.API.EndPoint] = true
+		}
+	}
+
+	if cfg.API.EndPoint != "" {
+		b.adminOrPublic().Match([]string{http.MethodGet, http.MethodPut, http.MethodDelete}, cfg.API.EndPoint,
+			maintenance.APIHandler(sw, b.Config.Database.Tenant.Resolver.On), adminAuth(cfg.API.AuthBearerToken, nil))
+	}
+
+	b.Echo.Use(maintenance.Middleware(cfg, sw, func(c echo.Context) bool {
+		return skipPaths[c.Path()]
+	}))
+}
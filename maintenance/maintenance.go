@@ -0,0 +1,179 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package maintenance puts the service, or a single tenant, in maintenance. The maintenance is toggled by
+// the `maintenance.active` config flag, a redis key or the admin endpoint, and the requests get a `503`.
+package maintenance
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+)
+
+const (
+	DefaultRedisKey = "maintenance"
+	DefaultCacheTTL = time.Second
+
+	// maxCacheEntries bounds the cache as the tenant IDs come from the requests.
+	maxCacheEntries = 10000
+)
+
+type cached struct {
+	active  bool
+	expires time.Time
+}
+
+// Switch holds the maintenance state. With a redis connection, the state is shared by all the instances
+// through the `<key>` key for the whole service and the `<key>:tenant:<tenant ID>` keys for the tenants.
+// Otherwise, it is local to the instance.
+type Switch struct {
+	conn     *dbdrivers.RedisDBConn
+	key      string
+	cacheTTL time.Duration
+	// flag is the `maintenance.active` config flag.
+	flag atomic.Bool
+
+	mu    sync.Mutex
+	local map[string]bool
+	cache map[string]cached
+}
+
+// NewSwitch returns a switch which keeps the state in redis, or in memory if `conn` is nil. The redis state is
+// cached for `cacheTTL` to save a round trip per request.
+func NewSwitch(conn *dbdrivers.RedisDBConn, key string, cacheTTL time.Duration) *Switch {
+	if key == "" {
+		key = DefaultRedisKey
+	}
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+
+	return &Switch{
+		conn:     conn,
+		key:      key,
+		cacheTTL: cacheTTL,
+		local:    map[string]bool{},
+		cache:    map[string]cached{},
+	}
+}
+
+// SetFlag sets the `maintenance.active` config flag, which puts the whole service in maintenance.
+func (s *Switch) SetFlag(active bool) {
+	s.flag.Store(active)
+}
+
+// Enable puts the tenant in maintenance, or the whole service if `tenantID` is empty.
+func (s *Switch) Enable(ctx context.Context, tenantID string) error {
+	return s.set(ctx, tenantID, true)
+}
+
+// Disable ends the maintenance of the tenant, or of the whole service if `tenantID` is empty. It doesn't
+// override the config flag.
+func (s *Switch) Disable(ctx context.Context, tenantID string) error {
+	return s.set(ctx, tenantID, false)
+}
+
+func (s *Switch) set(ctx context.Context, tenantID string, active bool) error {
+	if s.conn != nil {
+		var err error
+		if active {
+			err = s.conn.Set(ctx, s.redisKey(tenantID), "1", 0)
+		} else {
+			err = s.conn.DelKey(ctx, s.redisKey(tenantID))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if active {
+			s.local[tenantID] = true
+		} else {
+			delete(s.local, tenantID)
+		}
+	}
+	s.cache = map[string]cached{}
+
+	return nil
+}
+
+// IsActive reports whether the tenant is in maintenance, either because of the whole service or of the tenant
+// itself. An empty `tenantID` checks the whole service only.
+func (s *Switch) IsActive(ctx context.Context, tenantID string) (bool, error) {
+	if s.flag.Load() {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	if s.conn == nil {
+		active := s.local[""] || (tenantID != "" && s.local[tenantID])
+		s.mu.Unlock()
+		return active, nil
+	}
+	c, ok := s.cache[tenantID]
+	s.mu.Unlock()
+
+	now := time.Now()
+	if ok && now.Before(c.expires) {
+		return c.active, nil
+	}
+
+	keys := []string{s.key}
+	if tenantID != "" {
+		keys = append(keys, s.redisKey(tenantID))
+	}
+	values, err := s.conn.MGet(ctx, keys...)
+	if err != nil {
+		return false, err
+	}
+
+	active := false
+	for _, v := range values {
+		if v != nil {
+			active = true
+		}
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCacheEntries {
+		s.cache = map[string]cached{}
+	}
+	s.cache[tenantID] = cached{active: active, expires: now.Add(s.cacheTTL)}
+	s.mu.Unlock()
+
+	return active, nil
+}
+
+func (s *Switch) redisKey(tenantID string) string {
+	if tenantID == "" {
+		return s.key
+	}
+	return s.key + ":tenant:" + tenantID
+}
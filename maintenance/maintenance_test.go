@@ -0,0 +1,183 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package maintenance
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConn(t *testing.T) (*miniredis.Miniredis, *dbdrivers.RedisDBConn) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return s, &dbdrivers.RedisDBConn{Primary: client}
+}
+
+func TestSwitch(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	for name, sw := range map[string]*Switch{
+		"redis":  NewSwitch(conn, "test_maintenance", time.Minute),
+		"memory": NewSwitch(nil, "", 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			isActive := func(tenantID string) bool {
+				active, err := sw.IsActive(ctx, tenantID)
+				require.NoError(t, err)
+				return active
+			}
+
+			assert.False(t, isActive(""))
+			assert.False(t, isActive("1"))
+
+			require.NoError(t, sw.Enable(ctx, "1"))
+			assert.False(t, isActive(""))
+			assert.True(t, isActive("1"))
+			assert.False(t, isActive("2"))
+
+			require.NoError(t, sw.Enable(ctx, ""))
+			assert.True(t, isActive(""))
+			assert.True(t, isActive("2"))
+
+			require.NoError(t, sw.Disable(ctx, ""))
+			require.NoError(t, sw.Disable(ctx, "1"))
+			assert.False(t, isActive("1"))
+
+			sw.SetFlag(true)
+			assert.True(t, isActive("2"))
+			sw.SetFlag(false)
+			assert.False(t, isActive("2"))
+		})
+	}
+}
+
+func TestSwitch_RedisKey(t *testing.T) {
+	s, conn := newTestConn(t)
+	sw := NewSwitch(conn, "test_maintenance", 10*time.Millisecond)
+
+	// Another instance starts the maintenance of a tenant.
+	require.NoError(t, s.Set("test_maintenance:tenant:1", "1"))
+
+	active, err := sw.IsActive(context.Background(), "1")
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	s.Del("test_maintenance:tenant:1")
+	time.Sleep(20 * time.Millisecond)
+
+	active, err = sw.IsActive(context.Background(), "1")
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestMiddleware(t *testing.T) {
+	sw := NewSwitch(nil, "", 0)
+	cfg := config.Maintenance{
+		AllowIPs:     []string{"10.0.0.0/8", "192.0.2.1"},
+		BypassSecret: "secret",
+		RetryAfter:   90 * time.Second,
+	}
+
+	lookup := func(value string) (uint64, bool) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		return id, err == nil
+	}
+
+	e := echo.New()
+	e.Use(tenant.Middleware(config.TenantResolver{}, lookup))
+	e.Use(Middleware(cfg, sw, func(c echo.Context) bool {
+		return c.Path() == "/healthz"
+	}))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/", ok)
+	e.GET("/healthz", ok)
+
+	do := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do("/", nil).Code)
+
+	require.NoError(t, sw.Enable(context.Background(), "42"))
+	assert.Equal(t, http.StatusOK, do("/", map[string]string{"X-Tenant-ID": "1"}).Code)
+
+	rec := do("/", map[string]string{"X-Tenant-ID": "42"})
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"errorCode":"100009","errorMsg":"service down for maintenance","errors":null}`, rec.Body.String())
+
+	require.NoError(t, sw.Enable(context.Background(), ""))
+	assert.Equal(t, http.StatusServiceUnavailable, do("/", nil).Code)
+	assert.Equal(t, http.StatusOK, do("/healthz", nil).Code)
+	assert.Equal(t, http.StatusOK, do("/", map[string]string{"X-Maintenance-Bypass": "secret"}).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, do("/", map[string]string{"X-Maintenance-Bypass": "wrong"}).Code)
+	assert.Equal(t, http.StatusOK, do("/", map[string]string{"X-Real-IP": "10.1.2.3"}).Code)
+	assert.Equal(t, http.StatusOK, do("/", map[string]string{"X-Real-IP": "192.0.2.1"}).Code)
+	assert.Equal(t, http.StatusServiceUnavailable, do("/", map[string]string{"X-Real-IP": "192.0.2.2"}).Code)
+}
+
+func TestAPIHandler(t *testing.T) {
+	sw := NewSwitch(nil, "", 0)
+
+	e := echo.New()
+	e.Match([]string{http.MethodGet, http.MethodPut, http.MethodDelete}, "/maintenance", APIHandler(sw, true))
+	e.PUT("/untenanted", APIHandler(sw, false))
+
+	do := func(method, target string) string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	assert.JSONEq(t, `{"tenant":"","active":false}`, do(http.MethodGet, "/maintenance"))
+	assert.JSONEq(t, `{"tenant":"7","active":true}`, do(http.MethodPut, "/maintenance?tenant=7"))
+	assert.JSONEq(t, `{"tenant":"","active":false}`, do(http.MethodGet, "/maintenance"))
+	assert.JSONEq(t, `{"tenant":"7","active":false}`, do(http.MethodDelete, "/maintenance?tenant=7"))
+
+	// The maintenance of a tenant would never apply without the tenant middleware.
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/untenanted?tenant=7", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestMiddleware_unresolvedTenant(t *testing.T) {
+	sw := NewSwitch(nil, "", 0)
+	require.NoError(t, sw.Enable(context.Background(), "42"))
+
+	e := echo.New()
+	e.Use(Middleware(config.Maintenance{}, sw, nil))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	// Without the tenant middleware, the header of the client is ignored.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-ID", "42")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
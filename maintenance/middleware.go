@@ -0,0 +1,179 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package maintenance
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+const (
+	DefaultBypassHeader = "X-Maintenance-Bypass"
+	DefaultHTMLFile     = "errors/html/503"
+)
+
+// Middleware returns a middleware which responds `503` while the service, or the tenant of the request, is in
+// maintenance. The tenant is the one resolved by the tenant middleware, never a header sent by the client. The
+// clients in `allowIPs` or with the bypass secret are let through. The requests for which `skipper` returns
+// true, e.g. the health checks, are never blocked.
+func Middleware(cfg config.Maintenance, sw *Switch, skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+
+	bypassHeader := cfg.BypassHeader
+	if bypassHeader == "" {
+		bypassHeader = DefaultBypassHeader
+	}
+	htmlFile := cfg.HTMLFile
+	if htmlFile == "" {
+		htmlFile = DefaultHTMLFile
+	}
+	allowed := parseAllowIPs(cfg.AllowIPs)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			if cfg.BypassSecret != "" {
+				secret := c.Request().Header.Get(bypassHeader)
+				if subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.BypassSecret)) == 1 {
+					return next(c)
+				}
+			}
+
+			if len(allowed) > 0 {
+				if ip := net.ParseIP(c.RealIP()); ip != nil {
+					for _, n := range allowed {
+						if n.Contains(ip) {
+							return next(c)
+						}
+					}
+				}
+			}
+
+			var tenantID string
+			if id, ok := tenant.FromContext(c.Request().Context()); ok {
+				tenantID = strconv.FormatUint(id, 10)
+			}
+
+			active, err := sw.IsActive(c.Request().Context(), tenantID)
+			if err != nil {
+				// IMPORTANT: An unavailable redis must not take down the whole service.
+				c.Logger().Errorf("maintenance: %v", err)
+				return next(c)
+			}
+			if !active {
+				return next(c)
+			}
+
+			if cfg.RetryAfter > 0 {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int((cfg.RetryAfter+time.Second-1)/time.Second)))
+			}
+
+			if c.Echo().Renderer == nil || strings.Contains(c.Request().Header.Get("Content-Type"), "application/json") {
+				return c.JSON(http.StatusServiceUnavailable, berror.ErrorResp{
+					ErrorCode: berror.SERVICE_DOWN_FOR_MAINTENANCE,
+					ErrorMsg:  "service down for maintenance",
+				})
+			}
+
+			return c.Render(http.StatusServiceUnavailable, htmlFile, echo.Map{"stacktrace": nil})
+		}
+	}
+}
+
+// APIHandler returns a handler to manage the maintenance: `GET` returns the state, `PUT` starts and `DELETE`
+// ends the maintenance. The `tenant` query parameter scopes it to a single tenant. It gets a `400` unless
+// `tenants` is true, i.e. the tenant middleware resolves the tenant of the requests, as the maintenance of a
+// tenant would never apply otherwise.
+func APIHandler(sw *Switch, tenants bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		tenantID := c.QueryParam("tenant")
+		if tenantID != "" && !tenants {
+			return c.JSON(http.StatusBadRequest, berror.ErrorResp{
+				ErrorCode: berror.API_DATA_VALIDATION_FAILED,
+				ErrorMsg:  "tenant requires database.tenant.resolver.on",
+			})
+		}
+
+		var err error
+		switch c.Request().Method {
+		case http.MethodPut, http.MethodPost:
+			err = sw.Enable(ctx, tenantID)
+		case http.MethodDelete:
+			err = sw.Disable(ctx, tenantID)
+		case http.MethodGet:
+		default:
+			return echo.ErrMethodNotAllowed
+		}
+		if err != nil {
+			return err
+		}
+
+		active, err := sw.IsActive(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"tenant": tenantID,
+			"active": active,
+		})
+	}
+}
+
+// parseAllowIPs accepts IP addresses and CIDR ranges, the invalid ones are reported by the config validation.
+func parseAllowIPs(ips []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(ips))
+	for _, s := range ips {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			nets = append(nets, n)
+		}
+	}
+
+	return nets
+}
@@ -0,0 +1,424 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queue provides a redis backed job queue. Jobs are enqueued from handlers or services
+// and processed by a `Worker` on a named goroutine pool with retries, delays and a dead-letter list.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+)
+
+// DefaultQueue is the queue name used when no queue is specified.
+const DefaultQueue = "default"
+
+var (
+	ErrNilConnection = errors.New("queue: redis connection is nil")
+	ErrEmptyJobType  = errors.New("queue: job type is empty")
+)
+
+// Job represents a unit of work stored in redis.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Queue      string          `json:"queue"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempt    int             `json:"attempt"`
+	MaxRetry   int             `json:"maxRetry"`
+	EnqueuedAt time.Time       `json:"enqueuedAt"`
+	LastError  string          `json:"lastError,omitempty"`
+
+	raw string // raw is the exact redis member of the job, it is needed to acknowledge the job.
+}
+
+// Bind decodes the job payload into `v`.
+func (j *Job) Bind(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Client enqueues jobs into a redis database. Use `bean.DBDeps.MasterRedisDB` or a tenant's
+// `RedisDBConn` as the connection.
+type Client struct {
+	conn *dbdrivers.RedisDBConn
+	opts *options
+}
+
+// NewClient creates a new queue client. Default options are taken from the `queue` section in env.json.
+func NewClient(conn *dbdrivers.RedisDBConn, opts ...Option) *Client {
+	return &Client{
+		conn: conn,
+		opts: newOptions(opts...),
+	}
+}
+
+type enqueueOptions struct {
+	queue     string
+	processAt time.Time
+	maxRetry  *int
+	id        string
+}
+
+// EnqueueOption configures a single job.
+type EnqueueOption func(*enqueueOptions)
+
+// WithQueue sets the queue name of the job.
+func WithQueue(name string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		if name != "" {
+			o.queue = name
+		}
+	}
+}
+
+// WithDelay delays the job processing by the given duration.
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		if d > 0 {
+			o.processAt = time.Now().Add(d)
+		}
+	}
+}
+
+// WithProcessAt schedules the job to be processed at the given time.
+func WithProcessAt(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.processAt = t
+	}
+}
+
+// WithJobMaxRetry overrides the maximum retry count of the job.
+func WithJobMaxRetry(n int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.maxRetry = &n
+	}
+}
+
+// WithJobID sets a custom job ID instead of a generated UUID.
+func WithJobID(id string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.id = id
+	}
+}
+
+// Enqueue marshals the payload to JSON and pushes a new job of `jobType` into the queue.
+func (c *Client) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...EnqueueOption) (*Job, error) {
+	if c.conn == nil || c.conn.Primary == nil {
+		return nil, ErrNilConnection
+	}
+
+	if jobType == "" {
+		return nil, ErrEmptyJobType
+	}
+
+	eo := &enqueueOptions{queue: DefaultQueue}
+	for _, opt := range opts {
+		opt(eo)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	job := &Job{
+		ID:         eo.id,
+		Type:       jobType,
+		Queue:      eo.queue,
+		Payload:    data,
+		MaxRetry:   c.opts.maxRetry,
+		EnqueuedAt: time.Now(),
+	}
+	if job.ID == "" {
+		job.ID = uuid.NewString()
+	}
+	if eo.maxRetry != nil {
+		job.MaxRetry = *eo.maxRetry
+	}
+
+	if err := job.encode(); err != nil {
+		return nil, err
+	}
+
+	if !eo.processAt.IsZero() && eo.processAt.After(time.Now()) {
+		err = c.conn.Primary.ZAdd(ctx, c.key(job.Queue, delayedSuffix), &redis.Z{
+			Score:  float64(eo.processAt.UnixMilli()),
+			Member: job.raw,
+		}).Err()
+	} else {
+		err = c.conn.Primary.LPush(ctx, c.key(job.Queue, readySuffix), job.raw).Err()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return job, nil
+}
+
+// Size returns the number of ready, delayed, in-flight and dead jobs of the queue.
+func (c *Client) Size(ctx context.Context, queue string) (ready, delayed, processing, dead int64, err error) {
+	if c.conn == nil || c.conn.Primary == nil {
+		return 0, 0, 0, 0, ErrNilConnection
+	}
+
+	pipe := c.conn.Primary.Pipeline()
+	readyCmd := pipe.LLen(ctx, c.key(queue, readySuffix))
+	delayedCmd := pipe.ZCard(ctx, c.key(queue, delayedSuffix))
+	processingCmd := pipe.ZCard(ctx, c.key(queue, processingSuffix))
+	deadCmd := pipe.LLen(ctx, c.key(queue, deadSuffix))
+	if _, err = pipe.Exec(ctx); err != nil {
+		return 0, 0, 0, 0, errors.WithStack(err)
+	}
+
+	return readyCmd.Val(), delayedCmd.Val(), processingCmd.Val(), deadCmd.Val(), nil
+}
+
+// DeadJobs returns the jobs in the dead-letter list of the queue between `start` and `stop` (inclusive).
+func (c *Client) DeadJobs(ctx context.Context, queue string, start, stop int64) ([]*Job, error) {
+	if c.conn == nil || c.conn.Primary == nil {
+		return nil, ErrNilConnection
+	}
+
+	raws, err := c.conn.Primary.LRange(ctx, c.key(queue, deadSuffix), start, stop).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	jobs := make([]*Job, 0, len(raws))
+	for _, raw := range raws {
+		job, err := decodeJob(raw)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// RequeueDead moves every job from the dead-letter list back to the ready list with a fresh retry budget.
+// It returns the number of requeued jobs.
+func (c *Client) RequeueDead(ctx context.Context, queue string) (int, error) {
+	if c.conn == nil || c.conn.Primary == nil {
+		return 0, ErrNilConnection
+	}
+
+	var n int
+	for {
+		raw, err := c.conn.Primary.RPop(ctx, c.key(queue, deadSuffix)).Result()
+		if errors.Is(err, redis.Nil) {
+			return n, nil
+		} else if err != nil {
+			return n, errors.WithStack(err)
+		}
+
+		job, err := decodeJob(raw)
+		if err != nil {
+			return n, err
+		}
+		job.Attempt = 0
+		job.LastError = ""
+		if err := job.encode(); err != nil {
+			return n, err
+		}
+
+		if err := c.conn.Primary.LPush(ctx, c.key(queue, readySuffix), job.raw).Err(); err != nil {
+			return n, errors.WithStack(err)
+		}
+		n++
+	}
+}
+
+const (
+	readySuffix      = "ready"
+	delayedSuffix    = "delayed"
+	processingSuffix = "processing"
+	deadSuffix       = "dead"
+)
+
+// key returns the redis key of a queue list. The queue part is wrapped with a hash tag so that
+// all keys of the same queue live in the same slot in redis cluster mode and can be used in a lua script.
+func (c *Client) key(queue, suffix string) string {
+	return c.opts.prefix + ":{" + queue + "}:" + suffix
+}
+
+func (j *Job) encode() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	j.raw = string(data)
+	return nil
+}
+
+func decodeJob(raw string) (*Job, error) {
+	job := &Job{}
+	if err := json.Unmarshal([]byte(raw), job); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	job.raw = raw
+	return job, nil
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+type options struct {
+	prefix            string
+	queues            []string
+	pool              string
+	concurrency       int
+	maxRetry          int
+	pollInterval      time.Duration
+	visibilityTimeout time.Duration
+	retryMinBackoff   time.Duration
+	retryMaxBackoff   time.Duration
+	shutdownTimeout   time.Duration
+}
+
+// Option configures a `Client` or a `Worker`.
+type Option func(*options)
+
+// WithPrefix sets the redis key prefix of all queues.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		if prefix != "" {
+			o.prefix = prefix
+		}
+	}
+}
+
+// WithQueues sets the queues a worker consumes. Queues are polled in the given order.
+func WithQueues(queues ...string) Option {
+	return func(o *options) {
+		if len(queues) > 0 {
+			o.queues = queues
+		}
+	}
+}
+
+// WithPool sets the name of the goroutine pool (`asyncPool` in env.json) to run the jobs on.
+func WithPool(name string) Option {
+	return func(o *options) {
+		o.pool = name
+	}
+}
+
+// WithConcurrency sets the maximum number of jobs a worker processes at the same time.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithMaxRetry sets the default maximum retry count of a job before it goes to the dead-letter list.
+func WithMaxRetry(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.maxRetry = n
+		}
+	}
+}
+
+// WithPollInterval sets how often a worker polls an empty queue and promotes delayed jobs.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.pollInterval = d
+		}
+	}
+}
+
+// WithVisibilityTimeout sets how long a fetched job stays invisible to other workers. If the worker
+// doesn't acknowledge the job within this period (pod restart, crash), the job is put back to the queue.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.visibilityTimeout = d
+		}
+	}
+}
+
+// WithRetryBackoff sets the jitter backoff range between retries.
+func WithRetryBackoff(min, max time.Duration) Option {
+	return func(o *options) {
+		if min > 0 && max >= min {
+			o.retryMinBackoff, o.retryMaxBackoff = min, max
+		}
+	}
+}
+
+// WithShutdownTimeout sets how long a worker waits for in-flight jobs during graceful drain.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.shutdownTimeout = d
+		}
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		prefix:            "bean_queue",
+		queues:            []string{DefaultQueue},
+		concurrency:       10,
+		maxRetry:          3,
+		pollInterval:      time.Second,
+		visibilityTimeout: 5 * time.Minute,
+		retryMinBackoff:   time.Second,
+		retryMaxBackoff:   5 * time.Minute,
+		shutdownTimeout:   30 * time.Second,
+	}
+
+	// IMPORTANT: Apply the `queue` settings from env.json first so that the options can override them.
+	if config.Bean != nil {
+		cfg := config.Bean.Queue
+		WithPrefix(cfg.Prefix)(o)
+		WithQueues(cfg.Queues...)(o)
+		WithPool(cfg.Pool)(o)
+		WithConcurrency(cfg.Concurrency)(o)
+		if cfg.MaxRetry != nil {
+			WithMaxRetry(*cfg.MaxRetry)(o)
+		}
+		WithPollInterval(cfg.PollInterval)(o)
+		WithVisibilityTimeout(cfg.VisibilityTimeout)(o)
+		WithRetryBackoff(cfg.RetryMinBackoff, cfg.RetryMaxBackoff)(o)
+		WithShutdownTimeout(cfg.ShutdownTimeout)(o)
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
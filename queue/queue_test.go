@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConn(t *testing.T) (*miniredis.Miniredis, *dbdrivers.RedisDBConn) {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return s, &dbdrivers.RedisDBConn{Primary: client}
+}
+
+func testOptions() []Option {
+	return []Option{
+		WithPrefix("test_queue"),
+		WithPollInterval(10 * time.Millisecond),
+		WithRetryBackoff(time.Millisecond, 5*time.Millisecond),
+		WithShutdownTimeout(time.Second),
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	type greeting struct {
+		Name string `json:"name"`
+	}
+
+	w := NewWorker(conn, testOptions()...)
+	got := make(chan string, 1)
+	Register(w, "greet", func(ctx context.Context, p greeting) error {
+		got <- p.Name
+		return nil
+	})
+
+	_, err := w.Client().Enqueue(context.Background(), "greet", greeting{Name: "bean"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(ctx) }()
+
+	select {
+	case name := <-got:
+		assert.Equal(t, "bean", name)
+	case <-time.After(3 * time.Second):
+		t.Fatal("job was not processed")
+	}
+
+	cancel()
+	require.NoError(t, <-errCh)
+
+	ready, delayed, processing, dead, err := w.Client().Size(context.Background(), DefaultQueue)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 0, 0, 0}, []int64{ready, delayed, processing, dead})
+}
+
+func TestWorker_RetryAndDeadLetter(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	w := NewWorker(conn, append(testOptions(), WithMaxRetry(2))...)
+	var calls int32
+	w.Handle("fail", func(ctx context.Context, job *Job) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("boom")
+	})
+
+	_, err := w.Client().Enqueue(context.Background(), "fail", nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		_, _, _, dead, err := w.Client().Size(context.Background(), DefaultQueue)
+		return err == nil && dead == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-errCh)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	jobs, err := w.Client().DeadJobs(context.Background(), DefaultQueue, 0, -1)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 3, jobs[0].Attempt)
+	assert.Equal(t, "boom", jobs[0].LastError)
+
+	n, err := w.Client().RequeueDead(context.Background(), DefaultQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestWorker_SkipRetryAndUnknownType(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	w := NewWorker(conn, testOptions()...)
+	w.Handle("skip", func(ctx context.Context, job *Job) error {
+		return SkipRetry(errors.New("invalid"))
+	})
+
+	for _, typ := range []string{"skip", "unknown"} {
+		_, err := w.Client().Enqueue(context.Background(), typ, nil)
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		_, _, _, dead, err := w.Client().Size(context.Background(), DefaultQueue)
+		return err == nil && dead == 2
+	}, 3*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestClient_EnqueueWithDelay(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	c := NewClient(conn, testOptions()...)
+	_, err := c.Enqueue(context.Background(), "later", nil, WithDelay(time.Hour), WithQueue("mail"))
+	require.NoError(t, err)
+
+	ready, delayed, _, _, err := c.Size(context.Background(), "mail")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), ready)
+	assert.Equal(t, int64(1), delayed)
+
+	_, err = c.Enqueue(context.Background(), "", nil)
+	assert.ErrorIs(t, err, ErrEmptyJobType)
+}
+
+func TestClient_NilConnection(t *testing.T) {
+	c := NewClient(nil)
+	ctx := context.Background()
+
+	_, err := c.Enqueue(ctx, "job", nil)
+	assert.ErrorIs(t, err, ErrNilConnection)
+	_, _, _, _, err = c.Size(ctx, "mail")
+	assert.ErrorIs(t, err, ErrNilConnection)
+	_, err = c.DeadJobs(ctx, "mail", 0, -1)
+	assert.ErrorIs(t, err, ErrNilConnection)
+	_, err = NewClient(&dbdrivers.RedisDBConn{}).RequeueDead(ctx, "mail")
+	assert.ErrorIs(t, err, ErrNilConnection)
+}
+
+func TestWorker_DrainTimeout(t *testing.T) {
+	_, conn := newTestConn(t)
+
+	w := NewWorker(conn, append(testOptions(), WithShutdownTimeout(50*time.Millisecond))...)
+	started := make(chan struct{})
+	w.Handle("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	_, err := w.Client().Enqueue(context.Background(), "slow", nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(ctx) }()
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-errCh, ErrDrainTimeout)
+}
@@ -0,0 +1,389 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/panjf2000/ants/v2"
+	"github.com/pkg/errors"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/internal/gopool"
+	"github.com/retail-ai-inc/bean/v2/log"
+	"github.com/retail-ai-inc/bean/v2/trace"
+)
+
+var (
+	// ErrSkipRetry tells the worker to move the job to the dead-letter list without retrying it.
+	ErrSkipRetry = errors.New("queue: skip retry")
+	// ErrNoHandler is recorded on a job whose type has no registered handler.
+	ErrNoHandler = errors.New("queue: no handler registered for the job type")
+	// ErrDrainTimeout is returned by `Run` if in-flight jobs do not finish within the shutdown timeout.
+	ErrDrainTimeout = errors.New("queue: in-flight jobs did not finish before the shutdown timeout")
+)
+
+// SkipRetry wraps `err` so that the job is moved to the dead-letter list immediately.
+func SkipRetry(err error) error {
+	return fmt.Errorf("%w: %w", ErrSkipRetry, err)
+}
+
+// HandlerFunc processes a job. Returning an error schedules a retry with backoff until
+// the maximum retry count is reached, then the job goes to the dead-letter list.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// fetchScript pops a job from the ready list and keeps it in the processing set until the visibility deadline.
+var fetchScript = redis.NewScript(`
+local job = redis.call('RPOP', KEYS[1])
+if job then
+	redis.call('ZADD', KEYS[2], ARGV[1], job)
+end
+return job
+`)
+
+// promoteScript moves due jobs from a sorted set (delayed or expired in-flight jobs) to the ready list.
+var promoteScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, job in ipairs(jobs) do
+	redis.call('ZREM', KEYS[1], job)
+	redis.call('LPUSH', KEYS[2], job)
+end
+return #jobs
+`)
+
+// moveScript removes a job from the processing set and, only if the worker still owns it,
+// stores the updated job into the delayed set (retry) or the dead-letter list.
+var moveScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+else
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+end
+return 1
+`)
+
+// Worker consumes jobs from one or more queues.
+type Worker struct {
+	client     *Client
+	handlersMu sync.RWMutex
+	handlers   map[string]HandlerFunc
+}
+
+// NewWorker creates a new worker. Default options are taken from the `queue` section in env.json.
+func NewWorker(conn *dbdrivers.RedisDBConn, opts ...Option) *Worker {
+	return &Worker{
+		client:   NewClient(conn, opts...),
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Client returns a client sharing the connection and options of the worker.
+func (w *Worker) Client() *Client {
+	return w.client
+}
+
+// Handle registers the handler for a job type.
+func (w *Worker) Handle(jobType string, fn HandlerFunc) {
+	w.handlersMu.Lock()
+	defer w.handlersMu.Unlock()
+
+	w.handlers[jobType] = fn
+}
+
+// Register registers a typed handler for a job type. The job payload is decoded into `T`;
+// a payload which cannot be decoded is moved to the dead-letter list without retry.
+func Register[T any](w *Worker, jobType string, fn func(ctx context.Context, payload T) error) {
+	w.Handle(jobType, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := job.Bind(&payload); err != nil {
+			return SkipRetry(err)
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Run starts consuming the queues and blocks until `ctx` is done. After that it stops fetching
+// new jobs and waits for in-flight jobs up to the shutdown timeout. Jobs which are still running
+// after the timeout are cancelled and will be picked up again once their visibility timeout expires.
+func (w *Worker) Run(ctx context.Context) error {
+	c := w.client
+	if c.conn == nil || c.conn.Primary == nil {
+		return ErrNilConnection
+	}
+
+	var pool *ants.Pool
+	if c.opts.pool != "" {
+		p, err := gopool.GetPool(c.opts.pool)
+		if err != nil {
+			logWarnf("queue worker will execute jobs without goroutine pool, the pool name is %q", c.opts.pool)
+		} else {
+			pool = p
+		}
+	}
+
+	// IMPORTANT: Jobs must not be cancelled as soon as `ctx` is done, otherwise the graceful drain is useless.
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, c.opts.concurrency)
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		w.schedule(ctx)
+	}()
+
+	idle := time.NewTimer(c.opts.pollInterval)
+	defer idle.Stop()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case slots <- struct{}{}:
+		}
+
+		job, err := w.fetch(ctx)
+		if err != nil || job == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				logError(err)
+			}
+
+			// IMPORTANT: Drain the tick which fired while the jobs were processed, otherwise the wait ends at once.
+			// Before go 1.23, `Reset` does not drop a stale tick.
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(c.opts.pollInterval)
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-idle.C:
+			}
+			continue
+		}
+
+		wg.Add(1)
+		task := func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			w.process(jobCtx, job)
+		}
+
+		if pool == nil || pool.Submit(task) != nil {
+			go task()
+		}
+	}
+
+	<-schedulerDone
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(c.opts.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		cancelJobs()
+		return ErrDrainTimeout
+	}
+}
+
+// schedule periodically moves due delayed jobs and expired in-flight jobs back to the ready list.
+func (w *Worker) schedule(ctx context.Context) {
+	ticker := time.NewTicker(w.client.opts.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.promote(ctx); err != nil && ctx.Err() == nil {
+			logError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) promote(ctx context.Context) error {
+	c := w.client
+	now := millis(time.Now())
+
+	for _, queue := range c.opts.queues {
+		for _, suffix := range []string{delayedSuffix, processingSuffix} {
+			_, err := c.conn.Run(ctx, promoteScript, []string{c.key(queue, suffix), c.key(queue, readySuffix)}, now, 1000)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetch returns the next job of the first non-empty queue or nil if every queue is empty.
+func (w *Worker) fetch(ctx context.Context) (*Job, error) {
+	c := w.client
+	deadline := millis(time.Now().Add(c.opts.visibilityTimeout))
+
+	for _, queue := range c.opts.queues {
+		v, err := c.conn.Run(ctx, fetchScript, []string{c.key(queue, readySuffix), c.key(queue, processingSuffix)}, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		job, err := decodeJob(raw)
+		if err != nil {
+			// IMPORTANT: A broken job can never be processed, drop it from the processing set.
+			c.conn.Primary.ZRem(ctx, c.key(queue, processingSuffix), raw)
+			return nil, err
+		}
+
+		return job, nil
+	}
+
+	return nil, nil
+}
+
+func (w *Worker) process(ctx context.Context, job *Job) {
+	c := w.client
+
+	w.handlersMu.RLock()
+	handler, ok := w.handlers[job.Type]
+	w.handlersMu.RUnlock()
+
+	var err error
+	if !ok {
+		err = SkipRetry(fmt.Errorf("%w: %q", ErrNoHandler, job.Type))
+	} else {
+		jobCtx, cancel := context.WithTimeout(ctx, c.opts.visibilityTimeout)
+		defer cancel()
+
+		if sentryOn() {
+			jobCtx = sentry.SetHubOnContext(jobCtx, sentry.CurrentHub().Clone())
+		}
+
+		var finish func()
+		jobCtx, finish = trace.StartSpan(jobCtx, "queue", sentry.WithDescription(job.Queue+" "+job.Type))
+		err = run(jobCtx, handler, job)
+		finish()
+
+		if err != nil {
+			logError(err)
+			if sentryOn() {
+				trace.SentryCaptureException(jobCtx, err)
+			}
+		}
+	}
+
+	// IMPORTANT: Acknowledge with a fresh context, the job context might be cancelled by the drain timeout.
+	ackCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if err := c.conn.Primary.ZRem(ackCtx, c.key(job.Queue, processingSuffix), job.raw).Err(); err != nil {
+			logError(errors.WithStack(err))
+		}
+		return
+	}
+
+	if err := w.fail(ackCtx, job, err); err != nil {
+		logError(err)
+	}
+}
+
+// fail schedules a retry of the job or moves it to the dead-letter list.
+func (w *Worker) fail(ctx context.Context, job *Job, jobErr error) error {
+	c := w.client
+	raw := job.raw
+
+	job.Attempt++
+	job.LastError = jobErr.Error()
+	if err := job.encode(); err != nil {
+		return err
+	}
+
+	dest, score := c.key(job.Queue, deadSuffix), ""
+	if !errors.Is(jobErr, ErrSkipRetry) && job.Attempt <= job.MaxRetry {
+		backoff := helpers.JitterBackoff(c.opts.retryMinBackoff, c.opts.retryMaxBackoff, job.Attempt-1)
+		dest, score = c.key(job.Queue, delayedSuffix), millis(time.Now().Add(backoff))
+	}
+
+	_, err := c.conn.Run(ctx, moveScript, []string{c.key(job.Queue, processingSuffix), dest}, raw, job.raw, score)
+	return err
+}
+
+// run executes the handler and converts a panic into an error.
+func run(ctx context.Context, handler HandlerFunc, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.WithStack(fmt.Errorf("queue: job %s of type %q panicked: %v", job.ID, job.Type, r))
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+func sentryOn() bool {
+	return config.Bean != nil && config.Bean.Sentry.On
+}
+
+func logError(err error) {
+	if l := log.Logger(); l != nil {
+		l.Error(err)
+	}
+}
+
+func logWarnf(format string, args ...interface{}) {
+	if l := log.Logger(); l != nil {
+		l.Warnf(format, args...)
+	}
+}
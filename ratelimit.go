@@ -0,0 +1,79 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/ratelimit"
+)
+
+const rateLimitSweepInterval = time.Minute
+
+// useRateLimit adds the rate limiting middleware. The counters are kept in the master redis unless
+// `rateLimit.store` is `memory` or no redis is configured.
+func (b *Bean) useRateLimit() error {
+	cfg := b.Config.RateLimit
+
+	var store ratelimit.Store
+	if cfg.Store != ratelimit.StoreMemory && b.DBConn != nil && b.DBConn.MasterRedisDB != nil {
+		s, err := ratelimit.NewRedisStore(b.DBConn.MasterRedisDB)
+		if err != nil {
+			return err
+		}
+		store = s
+	} else if cfg.Store == ratelimit.StoreRedis {
+		return errors.New("rate limit: redis store requires the master redis, call `InitDB` first")
+	}
+
+	if store == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		store = ratelimit.NewMemoryStore(ctx, rateLimitSweepInterval)
+		b.OnShutdown("ratelimit", func(context.Context) error {
+			cancel()
+			return nil
+		})
+	}
+
+	// The k8s probes and the metrics scraper of the public listener must never get a `429`.
+	skipPaths := map[string]bool{}
+	if b.AdminEcho == nil {
+		if b.Config.Health.On {
+			livenessPath, readinessPath := healthPaths()
+			skipPaths[livenessPath] = true
+			skipPaths[readinessPath] = true
+		}
+		if b.Config.Prometheus.On {
+			skipPaths[metricsPath] = true
+		}
+	}
+
+	b.Echo.Use(ratelimit.Middleware(cfg, store, func(c echo.Context) bool {
+		return skipPaths[c.Path()]
+	}))
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	// hits are the request times of a sliding window.
+	hits    []time.Time
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewMemoryStore returns a store which keeps the counters in the process memory. The counters are not shared
+// between the instances, so use it for single-instance setups only. The expired keys are swept every
+// `sweepInterval` until `ctx` is done.
+func NewMemoryStore(ctx context.Context, sweepInterval time.Duration) Store {
+	s := &memoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+
+	if sweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(sweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					s.sweep()
+				}
+			}
+		}()
+	}
+
+	return s
+}
+
+func (s *memoryStore) Allow(_ context.Context, key string, rule Rule) (Result, error) {
+	if err := rule.validate(); err != nil {
+		return Result{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok || now.After(b.expires) {
+		b = &bucket{tokens: float64(rule.capacity()), ts: now}
+		s.buckets[key] = b
+	}
+
+	if rule.Algorithm == SlidingWindow {
+		return s.slidingWindow(b, now, rule), nil
+	}
+
+	return s.tokenBucket(b, now, rule), nil
+}
+
+func (s *memoryStore) tokenBucket(b *bucket, now time.Time, rule Rule) Result {
+	capacity := float64(rule.capacity())
+	// Tokens per nanosecond.
+	rate := float64(rule.Limit) / float64(rule.Period)
+
+	if now.After(b.ts) {
+		b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.ts))*rate)
+	}
+	b.ts = now
+
+	result := Result{Limit: rule.capacity()}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration(math.Ceil((capacity - b.tokens) / rate))
+	b.expires = now.Add(result.Reset + time.Second)
+
+	return result
+}
+
+func (s *memoryStore) slidingWindow(b *bucket, now time.Time, rule Rule) Result {
+	start := now.Add(-rule.Period)
+	i := 0
+	for i < len(b.hits) && !b.hits[i].After(start) {
+		i++
+	}
+	b.hits = b.hits[i:]
+
+	result := Result{Limit: rule.Limit}
+	if len(b.hits) < rule.Limit {
+		b.hits = append(b.hits, now)
+		result.Allowed = true
+	}
+
+	result.Remaining = rule.Limit - len(b.hits)
+	result.Reset = b.hits[0].Add(rule.Period).Sub(now)
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	b.expires = now.Add(rule.Period)
+
+	return result
+}
+
+func (s *memoryStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, b := range s.buckets {
+		if now.After(b.expires) {
+			delete(s.buckets, key)
+		}
+	}
+}
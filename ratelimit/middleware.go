@@ -0,0 +1,189 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+)
+
+const (
+	defaultPrefix       = "ratelimit"
+	defaultAPIKeyHeader = "X-API-Key"
+)
+
+// The response headers, see https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers.
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderRetryAfter = "Retry-After"
+)
+
+type route struct {
+	method string
+	path   string
+	keyBy  string
+	rule   Rule
+}
+
+// Middleware returns a middleware which limits the requests with the rules of `cfg`. A tenant quota takes
+// precedence over a route rule, which takes precedence over the default rule. A rule with `limit` 0 disables
+// the rate limiting. The tenant quotas and `keyBy` tenant only use the tenant resolved by the tenant middleware,
+// never a header sent by the client. The requests for which `skipper` returns true, e.g. the health checks, are
+// never limited.
+func Middleware(cfg config.RateLimit, store Store, skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	apiKeyHeader := cfg.APIKeyHeader
+	if apiKeyHeader == "" {
+		apiKeyHeader = defaultAPIKeyHeader
+	}
+	keyBy := cfg.KeyBy
+	if keyBy == "" {
+		keyBy = KeyByIP
+	}
+
+	defaultRule := RuleFromConfig(cfg.Default)
+
+	routes := make([]route, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		routes = append(routes, route{
+			method: strings.ToUpper(r.Method),
+			path:   r.Path,
+			keyBy:  r.KeyBy,
+			rule:   RuleFromConfig(r.RateLimitRule),
+		})
+	}
+
+	tenants := make(map[string]Rule, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		tenants[t.TenantID] = RuleFromConfig(t.RateLimitRule)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			scope, by, rule := "default", keyBy, defaultRule
+
+			for _, r := range routes {
+				if r.path == c.Path() && (r.method == "" || r.method == c.Request().Method) {
+					scope, rule = r.method+r.path, r.rule
+					if r.keyBy != "" {
+						by = r.keyBy
+					}
+					break
+				}
+			}
+
+			if len(tenants) > 0 {
+				if id, ok := tenant.FromContext(c.Request().Context()); ok {
+					if r, ok := tenants[strconv.FormatUint(id, 10)]; ok {
+						scope, by, rule = "tenant", KeyByTenant, r
+					}
+				}
+			}
+
+			if rule.Limit == 0 {
+				return next(c)
+			}
+
+			by, value := keyOf(c, by, apiKeyHeader)
+			key := prefix + ":" + scope + ":" + by + ":" + value
+
+			result, err := store.Allow(c.Request().Context(), key, rule)
+			if err != nil {
+				if cfg.FailOpen {
+					c.Logger().Errorf("ratelimit: %v", err)
+					return next(c)
+				}
+				return err
+			}
+
+			h := c.Response().Header()
+			h.Set(HeaderLimit, strconv.Itoa(result.Limit))
+			h.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			h.Set(HeaderReset, strconv.Itoa(seconds(result.Reset)))
+
+			if !result.Allowed {
+				h.Set(HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+				return c.JSON(http.StatusTooManyRequests, berror.ErrorResp{
+					ErrorCode: berror.TOO_MANY_REQUESTS,
+					ErrorMsg:  "too many requests",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// keyOf returns the source and the value of the key. It falls back to the client IP if the request has no
+// value for the source.
+func keyOf(c echo.Context, by, apiKeyHeader string) (string, string) {
+	switch by {
+	case KeyByJWTSubject:
+		claims := &jwt.RegisteredClaims{}
+		if err := helpers.DecodeJWT(c, claims, config.GetString("jwt.secret")); err == nil && claims.Subject != "" {
+			return by, claims.Subject
+		}
+	case KeyByAPIKey:
+		if key := c.Request().Header.Get(apiKeyHeader); key != "" {
+			// Do not store the API keys in plain text.
+			sum := sha256.Sum256([]byte(key))
+			return by, hex.EncodeToString(sum[:])
+		}
+	case KeyByTenant:
+		if id, ok := tenant.FromContext(c.Request().Context()); ok {
+			return by, strconv.FormatUint(id, 10)
+		}
+	}
+
+	return KeyByIP, c.RealIP()
+}
+
+// seconds rounds up `d` to seconds.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,116 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ratelimit limits the request rate with a token bucket or a sliding window. The counters are kept
+// in redis, updated atomically by Lua scripts, so that the limits are shared by all the instances. An
+// in-memory store is available for single-instance setups.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/retail-ai-inc/bean/v2/config"
+)
+
+// The algorithms of a rule.
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+// The sources of the rate limit key.
+const (
+	KeyByIP         = "ip"
+	KeyByJWTSubject = "jwt_subject"
+	KeyByAPIKey     = "api_key"
+	KeyByTenant     = "tenant"
+)
+
+// The stores of the counters.
+const (
+	StoreRedis  = "redis"
+	StoreMemory = "memory"
+)
+
+var (
+	ErrNilConnection = errors.New("ratelimit: redis connection is nil")
+	ErrInvalidRule   = errors.New("ratelimit: invalid rule")
+)
+
+// Rule allows `Limit` requests per `Period`. With the token bucket algorithm, the bucket holds up to `Burst`
+// tokens (`Limit` by default) and is refilled at `Limit / Period`.
+type Rule struct {
+	Algorithm string
+	Limit     int
+	Period    time.Duration
+	Burst     int
+}
+
+// RuleFromConfig converts a rule of `env.json`.
+func RuleFromConfig(r config.RateLimitRule) Rule {
+	return Rule{
+		Algorithm: r.Algorithm,
+		Limit:     r.Limit,
+		Period:    r.Period,
+		Burst:     r.Burst,
+	}
+}
+
+func (r Rule) validate() error {
+	if r.Limit <= 0 || r.Period <= 0 || r.Burst < 0 {
+		return fmt.Errorf("%w: limit and period must be greater than 0", ErrInvalidRule)
+	}
+
+	switch r.Algorithm {
+	case "", TokenBucket, SlidingWindow:
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown algorithm %q", ErrInvalidRule, r.Algorithm)
+}
+
+// capacity is the maximum number of requests allowed at once.
+func (r Rule) capacity() int {
+	if r.Algorithm != SlidingWindow && r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// Result is the state of a key after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the quota is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, 0 if the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Store counts the requests of a key.
+type Store interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
@@ -0,0 +1,266 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	redisStore, err := NewRedisStore(&dbdrivers.RedisDBConn{Primary: client})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return map[string]Store{
+		StoreRedis:  redisStore,
+		StoreMemory: NewMemoryStore(ctx, time.Minute),
+	}
+}
+
+func TestStore_TokenBucket(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rule := Rule{Algorithm: TokenBucket, Limit: 1, Period: time.Hour, Burst: 3}
+
+			for i := 0; i < 3; i++ {
+				res, err := store.Allow(ctx, "tb", rule)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed)
+				assert.Equal(t, 3, res.Limit)
+				assert.Equal(t, 2-i, res.Remaining)
+			}
+
+			res, err := store.Allow(ctx, "tb", rule)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+			assert.InDelta(t, time.Hour, res.RetryAfter, float64(time.Second))
+			assert.InDelta(t, 3*time.Hour, res.Reset, float64(time.Second))
+
+			// The other keys have their own bucket.
+			res, err = store.Allow(ctx, "tb2", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+		})
+	}
+}
+
+func TestStore_TokenBucket_Refill(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rule := Rule{Limit: 1, Period: 50 * time.Millisecond}
+
+			res, err := store.Allow(ctx, "refill", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			res, err = store.Allow(ctx, "refill", rule)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+
+			time.Sleep(60 * time.Millisecond)
+
+			res, err = store.Allow(ctx, "refill", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+		})
+	}
+}
+
+func TestStore_SlidingWindow(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rule := Rule{Algorithm: SlidingWindow, Limit: 2, Period: 100 * time.Millisecond, Burst: 10}
+
+			for i := 0; i < 2; i++ {
+				res, err := store.Allow(ctx, "sw", rule)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed)
+				assert.Equal(t, 2, res.Limit)
+				assert.Equal(t, 1-i, res.Remaining)
+			}
+
+			res, err := store.Allow(ctx, "sw", rule)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Greater(t, res.RetryAfter, time.Duration(0))
+			assert.LessOrEqual(t, res.RetryAfter, 100*time.Millisecond)
+
+			time.Sleep(110 * time.Millisecond)
+
+			res, err = store.Allow(ctx, "sw", rule)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+		})
+	}
+}
+
+func TestStore_InvalidRule(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Allow(context.Background(), "invalid", Rule{Limit: 1})
+			assert.ErrorIs(t, err, ErrInvalidRule)
+
+			_, err = store.Allow(context.Background(), "invalid", Rule{Algorithm: "fixed", Limit: 1, Period: time.Second})
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.RateLimit{
+		KeyBy:   KeyByAPIKey,
+		Default: config.RateLimitRule{Limit: 2, Period: time.Hour},
+		Routes: []config.RateLimitRoute{
+			{Method: "post", Path: "/login", RateLimitRule: config.RateLimitRule{Algorithm: SlidingWindow, Limit: 1, Period: time.Hour}},
+			{Path: "/health", RateLimitRule: config.RateLimitRule{Limit: 0}},
+		},
+		Tenants: []config.RateLimitTenant{
+			{TenantID: "42", RateLimitRule: config.RateLimitRule{Limit: 5, Period: time.Hour}},
+		},
+	}
+
+	lookup := func(value string) (uint64, bool) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		return id, err == nil && id == 42
+	}
+
+	e := echo.New()
+	e.Use(tenant.Middleware(config.TenantResolver{}, lookup))
+	e.Use(Middleware(cfg, NewMemoryStore(ctx, 0), nil))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/users/:id", ok)
+	e.POST("/login", ok)
+	e.GET("/health", ok)
+
+	do := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("default rule per route pattern and api key", func(t *testing.T) {
+		alice := map[string]string{"X-API-Key": "alice"}
+
+		rec := do(http.MethodGet, "/users/1", alice)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get(HeaderLimit))
+		assert.Equal(t, "1", rec.Header().Get(HeaderRemaining))
+
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/users/2", alice).Code)
+
+		rec = do(http.MethodGet, "/users/3", alice)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1800", rec.Header().Get(HeaderRetryAfter))
+		assert.JSONEq(t, `{"errorCode":"100010","errorMsg":"too many requests","errors":null}`, rec.Body.String())
+
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/users/1", map[string]string{"X-API-Key": "bob"}).Code)
+	})
+
+	t.Run("route rule", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/login", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/login", nil).Code)
+	})
+
+	t.Run("unlimited route", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			rec := do(http.MethodGet, "/health", nil)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Header().Get(HeaderLimit))
+		}
+	})
+
+	t.Run("tenant quota", func(t *testing.T) {
+		vip := map[string]string{"X-Tenant-ID": "42"}
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusOK, do(http.MethodGet, "/users/1", vip).Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/users/1", vip).Code)
+	})
+}
+
+func TestMiddleware_unresolvedTenant(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Without the tenant middleware, the header of the client must not select a tenant quota.
+	e := echo.New()
+	e.Use(Middleware(config.RateLimit{
+		KeyBy:   KeyByTenant,
+		Default: config.RateLimitRule{Limit: 1, Period: time.Hour},
+		Tenants: []config.RateLimitTenant{
+			{TenantID: "42", RateLimitRule: config.RateLimitRule{Limit: 5, Period: time.Hour}},
+		},
+	}, NewMemoryStore(ctx, 0), nil))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	do := func(tenantID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant-ID", tenantID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("42"))
+	assert.Equal(t, http.StatusTooManyRequests, do("42"))
+	assert.Equal(t, http.StatusTooManyRequests, do("43"))
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, Rule) (Result, error) {
+	return Result{}, redis.ErrClosed
+}
+
+func TestMiddleware_FailOpen(t *testing.T) {
+	for _, failOpen := range []bool{true, false} {
+		e := echo.New()
+		e.Use(Middleware(config.RateLimit{
+			FailOpen: failOpen,
+			Default:  config.RateLimitRule{Limit: 1, Period: time.Second},
+		}, failingStore{}, nil))
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if failOpen {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		}
+	}
+}
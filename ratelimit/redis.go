@@ -0,0 +1,150 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+)
+
+// tokenBucketScript refills the bucket for the elapsed time and takes a token if there is one.
+// It returns {allowed, remaining, retry after in ms, reset in ms}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], reset + 1000)
+
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// slidingWindowScript keeps the timestamps of the requests in the window in a sorted set.
+// It returns {allowed, remaining, retry after in ms, reset in ms}.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+
+local reset = 0
+local retry = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+if allowed == 0 then
+	retry = reset
+end
+
+return {allowed, limit - count, retry, reset}
+`)
+
+type redisStore struct {
+	conn *dbdrivers.RedisDBConn
+}
+
+// NewRedisStore returns a store which shares the counters between all the instances.
+func NewRedisStore(conn *dbdrivers.RedisDBConn) (Store, error) {
+	if conn == nil || conn.Primary == nil {
+		return nil, ErrNilConnection
+	}
+
+	return &redisStore{conn: conn}, nil
+}
+
+func (s *redisStore) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	if err := rule.validate(); err != nil {
+		return Result{}, err
+	}
+
+	now := time.Now().UnixMilli()
+
+	var (
+		v   interface{}
+		err error
+	)
+	if rule.Algorithm == SlidingWindow {
+		v, err = s.conn.Run(ctx, slidingWindowScript, []string{key},
+			rule.Limit, rule.Period.Milliseconds(), now, strconv.FormatInt(now, 10)+"-"+uuid.NewString())
+	} else {
+		rate := float64(rule.Limit) / float64(rule.Period.Milliseconds())
+		v, err = s.conn.Run(ctx, tokenBucketScript, []string{key},
+			strconv.FormatFloat(rate, 'f', -1, 64), rule.capacity(), now)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, _ := v.([]interface{})
+	if len(values) != 4 {
+		return Result{}, redis.Nil
+	}
+
+	result := Result{Limit: rule.capacity()}
+	result.Allowed = toInt64(values[0]) == 1
+	result.Remaining = int(math.Max(0, float64(toInt64(values[1]))))
+	result.RetryAfter = time.Duration(toInt64(values[2])) * time.Millisecond
+	result.Reset = time.Duration(toInt64(values[3])) * time.Millisecond
+
+	return result, nil
+}
+
+func toInt64(v interface{}) int64 {
+	i, _ := v.(int64)
+	return i
+}
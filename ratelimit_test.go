@@ -0,0 +1,47 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBean_useRateLimit_SkipsProbes(t *testing.T) {
+	originalConf := config.Bean
+	defer func() { config.Bean = originalConf }()
+
+	config.Bean = &config.Config{}
+	config.Bean.Health.On = true
+	config.Bean.RateLimit.Store = ratelimit.StoreMemory
+	config.Bean.RateLimit.Default = config.RateLimitRule{Limit: 1, Period: time.Hour}
+
+	b := &Bean{Echo: echo.New(), Config: *config.Bean}
+	require.NoError(t, b.useRateLimit())
+	t.Cleanup(func() { _ = b.shutdownWithTimeout() })
+
+	livenessPath, readinessPath := healthPaths()
+	b.Echo.GET(livenessPath, b.LivenessHandler)
+	b.Echo.GET(readinessPath, b.ReadinessHandler)
+	b.Echo.GET("/users", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	// The probes of the public listener are never limited.
+	for i := 0; i < 3; i++ {
+		code, _ := request(http.MethodGet, livenessPath, b.Echo)
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = request(http.MethodGet, readinessPath, b.Echo)
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	code, _ := request(http.MethodGet, "/users", b.Echo)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = request(http.MethodGet, "/users", b.Echo)
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
@@ -0,0 +1,99 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/internal/gopool"
+	"github.com/retail-ai-inc/bean/v2/internal/regex"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+)
+
+var watchConfigOnce sync.Once
+
+// currentTracesSampler samples the transactions with `sentry.tracesSampleRate` of the current config.
+var currentTracesSampler = sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
+	return helpers.FloatInRange(config.Current().Sentry.TracesSampleRate, 0.0, 1.0)
+})
+
+// applyConfigChange re-applies the settings which can be changed safely at runtime. The middleware
+// stack itself is built once, so turning a feature on or off still needs a restart.
+func applyConfigChange(_, newCfg *config.Config) {
+	defer func() {
+		// IMPORTANT: An invalid value (e.g. a broken regular expression) must not crash a running server.
+		if r := recover(); r != nil {
+			logReloadError(fmt.Errorf("failed to apply the reloaded config: %v", r))
+		}
+	}()
+
+	if newCfg.AccessLog.On {
+		regex.CompileAccessLogSkipPaths(newCfg.AccessLog.SkipEndpoints)
+	}
+
+	if newCfg.Sentry.On {
+		regex.CompileTraceSkipPaths(newCfg.Sentry.SkipTracesEndpoints)
+	}
+
+	if newCfg.Prometheus.On {
+		if err := regex.CompilePrometheusSkipPaths(newCfg.Prometheus.SkipEndpoints, metricsPath); err != nil {
+			logReloadError(err)
+		}
+	}
+
+	// Resize the existing goroutine pools and register the new ones. `blockAfter` of an existing
+	// pool cannot be changed at runtime.
+	for _, asyncPool := range newCfg.AsyncPool {
+		if asyncPool.Name == "" {
+			continue
+		}
+
+		if _, err := gopool.GetPool(asyncPool.Name); err == nil {
+			if asyncPool.Size != nil {
+				_ = gopool.Tune(asyncPool.Name, *asyncPool.Size)
+			}
+			continue
+		}
+
+		pool, err := newAsyncPool(asyncPool.Size, asyncPool.BlockAfter)
+		if err != nil {
+			logReloadError(err)
+			continue
+		}
+
+		if err := gopool.Register(asyncPool.Name, pool); err != nil {
+			pool.Release()
+			logReloadError(err)
+		}
+	}
+}
+
+func logReloadError(err error) {
+	if l := blog.Logger(); l != nil {
+		l.Error(err)
+	}
+}
@@ -142,11 +142,11 @@ func setSpan(ctx context.Context, req *http.Request) *sentry.Span {
 		hub.Scope().SetRequest(req)
 		ctx = sentry.SetHubOnContext(ctx, hub)
 
-		if config.Bean.Sentry.TracesSampleRate > 0.0 {
+		if config.Current().Sentry.TracesSampleRate > 0.0 {
 			urlPath := req.URL.Path
 
 			functionName := "unknown function"
-			if config.Bean.Sentry.On && config.Bean.Sentry.TracesSampleRate > 0.0 {
+			if config.Bean.Sentry.On && config.Current().Sentry.TracesSampleRate > 0.0 {
 				if pc, file, line, ok := runtime.Caller(1); ok {
 					functionName = fmt.Sprintf("%s:%d\n\t\r %s\n", path.Base(file), line, runtime.FuncForPC(pc).Name())
 				}
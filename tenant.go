@@ -0,0 +1,327 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/bean/v2/circuitbreaker"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// TenantConns holds the database connections of a tenant. A connection is nil if the tenant has no such database
+// in `TenantConnections`. The mongo calls go through the circuit breaker with `ExecuteMongo` only.
+type TenantConns struct {
+	ID          uint64
+	Code        string
+	MySQLDB     *gorm.DB
+	MySQLDBName string
+	MongoDB     *mongo.Client
+	MongoDBName string
+	RedisDB     *dbdrivers.RedisDBConn
+
+	mongoBreaker *circuitbreaker.Breaker
+}
+
+func (conns *TenantConns) dbs() dbdrivers.TenantDBs {
+	return dbdrivers.TenantDBs{
+		MySQL:     conns.MySQLDB,
+		MySQLName: conns.MySQLDBName,
+		Mongo:     conns.MongoDB,
+		MongoName: conns.MongoDBName,
+		Redis:     conns.RedisDB,
+	}
+}
+
+// TenantRegistry holds the connections of the tenants. It is safe for concurrent use, so the tenants can be
+// added, changed and removed at runtime by `ReloadTenants`. With `database.tenant.pool.lazy`, it knows all the
+// tenants but holds the connections of the recently used ones only.
+type TenantRegistry struct {
+	mu      sync.RWMutex
+	tenants map[uint64]*TenantConns
+	codes   map[string]uint64
+	// hashes tell whether the `TenantConnections` row of a tenant changed since its connections were opened.
+	hashes map[uint64]string
+	pool   *tenantPool
+
+	failures   map[uint64]*TenantFailure
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func newTenantRegistry() *TenantRegistry {
+	registerTenantMetrics()
+
+	return &TenantRegistry{
+		tenants:    make(map[uint64]*TenantConns),
+		codes:      make(map[string]uint64),
+		hashes:     make(map[uint64]string),
+		failures:   make(map[uint64]*TenantFailure),
+		minBackoff: DefaultTenantRetryMinBackoff,
+		maxBackoff: DefaultTenantRetryMaxBackoff,
+	}
+}
+
+// Get returns the open connections of a tenant. Unlike `DBDeps.Tenant`, it never opens them in the lazy mode.
+func (r *TenantRegistry) Get(id uint64) (*TenantConns, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conns, ok := r.tenants[id]
+	return conns, ok
+}
+
+// Lookup returns the ID of a tenant from its ID or its code.
+func (r *TenantRegistry) Lookup(value string) (uint64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil && r.known(id) {
+		return id, true
+	}
+
+	id, ok := r.codes[value]
+	if !ok {
+		return 0, false
+	}
+	return id, r.known(id)
+}
+
+// known tells whether a tenant exists, even if its connections are not open. The caller holds the lock.
+func (r *TenantRegistry) known(id uint64) bool {
+	if r.pool != nil {
+		_, ok := r.pool.cfgs[id]
+		return ok
+	}
+
+	if _, ok := r.tenants[id]; ok {
+		return true
+	}
+	_, ok := r.failures[id]
+	return ok
+}
+
+// IDs returns the sorted IDs of the tenants, including the ones without open connections in the lazy mode and
+// the unavailable ones.
+func (r *TenantRegistry) IDs() []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []uint64
+	if r.pool != nil {
+		ids = make([]uint64, 0, len(r.pool.cfgs))
+		for id := range r.pool.cfgs {
+			ids = append(ids, id)
+		}
+	} else {
+		ids = make([]uint64, 0, len(r.tenants)+len(r.failures))
+		for id := range r.tenants {
+			ids = append(ids, id)
+		}
+		for id := range r.failures {
+			if _, ok := r.tenants[id]; !ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sortIDs(ids)
+
+	return ids
+}
+
+func sortIDs(ids []uint64) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+// All returns the open connections of the tenants, sorted by ID.
+func (r *TenantRegistry) All() []*TenantConns {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]*TenantConns, 0, len(r.tenants))
+	for _, conns := range r.tenants {
+		all = append(all, conns)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	return all
+}
+
+// set adds or replaces the connections of a tenant and returns the previous ones, if any.
+func (r *TenantRegistry) set(conns *TenantConns, hash string) *TenantConns {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.tenants[conns.ID]
+	if old != nil && r.codes[old.Code] == old.ID {
+		delete(r.codes, old.Code)
+	}
+
+	r.tenants[conns.ID] = conns
+	r.hashes[conns.ID] = hash
+	if conns.Code != "" {
+		r.codes[conns.Code] = conns.ID
+	}
+	r.recoverLocked(conns.ID)
+
+	return old
+}
+
+// remove removes a tenant and returns its connections, if any. It returns false if the tenant is unknown.
+func (r *TenantRegistry) remove(id uint64) (*TenantConns, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, failed := r.failures[id]
+	if failed {
+		if r.codes[f.Code] == id {
+			delete(r.codes, f.Code)
+		}
+		r.recoverLocked(id)
+	}
+
+	old, ok := r.tenants[id]
+	if !ok {
+		return nil, failed
+	}
+
+	delete(r.tenants, id)
+	delete(r.hashes, id)
+	if r.codes[old.Code] == id {
+		delete(r.codes, old.Code)
+	}
+
+	return old, true
+}
+
+func (r *TenantRegistry) hash(id uint64) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h, ok := r.hashes[id]
+	return h, ok
+}
+
+// Tenants returns the registry of the tenants. It starts with the tenants loaded by `InitDB`, or with the tenant
+// maps of a `DBDeps` built by hand.
+func (deps *DBDeps) Tenants() *TenantRegistry {
+	deps.tenantsOnce.Do(func() {
+		if deps.tenants != nil {
+			return
+		}
+
+		r := newTenantRegistry()
+		add := func(id uint64) *TenantConns {
+			if conns, ok := r.tenants[id]; ok {
+				return conns
+			}
+			conns := &TenantConns{ID: id}
+			r.tenants[id] = conns
+			return conns
+		}
+		for id, db := range deps.TenantMySQLDBs {
+			conns := add(id)
+			conns.MySQLDB, conns.MySQLDBName = db, deps.TenantMySQLDBNames[id]
+		}
+		for id, client := range deps.TenantMongoDBs {
+			conns := add(id)
+			conns.MongoDB, conns.MongoDBName = client, deps.TenantMongoDBNames[id]
+		}
+		for id, conn := range deps.TenantRedisDBs {
+			add(id).RedisDB = conn
+		}
+		for code, id := range deps.TenantCodes {
+			if conns, ok := r.tenants[id]; ok {
+				conns.Code = code
+				r.codes[code] = id
+			}
+		}
+
+		deps.tenants = r
+	})
+
+	return deps.tenants
+}
+
+// ForTenant returns the connections of the tenant of the context, set by the tenant middleware or
+// `tenant.NewContext`. The error is an `APIError` with the `UNKNOWN_TENANT` code if the context has no tenant
+// or the tenant is unknown.
+func (deps *DBDeps) ForTenant(ctx context.Context) (*TenantConns, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.NewNoTenantError()
+	}
+
+	return deps.Tenant(id)
+}
+
+// Tenant returns the connections of a tenant, or an `APIError` with the `UNKNOWN_TENANT` code, or with the
+// `TENANT_UNAVAILABLE` code if its connections could not be opened. In the lazy mode, the connections are opened
+// on the first use.
+func (deps *DBDeps) Tenant(id uint64) (*TenantConns, error) {
+	return deps.Tenants().acquire(id)
+}
+
+// LookupTenant returns the ID of a known tenant from its ID or its code.
+func (deps *DBDeps) LookupTenant(value string) (uint64, bool) {
+	return deps.Tenants().Lookup(value)
+}
+
+// useTenantResolver adds the tenant middleware, which runs before the other middlewares of bean so they see
+// the tenant of the request. The end points of bean on the public listener never require a tenant.
+func (b *Bean) useTenantResolver() {
+	deps := b.DBConn
+	if deps == nil {
+		deps = &DBDeps{}
+	}
+
+	cfg := b.Config.Database.Tenant.Resolver
+	cfg.SkipPaths = append([]string{}, cfg.SkipPaths...)
+	if b.AdminEcho == nil {
+		if b.Config.Health.On {
+			livenessPath, readinessPath := healthPaths()
+			cfg.SkipPaths = append(cfg.SkipPaths, livenessPath, readinessPath)
+		}
+		if b.Config.Prometheus.On {
+			cfg.SkipPaths = append(cfg.SkipPaths, metricsPath)
+		}
+		for _, endPoint := range []string{
+			b.Config.Database.Memory.DelKeyAPI.EndPoint,
+			b.Config.Maintenance.API.EndPoint,
+			b.Config.Database.Tenant.Reload.API.EndPoint,
+		} {
+			if endPoint != "" {
+				cfg.SkipPaths = append(cfg.SkipPaths, endPoint)
+			}
+		}
+	}
+
+	b.Echo.Use(tenant.Middleware(cfg, deps.LookupTenant))
+}
@@ -0,0 +1,258 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package tenant resolves the tenant of a request and carries it in the request context.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+)
+
+// The sources of the tenant of a request.
+const (
+	SourceHeader    = "header"
+	SourceJWT       = "jwt"
+	SourceSubdomain = "subdomain"
+	SourceParam     = "param"
+)
+
+const (
+	DefaultHeader = "X-Tenant-ID"
+	DefaultClaim  = "tenantId"
+	DefaultParam  = "tenantId"
+)
+
+var (
+	// ErrUnknownTenant is returned, wrapped in an `APIError` with the `UNKNOWN_TENANT` code, for a tenant which
+	// is not in `TenantConnections`. Check it with `errors.Is(err, tenant.ErrUnknownTenant)`.
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// ErrNoTenant is returned, wrapped in an `APIError` with the `UNKNOWN_TENANT` code, if the request has no
+	// tenant.
+	ErrNoTenant = errors.New("the tenant is required")
+
+	// ErrTenantUnavailable is returned, wrapped in an `APIError` with the `TENANT_UNAVAILABLE` code, for a tenant
+	// whose connections could not be opened. Check it with `errors.Is(err, tenant.ErrTenantUnavailable)`.
+	ErrTenantUnavailable = errors.New("tenant unavailable")
+)
+
+// UnknownTenantError tells which tenant is unknown.
+type UnknownTenantError struct {
+	Tenant string
+}
+
+func (e *UnknownTenantError) Error() string {
+	return "unknown tenant " + strconv.Quote(e.Tenant)
+}
+
+func (e *UnknownTenantError) Is(target error) bool {
+	return target == ErrUnknownTenant
+}
+
+// NewUnknownTenantError returns the `404` `APIError` of an unknown tenant.
+func NewUnknownTenantError(tenant string) error {
+	return berror.NewAPIError(http.StatusNotFound, berror.UNKNOWN_TENANT, &UnknownTenantError{Tenant: tenant})
+}
+
+// UnavailableTenantError tells which tenant is unavailable and why.
+type UnavailableTenantError struct {
+	Tenant string
+	Err    error
+}
+
+func (e *UnavailableTenantError) Error() string {
+	return "tenant " + strconv.Quote(e.Tenant) + " is unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableTenantError) Is(target error) bool {
+	return target == ErrTenantUnavailable
+}
+
+func (e *UnavailableTenantError) Unwrap() error {
+	return e.Err
+}
+
+// NewUnavailableTenantError returns the `503` `APIError` of a tenant whose connections could not be opened.
+func NewUnavailableTenantError(tenant string, err error) error {
+	return berror.NewAPIError(http.StatusServiceUnavailable, berror.TENANT_UNAVAILABLE,
+		&UnavailableTenantError{Tenant: tenant, Err: err})
+}
+
+// NewNoTenantError returns the `400` `APIError` of a request without tenant.
+func NewNoTenantError() error {
+	return berror.NewAPIError(http.StatusBadRequest, berror.UNKNOWN_TENANT, ErrNoTenant)
+}
+
+type idKey struct{}
+
+// NewContext returns a copy of the context which carries the tenant ID.
+func NewContext(ctx context.Context, id uint64) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// FromContext returns the tenant ID set by `NewContext` or the middleware.
+func FromContext(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(idKey{}).(uint64)
+	return id, ok
+}
+
+// FromRequest returns the tenant ID of the request context as a string. Without the tenant middleware, it falls
+// back to the value of the header, as it is sent by the client.
+func FromRequest(req *http.Request, header string) string {
+	if id, ok := FromContext(req.Context()); ok {
+		return strconv.FormatUint(id, 10)
+	}
+	if header == "" {
+		return ""
+	}
+	return req.Header.Get(header)
+}
+
+// Lookup returns the ID of a known tenant from a tenant ID or a tenant code.
+type Lookup func(value string) (uint64, bool)
+
+// Middleware resolves the tenant of the request, checks it with lookup and sets its ID in the request context.
+// An unknown tenant gets a `404`, and a request without tenant a `400` if `required`. Both have the
+// `UNKNOWN_TENANT` error code.
+func Middleware(cfg config.TenantResolver, lookup Lookup) echo.MiddlewareFunc {
+	sources := cfg.Sources
+	if len(sources) == 0 {
+		sources = []string{SourceHeader}
+	}
+
+	skipPaths := make(map[string]bool, len(cfg.SkipPaths))
+	for _, path := range cfg.SkipPaths {
+		skipPaths[path] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipPaths[c.Path()] {
+				return next(c)
+			}
+
+			value := resolve(c, cfg, sources)
+			if value == "" {
+				if cfg.Required {
+					return NewNoTenantError()
+				}
+				return next(c)
+			}
+
+			id, ok := lookup(value)
+			if !ok {
+				return NewUnknownTenantError(value)
+			}
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(NewContext(req.Context(), id)))
+
+			return next(c)
+		}
+	}
+}
+
+// resolve returns the tenant of the first source which has a value.
+func resolve(c echo.Context, cfg config.TenantResolver, sources []string) string {
+	for _, source := range sources {
+		var value string
+		switch source {
+		case SourceHeader:
+			value = c.Request().Header.Get(orDefault(cfg.Header, DefaultHeader))
+		case SourceJWT:
+			value = claimOf(c, orDefault(cfg.Claim, DefaultClaim))
+		case SourceSubdomain:
+			value = subdomainOf(c.Request().Host, cfg.Domain)
+		case SourceParam:
+			value = c.Param(orDefault(cfg.Param, DefaultParam))
+		}
+
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func claimOf(c echo.Context, claim string) string {
+	claims := jwt.MapClaims{}
+	if err := helpers.DecodeJWT(c, claims, config.GetString("jwt.secret")); err != nil {
+		return ""
+	}
+
+	switch v := claims[claim].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// subdomainOf returns the subdomain of the host under the domain, e.g. `acme` for `acme.example.com`. Without
+// domain, it returns the first label of a host which has at least 3 labels.
+func subdomainOf(host, domain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+
+	if domain != "" {
+		sub, ok := strings.CutSuffix(host, "."+strings.ToLower(domain))
+		if !ok || strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return ""
+	}
+	return labels[0]
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,152 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/config"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookup knows the tenants 1 (`acme`) and 2 (`globex`).
+func lookup(value string) (uint64, bool) {
+	codes := map[string]uint64{"acme": 1, "globex": 2}
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return id, id == 1 || id == 2
+	}
+	id, ok := codes[value]
+	return id, ok
+}
+
+func newTestEcho(cfg config.TenantResolver) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		_, _ = berror.APIErrorHandlerFunc(err, c)
+	}
+	e.Use(Middleware(cfg, lookup))
+
+	handler := func(c echo.Context) error {
+		id, ok := FromContext(c.Request().Context())
+		if !ok {
+			return c.String(http.StatusOK, "none")
+		}
+		return c.String(http.StatusOK, strconv.FormatUint(id, 10))
+	}
+	e.GET("/", handler)
+	e.GET("/ping", handler)
+	e.GET("/tenants/:tenantId/orders", handler)
+
+	return e
+}
+
+func do(e *echo.Echo, host, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Host = host
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_Sources(t *testing.T) {
+	viper.Set("jwt.secret", "secret")
+	t.Cleanup(func() { viper.Set("jwt.secret", nil) })
+
+	token, err := helpers.EncodeJWT(jwt.MapClaims{"tenantId": 2, "exp": time.Now().Add(time.Hour).Unix()}, "secret")
+	require.NoError(t, err)
+
+	e := newTestEcho(config.TenantResolver{
+		Sources: []string{SourceHeader, SourceJWT, SourceSubdomain, SourceParam},
+		Domain:  "example.com",
+	})
+
+	tests := []struct {
+		name    string
+		host    string
+		target  string
+		headers []string
+		want    string
+	}{
+		{name: "header", host: "example.com", target: "/", headers: []string{DefaultHeader, "1"}, want: "1"},
+		{name: "header code", host: "example.com", target: "/", headers: []string{DefaultHeader, "globex"}, want: "2"},
+		{name: "jwt", host: "example.com", target: "/", headers: []string{echo.HeaderAuthorization, "Bearer " + token}, want: "2"},
+		{name: "subdomain", host: "acme.example.com:8080", target: "/", want: "1"},
+		{name: "param", host: "example.com", target: "/tenants/2/orders", want: "2"},
+		{name: "first source wins", host: "acme.example.com", target: "/", headers: []string{DefaultHeader, "2"}, want: "2"},
+		{name: "invalid token", host: "example.com", target: "/", headers: []string{echo.HeaderAuthorization, "Bearer invalid"}, want: "none"},
+		{name: "nested subdomain", host: "a.acme.example.com", target: "/", want: "none"},
+		{name: "none", host: "example.com", target: "/", want: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(e, tt.host, tt.target, tt.headers...)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestMiddleware_Errors(t *testing.T) {
+	e := newTestEcho(config.TenantResolver{Required: true, SkipPaths: []string{"/ping"}})
+
+	rec := do(e, "example.com", "/", DefaultHeader, "3")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"100014"`)
+
+	rec = do(e, "example.com", "/")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(e, "example.com", "/ping", DefaultHeader, "3")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "none", rec.Body.String())
+
+	var apiErr *berror.APIError
+	err := NewUnknownTenantError("3")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, berror.UNKNOWN_TENANT, apiErr.GlobalErrCode)
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+	assert.EqualError(t, errors.Unwrap(err), `unknown tenant "3"`)
+	assert.ErrorIs(t, NewNoTenantError(), ErrNoTenant)
+
+	refused := errors.New("connection refused")
+	err = NewUnavailableTenantError("3", refused)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.HTTPStatusCode)
+	assert.Equal(t, berror.TENANT_UNAVAILABLE, apiErr.GlobalErrCode)
+	assert.ErrorIs(t, err, ErrTenantUnavailable)
+	assert.ErrorIs(t, err, refused)
+	assert.EqualError(t, errors.Unwrap(err), `tenant "3" is unavailable: connection refused`)
+}
+
+func TestFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultHeader, "acme")
+	assert.Equal(t, "acme", FromRequest(req, DefaultHeader))
+	assert.Empty(t, FromRequest(req, ""))
+
+	req = req.WithContext(NewContext(context.Background(), 1))
+	assert.Equal(t, "1", FromRequest(req, DefaultHeader))
+}
+
+func TestSubdomainOf(t *testing.T) {
+	assert.Equal(t, "acme", subdomainOf("ACME.example.com.", ""))
+	assert.Equal(t, "acme", subdomainOf("acme.shop.example.com", "shop.example.com"))
+	assert.Empty(t, subdomainOf("example.com", ""))
+	assert.Empty(t, subdomainOf("127.0.0.1:8080", ""))
+	assert.Empty(t, subdomainOf("acme.other.com", "example.com"))
+}
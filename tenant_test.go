@@ -0,0 +1,190 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func TestDBDeps_ForTenant(t *testing.T) {
+	mysqlDB := &gorm.DB{}
+	redisDB := &dbdrivers.RedisDBConn{}
+	deps := &DBDeps{
+		TenantMySQLDBs:     map[uint64]*gorm.DB{1: mysqlDB, 2: nil},
+		TenantMySQLDBNames: map[uint64]string{1: "acme_db", 2: ""},
+		TenantRedisDBs:     map[uint64]*dbdrivers.RedisDBConn{3: redisDB},
+		TenantCodes:        map[string]uint64{"acme": 1, "globex": 2, "gone": 4},
+	}
+
+	conns, err := deps.ForTenant(tenant.NewContext(context.Background(), 1))
+	require.NoError(t, err)
+	assert.Equal(t, &TenantConns{ID: 1, Code: "acme", MySQLDB: mysqlDB, MySQLDBName: "acme_db"}, conns)
+
+	conns, err = deps.Tenant(3)
+	require.NoError(t, err)
+	assert.Same(t, redisDB, conns.RedisDB)
+	assert.Nil(t, conns.MySQLDB)
+
+	_, err = deps.ForTenant(context.Background())
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+
+	_, err = deps.ForTenant(tenant.NewContext(context.Background(), 4))
+	assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+
+	for value, want := range map[string]uint64{"1": 1, "2": 2, "3": 3, "acme": 1, "globex": 2} {
+		id, ok := deps.LookupTenant(value)
+		assert.True(t, ok, value)
+		assert.Equal(t, want, id, value)
+	}
+	for _, value := range []string{"4", "gone", "unknown", ""} {
+		_, ok := deps.LookupTenant(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestDBDeps_ReloadTenants(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	var mu sync.Mutex
+	var opened []uint64
+	rows := []*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme", Connections: datatypes.JSON(`{"redis":{"database":1}}`)},
+		{TenantID: 2, Code: "globex", Connections: datatypes.JSON(`{"redis":{"database":2}}`)},
+	}
+
+	deps := &DBDeps{}
+	deps.tenantLoader = &tenantLoader{
+		load: func(ctx context.Context) ([]*dbdrivers.TenantConnections, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]*dbdrivers.TenantConnections(nil), rows...), nil
+		},
+		open: func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			if tc.TenantID == 4 {
+				return nil, fmt.Errorf("failed to open the connections of tenant %d", tc.TenantID)
+			}
+			mu.Lock()
+			opened = append(opened, tc.TenantID)
+			mu.Unlock()
+
+			client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			return &TenantConns{ID: tc.TenantID, Code: tc.Code, RedisDB: &dbdrivers.RedisDBConn{Primary: client}}, nil
+		},
+		closeDelay: 10 * time.Millisecond,
+	}
+
+	ctx := context.Background()
+	changes, err := deps.ReloadTenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &TenantChanges{Added: []uint64{1, 2}}, changes)
+	assert.Equal(t, []uint64{1, 2}, deps.Tenants().IDs())
+
+	// Nothing changed.
+	changes, err = deps.ReloadTenants(ctx)
+	require.NoError(t, err)
+	assert.True(t, changes.empty())
+	assert.Equal(t, []uint64{1, 2}, opened)
+
+	first, err := deps.Tenant(1)
+	require.NoError(t, err)
+	second, err := deps.Tenant(2)
+	require.NoError(t, err)
+
+	// Tenant 1 changed, 2 is deleted, 3 is new and 4 fails to open.
+	mu.Lock()
+	rows = []*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme", Connections: datatypes.JSON(`{"redis":{"database":3}}`)},
+		{TenantID: 3, Code: "initech"},
+		{TenantID: 4, Code: "umbrella"},
+	}
+	mu.Unlock()
+
+	changes, err = deps.ReloadTenants(ctx)
+	require.Error(t, err)
+	assert.Equal(t, &TenantChanges{Added: []uint64{3}, Updated: []uint64{1}, Removed: []uint64{2}, Failed: []uint64{4}}, changes)
+	assert.Equal(t, []uint64{1, 3, 4}, deps.Tenants().IDs())
+	_, err = deps.Tenant(4)
+	assert.ErrorIs(t, err, tenant.ErrTenantUnavailable)
+
+	updated, err := deps.Tenant(1)
+	require.NoError(t, err)
+	assert.NotSame(t, first, updated)
+
+	_, err = deps.Tenant(2)
+	assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+	_, ok := deps.LookupTenant("globex")
+	assert.False(t, ok)
+	id, ok := deps.LookupTenant("initech")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), id)
+
+	// The previous connections are closed after the delay.
+	assert.Eventually(t, func() bool {
+		return errors.Is(first.RedisDB.Primary.Ping(ctx).Err(), redis.ErrClosed) &&
+			errors.Is(second.RedisDB.Primary.Ping(ctx).Err(), redis.ErrClosed)
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, updated.RedisDB.Primary.Ping(ctx).Err())
+
+	require.NoError(t, deps.Close(ctx))
+	assert.ErrorIs(t, updated.RedisDB.Primary.Ping(ctx).Err(), redis.ErrClosed)
+
+	_, err = (&DBDeps{}).ReloadTenants(ctx)
+	assert.Error(t, err)
+}
+
+func TestDBDeps_ReloadTenants_legacyMaps(t *testing.T) {
+	s := miniredis.RunT(t)
+	ctx := context.Background()
+
+	initial := &dbdrivers.RedisDBConn{Primary: redis.NewClient(&redis.Options{Addr: s.Addr()})}
+	deps := &DBDeps{
+		TenantRedisDBs: map[uint64]*dbdrivers.RedisDBConn{1: initial},
+		TenantCodes:    map[string]uint64{"acme": 1},
+	}
+	deps.tenantLoader = &tenantLoader{
+		load: func(ctx context.Context) ([]*dbdrivers.TenantConnections, error) {
+			return []*dbdrivers.TenantConnections{{TenantID: 1, Code: "acme", Connections: datatypes.JSON(`{"redis":{"database":1}}`)}}, nil
+		},
+		open: func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			return &TenantConns{ID: tc.TenantID, Code: tc.Code, RedisDB: &dbdrivers.RedisDBConn{Primary: client}}, nil
+		},
+		closeDelay: time.Millisecond,
+	}
+
+	changes, err := deps.ReloadTenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, changes.Updated)
+
+	// The connection of the `Tenant*` maps is kept open for their callers.
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, initial.Primary.Ping(ctx).Err())
+
+	require.NoError(t, deps.Close(ctx))
+	assert.ErrorIs(t, initial.Primary.Ping(ctx).Err(), redis.ErrClosed)
+}
+
+func TestDBDeps_Close_pendingCloses(t *testing.T) {
+	deps := &DBDeps{}
+	pc := deps.closeTenantsAfter([]*TenantConns{{ID: 1}}, time.Hour)
+
+	// The shutdown does not wait for the delay.
+	require.NoError(t, deps.Close(context.Background()))
+	assert.True(t, pc.closed.Load())
+	assert.Empty(t, deps.pendingCloses)
+	assert.False(t, pc.timer.Stop())
+}
@@ -0,0 +1,272 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package bean
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/v2/helpers"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTenantRetryMinBackoff is the first delay before retrying to open the connections of a tenant.
+	DefaultTenantRetryMinBackoff = 5 * time.Second
+	// DefaultTenantRetryMaxBackoff caps the delay between the retries.
+	DefaultTenantRetryMaxBackoff = 5 * time.Minute
+)
+
+var (
+	tenantUnavailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "tenant",
+		Name:      "unavailable",
+		Help:      "How many tenants have connections which could not be opened.",
+	})
+
+	tenantRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "tenant",
+		Name:      "retries_total",
+		Help:      "How many times the connections of an unavailable tenant were opened again, by result: success or failure.",
+	}, []string{"result"})
+
+	registerTenantMetricsOnce sync.Once
+)
+
+// registerTenantMetrics registers the metrics to the default prometheus registry, which is exposed on
+// `/metrics`.
+func registerTenantMetrics() {
+	registerTenantMetricsOnce.Do(func() {
+		for _, c := range []prometheus.Collector{tenantUnavailable, tenantRetriesTotal} {
+			if err := prometheus.Register(c); err != nil {
+				var are prometheus.AlreadyRegisteredError
+				if !errors.As(err, &are) {
+					panic(err)
+				}
+			}
+		}
+	})
+}
+
+// TenantFailure is a tenant whose connections could not be opened. The requests of the tenant get a `503`
+// `APIError` with the `TENANT_UNAVAILABLE` code until a retry succeeds, unless it still has the connections
+// opened before its last change.
+type TenantFailure struct {
+	ID        uint64
+	Code      string
+	Err       error
+	Attempts  int
+	Since     time.Time
+	NextRetry time.Time
+
+	cfg *dbdrivers.TenantConnections
+}
+
+// Failures returns the tenants whose connections could not be opened, sorted by ID.
+func (r *TenantRegistry) Failures() []TenantFailure {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	failures := make([]TenantFailure, 0, len(r.failures))
+	for _, f := range r.failures {
+		failures = append(failures, *f)
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].ID < failures[j].ID })
+
+	return failures
+}
+
+// fail records that the connections of a tenant could not be opened and schedules the next retry.
+func (r *TenantRegistry) fail(t *dbdrivers.TenantConnections, err error) *TenantFailure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.failLocked(t, err)
+}
+
+func (r *TenantRegistry) failLocked(t *dbdrivers.TenantConnections, err error) *TenantFailure {
+	now := time.Now()
+
+	f, ok := r.failures[t.TenantID]
+	if ok && f.Code != t.Code && r.codes[f.Code] == t.TenantID {
+		delete(r.codes, f.Code)
+	}
+	if !ok || tenantHash(f.cfg) != tenantHash(t) {
+		// A changed row starts over.
+		f = &TenantFailure{ID: t.TenantID, Since: now}
+		r.failures[t.TenantID] = f
+	}
+
+	f.Code, f.Err, f.cfg = t.Code, err, t
+	if _, open := r.tenants[t.TenantID]; !open && t.Code != "" {
+		// The tenant is resolved from its code as well, to get the `503`.
+		r.codes[t.Code] = t.TenantID
+	}
+	f.Attempts++
+	f.NextRetry = now.Add(helpers.JitterBackoff(r.minBackoff, r.maxBackoff, f.Attempts-1))
+	tenantUnavailable.Set(float64(len(r.failures)))
+
+	return f
+}
+
+// recoverLocked forgets the failure of a tenant. The caller holds the lock of the registry.
+func (r *TenantRegistry) recoverLocked(id uint64) {
+	if _, ok := r.failures[id]; !ok {
+		return
+	}
+
+	delete(r.failures, id)
+	tenantUnavailable.Set(float64(len(r.failures)))
+}
+
+// unavailable returns the `APIError` of a failed tenant.
+func (f *TenantFailure) unavailable() error {
+	return tenant.NewUnavailableTenantError(strconv.FormatUint(f.ID, 10), f.Err)
+}
+
+// dueFailures returns the rows of the failed tenants to retry now.
+func (r *TenantRegistry) dueFailures() []*dbdrivers.TenantConnections {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var due []*dbdrivers.TenantConnections
+	for _, f := range r.failures {
+		if !now.Before(f.NextRetry) {
+			due = append(due, f.cfg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].TenantID < due[j].TenantID })
+
+	return due
+}
+
+// openTenants opens the tenants one by one. The ones which fail are recorded and retried later, so they do not
+// take the others down.
+func (deps *DBDeps) openTenants(cfgs []*dbdrivers.TenantConnections) {
+	registry := deps.Tenants()
+	for _, t := range cfgs {
+		conns, err := deps.tenantLoader.open(t)
+		if err != nil {
+			f := registry.fail(t, err)
+			if l := blog.Logger(); l != nil {
+				l.Errorf("tenant %d is unavailable, retrying in %s: %v", t.TenantID, time.Until(f.NextRetry).Round(time.Second), err)
+			}
+			continue
+		}
+
+		registry.set(conns, tenantHash(t))
+	}
+
+	// Fill the `Tenant*` maps for the code which still uses them. Like `InitDB`, a tenant only has an entry for
+	// the databases it is configured with.
+	all := registry.All()
+	deps.TenantMySQLDBs, deps.TenantMySQLDBNames = make(map[uint64]*gorm.DB, len(all)), make(map[uint64]string, len(all))
+	deps.TenantMongoDBs, deps.TenantMongoDBNames = make(map[uint64]*mongo.Client, len(all)), make(map[uint64]string, len(all))
+	deps.TenantRedisDBs = make(map[uint64]*dbdrivers.RedisDBConn, len(all))
+	deps.TenantCodes = make(map[string]uint64, len(all))
+	for _, conns := range all {
+		if conns.MySQLDB != nil {
+			deps.TenantMySQLDBs[conns.ID], deps.TenantMySQLDBNames[conns.ID] = conns.MySQLDB, conns.MySQLDBName
+		}
+		if conns.MongoDB != nil {
+			deps.TenantMongoDBs[conns.ID], deps.TenantMongoDBNames[conns.ID] = conns.MongoDB, conns.MongoDBName
+		}
+		if conns.RedisDB != nil {
+			deps.TenantRedisDBs[conns.ID] = conns.RedisDB
+		}
+		if conns.Code != "" {
+			deps.TenantCodes[conns.Code] = conns.ID
+		}
+	}
+}
+
+// retryTenants opens the failed tenants whose retry is due. A tenant which still fails is retried with a longer
+// backoff.
+func (deps *DBDeps) retryTenants() {
+	// IMPORTANT: Serialize with the reloads, so a tenant is never opened twice.
+	deps.reloadMu.Lock()
+	defer deps.reloadMu.Unlock()
+
+	registry := deps.Tenants()
+	var closing []*TenantConns
+
+	for _, t := range registry.dueFailures() {
+		conns, err := deps.tenantLoader.open(t)
+		if err != nil {
+			tenantRetriesTotal.WithLabelValues("failure").Inc()
+			f := registry.fail(t, err)
+			if l := blog.Logger(); l != nil {
+				l.Errorf("tenant %d is still unavailable after %d attempts, retrying in %s: %v", t.TenantID,
+					f.Attempts, time.Until(f.NextRetry).Round(time.Second), err)
+			}
+			continue
+		}
+
+		tenantRetriesTotal.WithLabelValues("success").Inc()
+		if old := registry.set(conns, tenantHash(t)); old != nil {
+			closing = append(closing, old)
+		}
+		if l := blog.Logger(); l != nil {
+			l.Infof("tenant %d is available again", t.TenantID)
+		}
+	}
+
+	deps.closeTenantsLater(closing)
+}
+
+// watchFailedTenants retries the failed tenants until the shutdown.
+func (b *Bean) watchFailedTenants() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// IMPORTANT: The shutdown waits for an in-flight retry, otherwise it could open the connections of a tenant
+	// after `DBDeps.Close`.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				b.DBConn.retryTenants()
+			}
+		}
+	}()
+
+	b.OnShutdown("tenant-retry", func(ctx context.Context) error {
+		cancel()
+		return waitGroup(ctx, &wg)
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	berror "github.com/retail-ai-inc/bean/v2/error"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBDeps_OpenTenants(t *testing.T) {
+	refused := errors.New("connection refused")
+	var down atomic.Bool
+	down.Store(true)
+
+	deps := &DBDeps{}
+	deps.tenantLoader = &tenantLoader{
+		open: func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			if tc.TenantID == 2 && down.Load() {
+				return nil, refused
+			}
+			conns := &TenantConns{ID: tc.TenantID, Code: tc.Code}
+			if tc.TenantID == 1 {
+				conns.RedisDB = &dbdrivers.RedisDBConn{}
+			}
+			return conns, nil
+		},
+	}
+
+	deps.openTenants([]*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme"},
+		{TenantID: 2, Code: "globex"},
+		{TenantID: 3},
+	})
+
+	// The healthy tenant works, the other one is unavailable.
+	_, err := deps.Tenant(1)
+	require.NoError(t, err)
+	assert.Contains(t, deps.TenantCodes, "acme")
+	assert.NotContains(t, deps.TenantCodes, "globex")
+	assert.NotContains(t, deps.TenantCodes, "")
+
+	// Like `InitDB`, the tenants without a database have no entry.
+	assert.Len(t, deps.TenantRedisDBs, 1)
+	assert.Contains(t, deps.TenantRedisDBs, uint64(1))
+	assert.Empty(t, deps.TenantMySQLDBs)
+	assert.Empty(t, deps.TenantMongoDBs)
+
+	id, ok := deps.LookupTenant("globex")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), id)
+	assert.Equal(t, []uint64{1, 2, 3}, deps.Tenants().IDs())
+
+	_, err = deps.Tenant(2)
+	assert.ErrorIs(t, err, tenant.ErrTenantUnavailable)
+	assert.ErrorIs(t, err, refused)
+	var apiErr *berror.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.HTTPStatusCode)
+	assert.Equal(t, berror.TENANT_UNAVAILABLE, apiErr.GlobalErrCode)
+
+	failures := deps.Tenants().Failures()
+	require.Len(t, failures, 1)
+	assert.Equal(t, uint64(2), failures[0].ID)
+	assert.Equal(t, 1, failures[0].Attempts)
+	assert.True(t, failures[0].NextRetry.After(time.Now()))
+
+	// The retry is not due yet.
+	deps.retryTenants()
+	assert.Len(t, deps.Tenants().Failures(), 1)
+
+	// A due retry which fails again backs off.
+	deps.tenants.failures[2].NextRetry = time.Now()
+	deps.retryTenants()
+	failures = deps.Tenants().Failures()
+	require.Len(t, failures, 1)
+	assert.Equal(t, 2, failures[0].Attempts)
+
+	down.Store(false)
+	deps.tenants.failures[2].NextRetry = time.Now()
+	deps.retryTenants()
+	assert.Empty(t, deps.Tenants().Failures())
+	conns, err := deps.Tenant(2)
+	require.NoError(t, err)
+	assert.Equal(t, "globex", conns.Code)
+}
+
+func TestTenantRegistry_LazyBackoff(t *testing.T) {
+	refused := errors.New("connection refused")
+	var opened atomic.Int32
+	r, _ := fakeTenantPool(t, []*dbdrivers.TenantConnections{{TenantID: 1}}, 0, 0,
+		func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			if opened.Add(1) == 1 {
+				return nil, refused
+			}
+			return &TenantConns{ID: tc.TenantID}, nil
+		})
+
+	_, err := r.acquire(1)
+	assert.ErrorIs(t, err, tenant.ErrTenantUnavailable)
+
+	// The tenant is not dialed again until the backoff is over.
+	_, err = r.acquire(1)
+	assert.ErrorIs(t, err, tenant.ErrTenantUnavailable)
+	assert.Equal(t, int32(1), opened.Load())
+
+	r.failures[1].NextRetry = time.Now()
+	_, err = r.acquire(1)
+	require.NoError(t, err)
+	assert.Empty(t, r.Failures())
+}
+
+func TestBean_ReadinessHandler_UnavailableTenants(t *testing.T) {
+	deps := &DBDeps{}
+	deps.Tenants().fail(&dbdrivers.TenantConnections{TenantID: 2}, errors.New("connection refused"))
+
+	b := &Bean{Echo: echo.New(), DBConn: deps}
+	b.Echo.GET("/readyz", b.ReadinessHandler)
+
+	code, body := request(http.MethodGet, "/readyz", b.Echo)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"status":"degraded"`)
+	assert.Contains(t, body, `"unavailableTenants":{"2":"connection refused"}`)
+}
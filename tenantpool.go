@@ -0,0 +1,440 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package bean
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	tenantPoolRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "tenant_pool",
+		Name:      "requests_total",
+		Help:      "How many times the connections of a tenant were requested, by result: hit if they were open, miss otherwise.",
+	}, []string{"result"})
+
+	tenantPoolEvictionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "tenant_pool",
+		Name:      "evictions_total",
+		Help:      "How many tenants had their connections closed, by reason: lru, idle or reload.",
+	}, []string{"reason"})
+
+	tenantPoolOpenErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: "tenant_pool",
+		Name:      "open_errors_total",
+		Help:      "How many times the connections of a tenant could not be opened.",
+	})
+
+	tenantPoolOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: "tenant_pool",
+		Name:      "open",
+		Help:      "How many tenants have their connections open.",
+	})
+
+	registerTenantPoolMetricsOnce sync.Once
+)
+
+// registerTenantPoolMetrics registers the metrics to the default prometheus registry, which is exposed on
+// `/metrics`.
+func registerTenantPoolMetrics() {
+	registerTenantPoolMetricsOnce.Do(func() {
+		for _, c := range []prometheus.Collector{
+			tenantPoolRequestsTotal, tenantPoolEvictionsTotal, tenantPoolOpenErrorsTotal, tenantPoolOpen,
+		} {
+			if err := prometheus.Register(c); err != nil {
+				var are prometheus.AlreadyRegisteredError
+				if !errors.As(err, &are) {
+					panic(err)
+				}
+			}
+		}
+	})
+}
+
+// DefaultTenantEvictDelay is the delay before the connections of a tenant evicted from the lazy pool are closed.
+const DefaultTenantEvictDelay = 5 * time.Second
+
+// tenantCloser closes the connections of the tenants once their in-flight requests are done, see `DBDeps`.
+type tenantCloser interface {
+	closeTenantsAfter(closing []*TenantConns, delay time.Duration) *pendingClose
+	closePending(ctx context.Context, pc *pendingClose) error
+}
+
+// tenantPool opens the connections of a tenant on its first use, for `database.tenant.pool.lazy`. The tenants
+// with open connections are kept in least recently used order, so the `maxOpen` cap closes the least recently
+// used ones first. The connections waiting to be closed count against the cap too. It's guarded by the mutex of
+// its registry.
+type tenantPool struct {
+	cfgs        map[uint64]*dbdrivers.TenantConnections
+	lru         *list.List // of *tenantPoolEntry, the most recently used first.
+	entries     map[uint64]*list.Element
+	closing     *list.List // of *pendingClose, the oldest first.
+	maxOpen     int
+	idleTimeout time.Duration
+	evictDelay  time.Duration
+	open        func(t *dbdrivers.TenantConnections) (*TenantConns, error)
+	closer      tenantCloser
+	evicted     func(id uint64) // if not nil, called with the lock of the registry held.
+	now         func() time.Time
+	// IMPORTANT: The concurrent requests of a tenant share a single dial.
+	group singleflight.Group
+}
+
+type tenantPoolEntry struct {
+	id       uint64
+	lastUsed time.Time
+}
+
+// newLazyTenantRegistry returns a registry which knows the tenants of `cfgs` but opens their connections on
+// their first use.
+func newLazyTenantRegistry(cfgs []*dbdrivers.TenantConnections, cfg config.TenantPool,
+	open func(t *dbdrivers.TenantConnections) (*TenantConns, error), closer tenantCloser,
+) *TenantRegistry {
+	registerTenantPoolMetrics()
+
+	evictDelay := cfg.CloseDelay
+	if evictDelay <= 0 {
+		evictDelay = DefaultTenantEvictDelay
+	}
+
+	r := newTenantRegistry()
+	r.pool = &tenantPool{
+		cfgs:        make(map[uint64]*dbdrivers.TenantConnections, len(cfgs)),
+		lru:         list.New(),
+		entries:     make(map[uint64]*list.Element),
+		closing:     list.New(),
+		maxOpen:     cfg.MaxOpen,
+		idleTimeout: cfg.IdleTimeout,
+		evictDelay:  evictDelay,
+		open:        open,
+		closer:      closer,
+		now:         time.Now,
+	}
+
+	for _, t := range cfgs {
+		r.pool.cfgs[t.TenantID] = t
+		if t.Code != "" {
+			r.codes[t.Code] = t.TenantID
+		}
+	}
+
+	return r
+}
+
+// acquire returns the connections of a tenant. In the lazy mode, they are opened on the first use, or on the
+// first use after the backoff if they failed to open.
+func (r *TenantRegistry) acquire(id uint64) (*TenantConns, error) {
+	p := r.pool
+	if p == nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		if conns, ok := r.tenants[id]; ok {
+			return conns, nil
+		}
+		if f, ok := r.failures[id]; ok {
+			return nil, f.unavailable()
+		}
+		return nil, tenant.NewUnknownTenantError(strconv.FormatUint(id, 10))
+	}
+
+	r.mu.Lock()
+	if conns, ok := r.tenants[id]; ok {
+		p.touch(id)
+		r.mu.Unlock()
+		tenantPoolRequestsTotal.WithLabelValues("hit").Inc()
+		return conns, nil
+	}
+	_, known := p.cfgs[id]
+	var unavailable error
+	if f, ok := r.failures[id]; ok && time.Now().Before(f.NextRetry) {
+		unavailable = f.unavailable()
+	}
+	r.mu.Unlock()
+
+	if !known {
+		return nil, tenant.NewUnknownTenantError(strconv.FormatUint(id, 10))
+	}
+	if unavailable != nil {
+		return nil, unavailable
+	}
+	tenantPoolRequestsTotal.WithLabelValues("miss").Inc()
+
+	v, err, _ := p.group.Do(strconv.FormatUint(id, 10), func() (interface{}, error) {
+		return r.openLazy(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*TenantConns), nil
+}
+
+func (r *TenantRegistry) openLazy(id uint64) (*TenantConns, error) {
+	p := r.pool
+
+	r.mu.Lock()
+	// The connections may have been opened by the previous flight.
+	if conns, ok := r.tenants[id]; ok {
+		p.touch(id)
+		r.mu.Unlock()
+		return conns, nil
+	}
+	t, ok := p.cfgs[id]
+	r.mu.Unlock()
+
+	if !ok {
+		return nil, tenant.NewUnknownTenantError(strconv.FormatUint(id, 10))
+	}
+
+	conns, err := p.open(t)
+	if err != nil {
+		tenantPoolOpenErrorsTotal.Inc()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if p.cfgs[id] != t {
+			return nil, tenant.NewUnavailableTenantError(strconv.FormatUint(id, 10), err)
+		}
+		return nil, r.failLocked(t, err).unavailable()
+	}
+
+	r.mu.Lock()
+	if p.cfgs[id] != t {
+		// The tenant changed or was removed by `ReloadTenants` in the meantime, so the connections serve this
+		// request only.
+		closeNow := r.closeLocked([]*TenantConns{conns}, p.evictDelay)
+		r.mu.Unlock()
+		r.closeNow(closeNow)
+		return conns, nil
+	}
+
+	r.tenants[id] = conns
+	r.recoverLocked(id)
+	p.touch(id)
+
+	var evicted []*TenantConns
+	for p.maxOpen > 0 && p.lru.Len() > p.maxOpen {
+		evicted = append(evicted, r.evictLocked(p.lru.Back().Value.(*tenantPoolEntry).id))
+	}
+	tenantPoolEvictionsTotal.WithLabelValues("lru").Add(float64(len(evicted)))
+	closeNow := r.closeLocked(evicted, p.evictDelay)
+	tenantPoolOpen.Set(float64(len(r.tenants)))
+	r.mu.Unlock()
+
+	r.closeNow(closeNow)
+
+	return conns, nil
+}
+
+// touch marks a tenant as the most recently used one. The caller holds the lock of the registry.
+func (p *tenantPool) touch(id uint64) {
+	if elem, ok := p.entries[id]; ok {
+		elem.Value.(*tenantPoolEntry).lastUsed = p.now()
+		p.lru.MoveToFront(elem)
+		return
+	}
+
+	p.entries[id] = p.lru.PushFront(&tenantPoolEntry{id: id, lastUsed: p.now()})
+}
+
+// evictLocked forgets the connections of a tenant, but not the tenant itself, and returns them. The caller holds
+// the lock of the registry.
+func (r *TenantRegistry) evictLocked(id uint64) *TenantConns {
+	p := r.pool
+	if elem, ok := p.entries[id]; ok {
+		p.lru.Remove(elem)
+		delete(p.entries, id)
+	}
+
+	conns, ok := r.tenants[id]
+	if !ok {
+		return nil
+	}
+	delete(r.tenants, id)
+	if p.evicted != nil {
+		p.evicted(id)
+	}
+
+	return conns
+}
+
+// closeLocked closes the connections after `delay`, and returns the oldest pending closes which must be closed
+// right away, so the open and the closing connections stay within `maxOpen`. The caller holds the lock of the
+// registry, and calls `closeNow` once it's released.
+func (r *TenantRegistry) closeLocked(closing []*TenantConns, delay time.Duration) []*pendingClose {
+	p := r.pool
+	for _, conns := range closing {
+		if conns != nil {
+			p.closing.PushBack(p.closer.closeTenantsAfter([]*TenantConns{conns}, delay))
+		}
+	}
+
+	for elem := p.closing.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*pendingClose).closed.Load() {
+			p.closing.Remove(elem)
+		}
+		elem = next
+	}
+
+	var closeNow []*pendingClose
+	for p.maxOpen > 0 && p.closing.Len() > 0 && p.lru.Len()+p.closing.Len() > p.maxOpen {
+		closeNow = append(closeNow, p.closing.Remove(p.closing.Front()).(*pendingClose))
+	}
+
+	return closeNow
+}
+
+// closeNow closes the pending closes returned by `closeLocked`.
+func (r *TenantRegistry) closeNow(pending []*pendingClose) {
+	for _, pc := range pending {
+		if err := r.pool.closer.closePending(context.Background(), pc); err != nil {
+			if l := blog.Logger(); l != nil {
+				l.Error(err)
+			}
+		}
+	}
+}
+
+// evictIdle closes the connections of the tenants unused for `idleTimeout`.
+func (r *TenantRegistry) evictIdle() {
+	p := r.pool
+	deadline := p.now().Add(-p.idleTimeout)
+
+	r.mu.Lock()
+	var evicted []*TenantConns
+	for elem := p.lru.Back(); elem != nil; elem = p.lru.Back() {
+		entry := elem.Value.(*tenantPoolEntry)
+		if entry.lastUsed.After(deadline) {
+			break
+		}
+		evicted = append(evicted, r.evictLocked(entry.id))
+	}
+	tenantPoolEvictionsTotal.WithLabelValues("idle").Add(float64(len(evicted)))
+	closeNow := r.closeLocked(evicted, p.evictDelay)
+	tenantPoolOpen.Set(float64(len(r.tenants)))
+	r.mu.Unlock()
+
+	r.closeNow(closeNow)
+}
+
+// reloadLazy swaps the tenants of the lazy mode with `cfgs`. The open connections of the changed and removed
+// tenants are closed after `closeDelay`, the changed ones are opened again on their next use.
+func (r *TenantRegistry) reloadLazy(cfgs []*dbdrivers.TenantConnections, closeDelay time.Duration) *TenantChanges {
+	p := r.pool
+	changes := &TenantChanges{}
+	seen := make(map[uint64]bool, len(cfgs))
+	var evicted []*TenantConns
+
+	r.mu.Lock()
+	for _, t := range cfgs {
+		seen[t.TenantID] = true
+
+		old, ok := p.cfgs[t.TenantID]
+		if ok && tenantHash(old) == tenantHash(t) {
+			continue
+		}
+
+		if ok {
+			changes.Updated = append(changes.Updated, t.TenantID)
+			if r.codes[old.Code] == old.TenantID {
+				delete(r.codes, old.Code)
+			}
+			r.recoverLocked(t.TenantID)
+			if conns := r.evictLocked(t.TenantID); conns != nil {
+				evicted = append(evicted, conns)
+			}
+		} else {
+			changes.Added = append(changes.Added, t.TenantID)
+		}
+
+		p.cfgs[t.TenantID] = t
+		if t.Code != "" {
+			r.codes[t.Code] = t.TenantID
+		}
+	}
+
+	for id, old := range p.cfgs {
+		if seen[id] {
+			continue
+		}
+
+		changes.Removed = append(changes.Removed, id)
+		delete(p.cfgs, id)
+		r.recoverLocked(id)
+		if r.codes[old.Code] == id {
+			delete(r.codes, old.Code)
+		}
+		if conns := r.evictLocked(id); conns != nil {
+			evicted = append(evicted, conns)
+		}
+	}
+	tenantPoolEvictionsTotal.WithLabelValues("reload").Add(float64(len(evicted)))
+	closeNow := r.closeLocked(evicted, closeDelay)
+	tenantPoolOpen.Set(float64(len(r.tenants)))
+	r.mu.Unlock()
+
+	sortIDs(changes.Removed)
+	r.closeNow(closeNow)
+
+	return changes
+}
+
+// watchIdleTenants closes the connections of the idle tenants until the shutdown.
+func (b *Bean) watchIdleTenants(r *TenantRegistry) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The shutdown waits for an in-flight eviction before the connections are closed.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(max(r.pool.idleTimeout/2, time.Second))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				r.evictIdle()
+			}
+		}
+	}()
+
+	b.OnShutdown("tenant-pool", func(ctx context.Context) error {
+		cancel()
+		return waitGroup(ctx, &wg)
+	})
+}
@@ -0,0 +1,252 @@
+// Copyright The RAI Inc.
+// The RAI Authors
+package bean
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/retail-ai-inc/bean/v2/config"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	"github.com/retail-ai-inc/bean/v2/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// fakeTenantCloser counts the connections scheduled to be closed, and the ones closed.
+type fakeTenantCloser struct {
+	scheduled atomic.Int32
+	closed    atomic.Int32
+}
+
+func (c *fakeTenantCloser) closeTenantsAfter(closing []*TenantConns, _ time.Duration) *pendingClose {
+	c.scheduled.Add(int32(len(closing)))
+	return &pendingClose{conns: closing}
+}
+
+func (c *fakeTenantCloser) closePending(_ context.Context, pc *pendingClose) error {
+	if !pc.closed.Swap(true) {
+		c.closed.Add(int32(len(pc.conns)))
+	}
+	return nil
+}
+
+// fakeTenantPool returns a lazy registry whose connections are empty, and its closer.
+func fakeTenantPool(t *testing.T, cfgs []*dbdrivers.TenantConnections, maxOpen int, idleTimeout time.Duration,
+	open func(tc *dbdrivers.TenantConnections) (*TenantConns, error),
+) (*TenantRegistry, *fakeTenantCloser) {
+	t.Helper()
+
+	if open == nil {
+		open = func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			return &TenantConns{ID: tc.TenantID, Code: tc.Code}, nil
+		}
+	}
+
+	closer := &fakeTenantCloser{}
+	r := newLazyTenantRegistry(cfgs, config.TenantPool{MaxOpen: maxOpen, IdleTimeout: idleTimeout}, open, closer)
+
+	return r, closer
+}
+
+func TestTenantRegistry_Lazy(t *testing.T) {
+	cfgs := []*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme"},
+		{TenantID: 2, Code: "globex"},
+		{TenantID: 3, Code: "initech"},
+	}
+
+	var opened atomic.Int32
+	r, closed := fakeTenantPool(t, cfgs, 2, 0, func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+		opened.Add(1)
+		return &TenantConns{ID: tc.TenantID, Code: tc.Code}, nil
+	})
+
+	hits := testutil.ToFloat64(tenantPoolRequestsTotal.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(tenantPoolRequestsTotal.WithLabelValues("miss"))
+	lru := testutil.ToFloat64(tenantPoolEvictionsTotal.WithLabelValues("lru"))
+
+	// Nothing is opened until the first use, but all the tenants are known.
+	assert.Empty(t, r.All())
+	assert.Equal(t, []uint64{1, 2, 3}, r.IDs())
+	id, ok := r.Lookup("initech")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), id)
+
+	first, err := r.acquire(1)
+	require.NoError(t, err)
+	again, err := r.acquire(1)
+	require.NoError(t, err)
+	assert.Same(t, first, again)
+
+	_, err = r.acquire(2)
+	require.NoError(t, err)
+	// 1 is used again, so 2 is the least recently used one when 3 is opened.
+	_, err = r.acquire(1)
+	require.NoError(t, err)
+	_, err = r.acquire(3)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(3), opened.Load())
+	// The evicted connections would exceed maxOpen, so they are closed right away.
+	assert.Equal(t, int32(1), closed.closed.Load())
+	_, ok = r.Get(2)
+	assert.False(t, ok)
+	assert.Len(t, r.All(), 2)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(tenantPoolRequestsTotal.WithLabelValues("hit"))-hits)
+	assert.Equal(t, float64(3), testutil.ToFloat64(tenantPoolRequestsTotal.WithLabelValues("miss"))-misses)
+	assert.Equal(t, float64(1), testutil.ToFloat64(tenantPoolEvictionsTotal.WithLabelValues("lru"))-lru)
+	assert.Equal(t, float64(2), testutil.ToFloat64(tenantPoolOpen))
+
+	_, err = r.acquire(4)
+	assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+}
+
+func TestTenantRegistry_LazySingleflight(t *testing.T) {
+	release := make(chan struct{})
+	var opened atomic.Int32
+	r, _ := fakeTenantPool(t, []*dbdrivers.TenantConnections{{TenantID: 1}}, 0, 0,
+		func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			opened.Add(1)
+			<-release
+			return &TenantConns{ID: tc.TenantID}, nil
+		})
+
+	var wg sync.WaitGroup
+	got := make([]*TenantConns, 10)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conns, err := r.acquire(1)
+			assert.NoError(t, err)
+			got[i] = conns
+		}(i)
+	}
+
+	assert.Eventually(t, func() bool { return opened.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), opened.Load())
+	for _, conns := range got {
+		assert.Same(t, got[0], conns)
+	}
+}
+
+func TestTenantRegistry_LazyOpenError(t *testing.T) {
+	fail := errors.New("connection refused")
+	r, _ := fakeTenantPool(t, []*dbdrivers.TenantConnections{{TenantID: 1}}, 0, 0,
+		func(tc *dbdrivers.TenantConnections) (*TenantConns, error) {
+			return nil, fail
+		})
+
+	_, err := r.acquire(1)
+	assert.ErrorIs(t, err, fail)
+	assert.Empty(t, r.All())
+}
+
+func TestTenantRegistry_EvictIdle(t *testing.T) {
+	cfgs := []*dbdrivers.TenantConnections{{TenantID: 1}, {TenantID: 2}}
+	r, closed := fakeTenantPool(t, cfgs, 0, time.Minute, nil)
+
+	now := time.Now()
+	r.pool.now = func() time.Time { return now }
+
+	_, err := r.acquire(1)
+	require.NoError(t, err)
+	now = now.Add(45 * time.Second)
+	_, err = r.acquire(2)
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Second)
+	r.evictIdle()
+
+	assert.Equal(t, int32(1), closed.scheduled.Load())
+	assert.Zero(t, closed.closed.Load())
+	_, ok := r.Get(1)
+	assert.False(t, ok)
+	_, ok = r.Get(2)
+	assert.True(t, ok)
+
+	// An evicted tenant is opened again on its next use.
+	_, err = r.acquire(1)
+	require.NoError(t, err)
+	assert.Len(t, r.All(), 2)
+}
+
+func TestTenantRegistry_LazyPendingCloses(t *testing.T) {
+	cfgs := []*dbdrivers.TenantConnections{{TenantID: 1}, {TenantID: 2}, {TenantID: 3}}
+	r, closer := fakeTenantPool(t, cfgs, 2, time.Minute, nil)
+
+	now := time.Now()
+	r.pool.now = func() time.Time { return now }
+
+	_, err := r.acquire(1)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	r.evictIdle()
+	assert.Equal(t, int32(1), closer.scheduled.Load())
+
+	// Tenant 1 is still closing, so it counts against maxOpen.
+	_, err = r.acquire(2)
+	require.NoError(t, err)
+	assert.Zero(t, closer.closed.Load())
+	_, err = r.acquire(3)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), closer.closed.Load())
+	assert.Equal(t, 0, r.pool.closing.Len())
+}
+
+func TestDBDeps_ReloadTenantsLazy(t *testing.T) {
+	rows := []*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme", Connections: datatypes.JSON(`{"redis":{"database":1}}`)},
+		{TenantID: 2, Code: "globex"},
+	}
+
+	deps := &DBDeps{}
+	deps.tenantLoader = &tenantLoader{
+		load: func(ctx context.Context) ([]*dbdrivers.TenantConnections, error) {
+			return rows, nil
+		},
+	}
+	r, closed := fakeTenantPool(t, rows, 0, 0, nil)
+	deps.tenants = r
+
+	first, err := deps.Tenant(1)
+	require.NoError(t, err)
+	_, err = deps.Tenant(2)
+	require.NoError(t, err)
+
+	// Tenant 1 changed, 2 is deleted and 3 is new.
+	rows = []*dbdrivers.TenantConnections{
+		{TenantID: 1, Code: "acme", Connections: datatypes.JSON(`{"redis":{"database":2}}`)},
+		{TenantID: 3, Code: "initech"},
+	}
+
+	changes, err := deps.ReloadTenants(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &TenantChanges{Added: []uint64{3}, Updated: []uint64{1}, Removed: []uint64{2}}, changes)
+	assert.Equal(t, []uint64{1, 3}, deps.Tenants().IDs())
+	assert.Equal(t, int32(2), closed.scheduled.Load())
+	assert.Empty(t, deps.Tenants().All())
+
+	updated, err := deps.Tenant(1)
+	require.NoError(t, err)
+	assert.NotSame(t, first, updated)
+
+	_, err = deps.Tenant(2)
+	assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+	_, ok := deps.LookupTenant("globex")
+	assert.False(t, ok)
+	id, ok := deps.LookupTenant("initech")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), id)
+}
@@ -0,0 +1,406 @@
+// MIT License
+
+// Copyright (c) The RAI Authors
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bean
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/retail-ai-inc/bean/v2/internal/dbdrivers"
+	blog "github.com/retail-ai-inc/bean/v2/log"
+)
+
+// DefaultTenantCloseDelay is the delay before the connections of a changed or deleted tenant are closed.
+const DefaultTenantCloseDelay = 30 * time.Second
+
+// TenantChanges are the tenants changed by `ReloadTenants`. The connections of a `Failed` tenant could not be
+// opened, so it keeps its previous connections, if any.
+type TenantChanges struct {
+	Added   []uint64 `json:"added"`
+	Updated []uint64 `json:"updated"`
+	Removed []uint64 `json:"removed"`
+	Failed  []uint64 `json:"failed"`
+}
+
+func (c *TenantChanges) empty() bool {
+	return len(c.Added)+len(c.Updated)+len(c.Removed)+len(c.Failed) == 0
+}
+
+// tenantLoader loads the tenants of the master database and opens their connections.
+type tenantLoader struct {
+	load       func(ctx context.Context) ([]*dbdrivers.TenantConnections, error)
+	open       func(t *dbdrivers.TenantConnections) (*TenantConns, error)
+	closeDelay time.Duration
+}
+
+// initTenants opens the tenants loaded by `InitDB`, unless `database.tenant.failFast` opened them already, and
+// keeps their hashes, so `ReloadTenants` only reopens the changed ones. In the lazy mode, it sets up the registry
+// which opens the tenants on their first use instead.
+func (b *Bean) initTenants(cfgs []*dbdrivers.TenantConnections) {
+	deps := b.DBConn
+	dbCfg := b.Config.Database
+
+	closeDelay := dbCfg.Tenant.Reload.CloseDelay
+	if closeDelay <= 0 {
+		closeDelay = DefaultTenantCloseDelay
+	}
+
+	deps.tenantLoader = &tenantLoader{
+		load: func(ctx context.Context) ([]*dbdrivers.TenantConnections, error) {
+			return dbdrivers.LoadTenantCfgs(ctx, deps.MasterMySQLDB)
+		},
+		open: func(t *dbdrivers.TenantConnections) (*TenantConns, error) {
+			dbs, err := dbdrivers.OpenTenantDBs(dbCfg.MySQL, dbCfg.Mongo, dbCfg.Redis, t, TenantAlterDbHostParam,
+				b.Config.Secret, blog.Logger())
+			if err != nil {
+				return nil, err
+			}
+
+			conns := &TenantConns{
+				ID:          t.TenantID,
+				Code:        t.Code,
+				MySQLDB:     dbs.MySQL,
+				MySQLDBName: dbs.MySQLName,
+				MongoDB:     dbs.Mongo,
+				MongoDBName: dbs.MongoName,
+				RedisDB:     dbs.Redis,
+			}
+			deps.useTenantCircuitBreakers(conns)
+
+			return conns, nil
+		},
+		closeDelay: closeDelay,
+	}
+
+	minBackoff, maxBackoff := dbCfg.Tenant.Retry.MinBackoff, dbCfg.Tenant.Retry.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultTenantRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = max(DefaultTenantRetryMaxBackoff, minBackoff)
+	}
+
+	if pool := dbCfg.Tenant.Pool; pool.Lazy {
+		deps.tenants = newLazyTenantRegistry(cfgs, pool, deps.tenantLoader.open, deps)
+		deps.tenants.pool.evicted = deps.removeTenantCircuitBreakers
+		deps.tenants.minBackoff, deps.tenants.maxBackoff = minBackoff, maxBackoff
+		if pool.IdleTimeout > 0 {
+			b.watchIdleTenants(deps.tenants)
+		}
+		return
+	}
+
+	registry := deps.Tenants()
+	registry.minBackoff, registry.maxBackoff = minBackoff, maxBackoff
+
+	if dbCfg.Tenant.FailFast {
+		for _, t := range cfgs {
+			if conns, ok := registry.Get(t.TenantID); ok {
+				registry.set(conns, tenantHash(t))
+			}
+		}
+	} else {
+		deps.openTenants(cfgs)
+	}
+
+	b.watchFailedTenants()
+}
+
+// ReloadTenants loads the `TenantConnections` of the master database, opens the connections of the new and
+// changed tenants and swaps them in `Tenants`. The tenants which fail to open are retried in the background. The
+// connections of the changed and deleted (or soft deleted) tenants are closed after `closeDelay`. The errors of
+// the tenants which could not be opened are joined. In the lazy mode, nothing is opened: the changed tenants are
+// opened again on their next use.
+func (deps *DBDeps) ReloadTenants(ctx context.Context) (*TenantChanges, error) {
+	if deps.tenantLoader == nil {
+		return nil, errors.New("the tenants are not initialized, call `InitDB` with `database.tenant.on` first")
+	}
+
+	// IMPORTANT: Serialize the reloads, so a tenant is never opened twice.
+	deps.reloadMu.Lock()
+	defer deps.reloadMu.Unlock()
+
+	cfgs, err := deps.tenantLoader.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := deps.Tenants()
+	if registry.pool != nil {
+		return registry.reloadLazy(cfgs, deps.tenantLoader.closeDelay), nil
+	}
+
+	changes := &TenantChanges{}
+	seen := make(map[uint64]bool, len(cfgs))
+	var closing []*TenantConns
+	var errs []error
+
+	for _, t := range cfgs {
+		seen[t.TenantID] = true
+
+		hash := tenantHash(t)
+		if current, ok := registry.hash(t.TenantID); ok && current == hash {
+			continue
+		}
+
+		conns, err := deps.tenantLoader.open(t)
+		if err != nil {
+			changes.Failed = append(changes.Failed, t.TenantID)
+			errs = append(errs, err)
+			registry.fail(t, err)
+			continue
+		}
+
+		if old := registry.set(conns, hash); old != nil {
+			changes.Updated = append(changes.Updated, t.TenantID)
+			closing = append(closing, old)
+		} else {
+			changes.Added = append(changes.Added, t.TenantID)
+		}
+	}
+
+	for _, id := range registry.IDs() {
+		if seen[id] {
+			continue
+		}
+		old, ok := registry.remove(id)
+		if !ok {
+			continue
+		}
+		changes.Removed = append(changes.Removed, id)
+		deps.removeTenantCircuitBreakers(id)
+		if old != nil {
+			closing = append(closing, old)
+		}
+	}
+
+	deps.closeTenantsLater(closing)
+
+	return changes, errors.Join(errs...)
+}
+
+// pendingClose holds the connections of tenants until their in-flight requests are done. The pending closes
+// are tracked by `DBDeps`, so the shutdown closes them right away.
+type pendingClose struct {
+	conns  []*TenantConns
+	timer  *time.Timer
+	closed atomic.Bool
+}
+
+// closeTenantsLater closes the connections once the in-flight requests which use them are done.
+func (deps *DBDeps) closeTenantsLater(closing []*TenantConns) {
+	if len(closing) == 0 {
+		return
+	}
+
+	deps.closeTenantsAfter(closing, deps.tenantLoader.closeDelay)
+}
+
+// closeTenantsAfter closes the connections after `delay`, unless `closePending` closes them first.
+func (deps *DBDeps) closeTenantsAfter(closing []*TenantConns, delay time.Duration) *pendingClose {
+	pc := &pendingClose{conns: closing}
+
+	deps.closeMu.Lock()
+	defer deps.closeMu.Unlock()
+
+	if deps.pendingCloses == nil {
+		deps.pendingCloses = make(map[*pendingClose]struct{})
+	}
+	deps.pendingCloses[pc] = struct{}{}
+	pc.timer = time.AfterFunc(delay, func() {
+		if err := deps.closePending(context.Background(), pc); err != nil {
+			if l := blog.Logger(); l != nil {
+				l.Error(err)
+			}
+		}
+	})
+
+	return pc
+}
+
+// closePending closes the connections of a pending close right away. It does nothing if they are closed already.
+func (deps *DBDeps) closePending(ctx context.Context, pc *pendingClose) error {
+	deps.closeMu.Lock()
+	_, ok := deps.pendingCloses[pc]
+	delete(deps.pendingCloses, pc)
+	deps.closeMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	pc.timer.Stop()
+	pc.closed.Store(true)
+
+	var errs []error
+	for _, conns := range pc.conns {
+		if err := deps.unreferencedDBs(conns).Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the connections of tenant %d: %w", conns.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// closeAllPending closes the connections of all the pending closes, during the shutdown.
+func (deps *DBDeps) closeAllPending(ctx context.Context) error {
+	deps.closeMu.Lock()
+	pending := make([]*pendingClose, 0, len(deps.pendingCloses))
+	for pc := range deps.pendingCloses {
+		pending = append(pending, pc)
+	}
+	deps.closeMu.Unlock()
+
+	var errs []error
+	for _, pc := range pending {
+		if err := deps.closePending(ctx, pc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// unreferencedDBs returns the connections of a tenant which the `Tenant*` maps of `DBDeps` don't hold. The
+// maps are never updated, so the connections they hold are never closed: their callers keep working with the
+// connections opened by `InitDB`.
+func (deps *DBDeps) unreferencedDBs(conns *TenantConns) dbdrivers.TenantDBs {
+	dbs := conns.dbs()
+	if dbs.MySQL != nil && deps.TenantMySQLDBs[conns.ID] == dbs.MySQL {
+		dbs.MySQL = nil
+	}
+	if dbs.Mongo != nil && deps.TenantMongoDBs[conns.ID] == dbs.Mongo {
+		dbs.Mongo = nil
+	}
+	if dbs.Redis != nil && deps.TenantRedisDBs[conns.ID] == dbs.Redis {
+		dbs.Redis = nil
+	}
+
+	return dbs
+}
+
+// tenantHash changes when the `TenantConnections` row of a tenant changes.
+func tenantHash(t *dbdrivers.TenantConnections) string {
+	sum := sha256.Sum256(append([]byte(t.Code+"\x00"), t.Connections...))
+	return hex.EncodeToString(sum[:])
+}
+
+// watchTenants reloads the tenants every `interval` and on every message of the redis `channel`, until the
+// shutdown, and adds the reload end point.
+func (b *Bean) watchTenants() {
+	cfg := b.Config.Database.Tenant.Reload
+	deps := b.DBConn
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reload := func(trigger string) {
+		changes, err := deps.ReloadTenants(ctx)
+		l := blog.Logger()
+		if l == nil || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			l.Errorf("tenant reload (%s): %v", trigger, err)
+		}
+		if changes != nil && !changes.empty() {
+			l.Infof("tenant reload (%s): added %v, updated %v, removed %v, failed %v",
+				trigger, changes.Added, changes.Updated, changes.Removed, changes.Failed)
+		}
+	}
+
+	// IMPORTANT: The shutdown waits for an in-flight reload, otherwise it could open the connections of a tenant
+	// after `DBDeps.Close`.
+	var wg sync.WaitGroup
+	if cfg.Interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(cfg.Interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					reload("interval")
+				}
+			}
+		}()
+	}
+
+	var pubsub *redis.PubSub
+	if cfg.Channel != "" && deps.MasterRedisDB != nil && deps.MasterRedisDB.Primary != nil {
+		pubsub = deps.MasterRedisDB.Primary.Subscribe(ctx, cfg.Channel)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range pubsub.Channel() {
+				reload("channel")
+			}
+		}()
+	}
+
+	if cfg.API.EndPoint != "" {
+		b.adminOrPublic().POST(cfg.API.EndPoint, b.tenantReloadHandler, adminAuth(cfg.API.AuthBearerToken, nil))
+	}
+
+	b.OnShutdown("tenant-reload", func(ctx context.Context) error {
+		cancel()
+		var err error
+		if pubsub != nil {
+			err = pubsub.Close()
+		}
+		return errors.Join(err, waitGroup(ctx, &wg))
+	})
+}
+
+// tenantReloadHandler reloads the tenants of this instance. If `database.tenant.reload.channel` is set, the
+// other instances are notified through redis as well.
+func (b *Bean) tenantReloadHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	changes, err := b.DBConn.ReloadTenants(ctx)
+	if changes == nil {
+		return err
+	}
+
+	resp := map[string]interface{}{"changes": changes}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+
+	if channel := b.Config.Database.Tenant.Reload.Channel; channel != "" && b.DBConn.MasterRedisDB != nil {
+		if pErr := b.DBConn.MasterRedisDB.Primary.Publish(ctx, channel, "reload").Err(); pErr != nil {
+			return pErr
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}